@@ -1,7 +1,6 @@
 package goaxle
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/url"
 	"time"
@@ -19,6 +18,7 @@ type Api struct {
 	UpdatedAt float64 `json:"updatedAt,omitempty"`
 
 	// The time in seconds that every call under this API should be cached
+	// See CacheDuration and SetCacheDuration.
 	GlobalCache int `json:"globalCache"`
 
 	// The protocol for the API, whether or not to use SSL
@@ -32,6 +32,7 @@ type Api struct {
 	EndPoint string `json:"endPoint,omitempty"`
 
 	// Seconds to wait before timing out the connection
+	// See Timeout and SetTimeout.
 	EndPointTimeout int `json:"endPointTimeout"`
 
 	// Max redirects that are allowed when endpoint called.
@@ -86,15 +87,9 @@ func NewApi(axleAddress string, identifier string, endPoint string) (out *Api) {
 
 // GetAPI retrieves an existing api object from the server.
 func GetApi(axleAddress string, identifier string) (out *Api, err error) {
-
-	reqAddress := fmt.Sprintf("%s%sapi/%s", axleAddress, VERSION_ENDPOINT, url.QueryEscape(identifier))
-	body, err := doHttpRequest("GET", reqAddress, nil)
-	if err != nil {
-		return nil, err
-	}
 	// unmarshal into our new api object
 	api := NewApi(axleAddress, identifier, "")
-	err = populateApiFromResponse(&api, body, []string{"results"})
+	err = getResource(axleAddress, KIND_API, identifier, api, "endPoint")
 	if err != nil {
 		return nil, err
 	}
@@ -106,39 +101,50 @@ func GetApi(axleAddress string, identifier string) (out *Api, err error) {
 // Create / Update this API on the ApiAxle server.
 // To modify an existing API, be sure to retrieve it with GetApi, otherwise
 // the library will attempt to create a new API of the same name.
+// Unless ValidateBeforeSave is false, Validate is called first.
 func (this *Api) Save() (err error) {
-	reqAddress := fmt.Sprintf("%s%sapi/%s", this.axleAddress, VERSION_ENDPOINT, url.QueryEscape(this.Identifier))
+	if ValidateBeforeSave {
+		err = this.Validate()
+		if err != nil {
+			return err
+		}
+	}
 
 	// update the updatedAt timestamp
 	this.UpdatedAt = float64(time.Now().UnixNano() / (1000 * 1000))
-	marshalled, err := json.Marshal(this)
+	err = saveResource(this.axleAddress, KIND_API, this.Identifier, !this.createOnSave, this, "endPoint")
 	if err != nil {
-		return fmt.Errorf("Unable to marshal API: %s", err.Error())
+		return err
 	}
 
-	httpMethod := "POST"
-	if !this.createOnSave {
-		httpMethod = "PUT"
-	}
+	this.createOnSave = false
 
-	body, err := doHttpRequest(httpMethod, reqAddress, marshalled)
-	if err != nil {
-		return err
-	}
+	return nil
+}
 
-	if !this.createOnSave {
-		err = populateApiFromResponse(&this, body, []string{"results", "new"})
-	} else {
-		err = populateApiFromResponse(&this, body, []string{"results"})
-	}
+// Delete removes this API from the server.
+func (this *Api) Delete() (err error) {
+	return DeleteApi(this.axleAddress, this.Identifier)
+}
 
+// Refresh reloads this API from the server, discarding any local changes.
+func (this *Api) Refresh() (err error) {
+	api, err := GetApi(this.axleAddress, this.Identifier)
 	if err != nil {
 		return err
 	}
+	*this = *api
+	return nil
+}
 
-	this.createOnSave = false
+// ID returns the API identifier.
+func (this *Api) ID() string {
+	return this.Identifier
+}
 
-	return nil
+// Kind returns KIND_API.
+func (this *Api) Kind() Kind {
+	return KIND_API
 }
 
 // ParseCreatedAt returns the API created time as a Go time.Time.
@@ -151,19 +157,29 @@ func (this *Api) ParseUpdatedAt() time.Time {
 	return parseFloatToTime(this.UpdatedAt)
 }
 
+// Timeout returns EndPointTimeout as a time.Duration.
+func (this *Api) Timeout() time.Duration {
+	return time.Duration(this.EndPointTimeout) * time.Second
+}
+
+// SetTimeout sets EndPointTimeout, rounding up to whole seconds.
+func (this *Api) SetTimeout(timeout time.Duration) {
+	this.EndPointTimeout = durationToSeconds(timeout)
+}
+
+// CacheDuration returns GlobalCache as a time.Duration.
+func (this *Api) CacheDuration() time.Duration {
+	return time.Duration(this.GlobalCache) * time.Second
+}
+
+// SetCacheDuration sets GlobalCache, rounding up to whole seconds.
+func (this *Api) SetCacheDuration(cache time.Duration) {
+	this.GlobalCache = durationToSeconds(cache)
+}
+
 // String provides a JSON-like formated representation of this API object
 func (this *Api) String() string {
-	out, err := json.MarshalIndent(this, "", "    ")
-	if err != nil {
-		return "<nil>"
-	}
-	reqAddress := fmt.Sprintf(
-		"%s%sapi/%s",
-		this.axleAddress,
-		VERSION_ENDPOINT,
-		url.QueryEscape(this.Identifier),
-	)
-	return fmt.Sprintf("Api - %s: %s", reqAddress, string(out))
+	return formatResource("Api", this.axleAddress, KIND_API, this.Identifier, this)
 }
 
 // LinkKey links the provided key with this API.
@@ -187,7 +203,7 @@ func ApiLinkKey(axleAddress string, apiIdentifier string, keyIdentifier string)
 	}
 
 	key = NewKey(axleAddress, keyIdentifier)
-	err = populateKeyFromResponse(&key, body, []string{"results"})
+	err = populateFromResponse(KIND_KEY, key, body, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -217,7 +233,7 @@ func ApiUnlinkKey(axleAddress string, apiIdentifier string, keyIdentifier string
 	}
 
 	key = NewKey(axleAddress, keyIdentifier)
-	err = populateKeyFromResponse(&key, body, []string{"results"})
+	err = populateFromResponse(KIND_KEY, key, body, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -305,92 +321,10 @@ func ApiStats(axleAddress string, apiIdentifier string, from time.Time, to time.
 	return doStatsRequest(reqAddress)
 }
 
-// populateApiFromResponse updates the provided Api pointer with the fields
-// provided in the response map.
-func populateApiFromResponse(api **Api, body []byte, detailsLocation []string) (err error) {
-	response := make(map[string]interface{})
-	err = json.Unmarshal(body, &response)
-	if err != nil {
-		return fmt.Errorf(
-			"Unable to unmarshal response: %s",
-			err.Error(),
-		)
-	}
-
-	// navigate to the correct spot in the response to read from
-	for _, key := range detailsLocation {
-		resultsInterface, exists := response[key]
-		if !exists {
-			return fmt.Errorf(
-				"Response map did not contain expected key: %s",
-				key,
-			)
-		}
-		var isValidCast bool
-		response, isValidCast = resultsInterface.(map[string]interface{})
-		if !isValidCast {
-			return fmt.Errorf(
-				"key %s did not contain map: %s",
-				key,
-			)
-		}
-	}
-
-	if _, exists := response["endPoint"]; !exists {
-		return fmt.Errorf(
-			"Unable to parse response into Api: Missing required field \"endPoint\"",
-		)
-	}
-	// making use of json to populate the object
-	jsonvalue, err := json.Marshal(response)
-	if err != nil {
-		return fmt.Errorf("Unable to decode api in response: %s", err.Error())
-	}
-	err = json.Unmarshal(jsonvalue, api)
-	if err != nil {
-		return fmt.Errorf("Unable to decode api in response: %s", err.Error())
-	}
-	return nil
-}
-
 // DeleteApi removes the identified API.  Any existing objects represting this
 // API will error on Save().
 func DeleteApi(axleAddress string, identifier string) (err error) {
-	reqAddress := fmt.Sprintf("%s%sapi/%s", axleAddress, VERSION_ENDPOINT, url.QueryEscape(identifier))
-
-	body, err := doHttpRequest("DELETE", reqAddress, nil)
-	if err != nil {
-		return err
-	}
-
-	responseMap := make(map[string]interface{})
-	err = json.Unmarshal(body, &responseMap)
-	if err != nil {
-		return fmt.Errorf(
-			"Unable to unmarshal response from %s: %s",
-			reqAddress,
-			err.Error(),
-		)
-	}
-
-	// in this case, our result is what is contained in the "results" key
-	resultsInterface, exists := responseMap["results"]
-	if !exists {
-		return fmt.Errorf("Missing response from %s", reqAddress)
-	}
-	succeeded, isValidCast := resultsInterface.(bool)
-	if !isValidCast {
-		return fmt.Errorf(
-			"Unable to extract response object from %s",
-			reqAddress,
-		)
-	}
-
-	if !succeeded {
-		return fmt.Errorf("Delete of API at %s failed", reqAddress)
-	}
-
-	return nil
+	return deleteResource(axleAddress, KIND_API, identifier)
 }
 
 /* ex: set noexpandtab: */
@@ -0,0 +1,89 @@
+package goaxle
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// Authenticator adds credentials to requests made to the management API.
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// BasicAuth authenticates with an HTTP basic username and password.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+// Authenticate implements Authenticator.
+func (this BasicAuth) Authenticate(req *http.Request) error {
+	req.SetBasicAuth(this.Username, this.Password)
+	return nil
+}
+
+// BearerToken authenticates with an "Authorization: Bearer" token.
+type BearerToken string
+
+// Authenticate implements Authenticator.
+func (this BearerToken) Authenticate(req *http.Request) error {
+	if this == "" {
+		return fmt.Errorf("Unable to authenticate, bearer token is empty")
+	}
+	req.Header.Set("Authorization", "Bearer "+string(this))
+	return nil
+}
+
+// HeaderAuth sets arbitrary headers on every request, for proxies expecting
+// e.g. an API key header.
+type HeaderAuth http.Header
+
+// Authenticate implements Authenticator.
+func (this HeaderAuth) Authenticate(req *http.Request) error {
+	for name, values := range this {
+		req.Header.Del(name)
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	return nil
+}
+
+// AuthenticatorFunc adapts a function to an Authenticator.
+type AuthenticatorFunc func(req *http.Request) error
+
+// Authenticate implements Authenticator.
+func (this AuthenticatorFunc) Authenticate(req *http.Request) error {
+	return this(req)
+}
+
+// ClientCertificate loads a PEM encoded certificate and key for mutual TLS,
+// suitable for Client.TLSConfig.  If caFile isn't empty, the server's
+// certificate is verified against it instead of the system roots.
+func ClientCertificate(certFile string, keyFile string, caFile string) (config *tls.Config, err error) {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load client certificate: %s", err)
+	}
+	config = &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read CA certificate: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("Unable to parse CA certificate in %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+/* ex: set noexpandtab: */
@@ -0,0 +1,143 @@
+package goaxle
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAuthenticators(t *testing.T) {
+	axle := newTestAxle(t, map[string]string{
+		"GET /v1/ping": "pong",
+	})
+	cases := []struct {
+		auth   Authenticator
+		header string
+		value  string
+	}{
+		{BasicAuth{Username: "admin", Password: "secret"}, "Authorization", "Basic YWRtaW46c2VjcmV0"},
+		{BearerToken("t0ken"), "Authorization", "Bearer t0ken"},
+		{HeaderAuth{"X-Api-Key": {"abc"}}, "X-Api-Key", "abc"},
+		{AuthenticatorFunc(func(req *http.Request) error {
+			req.Header.Set("X-Signed", "yes")
+			return nil
+		}), "X-Signed", "yes"},
+	}
+	for x, c := range cases {
+		RegisterClient(axle.address(), &Client{Auth: c.auth})
+		if err := Ping(axle.address()); err != nil {
+			t.Fatalf("Case %d: unable to ping: %v", x, err)
+		}
+		axle.mu.Lock()
+		req := axle.requests[len(axle.requests)-1]
+		axle.mu.Unlock()
+		if got := req.Header.Get(c.header); got != c.value {
+			t.Errorf("Case %d: expected %s %q, got %q", x, c.header, c.value, got)
+		}
+		if req.Header.Get("Content-type") != "application/json" {
+			t.Errorf("Case %d: content type lost", x)
+		}
+	}
+	UnregisterClient(axle.address())
+
+	RegisterClient(axle.address(), &Client{Auth: BearerToken("")})
+	defer UnregisterClient(axle.address())
+	if err := Ping(axle.address()); err == nil {
+		t.Errorf("Ping succeeded with a failing authenticator")
+	}
+}
+
+// writeCertificate creates a self signed certificate, writing it and its key
+// to dir as name.pem and name-key.pem.
+func writeCertificate(t *testing.T, dir string, name string, usage x509.ExtKeyUsage) (certFile string, keyFile string, certificate *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{usage},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Unable to create certificate: %v", err)
+	}
+	certificate, _ = x509.ParseCertificate(der)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Unable to marshal key: %v", err)
+	}
+
+	certFile = filepath.Join(dir, name+".pem")
+	keyFile = filepath.Join(dir, name+"-key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return certFile, keyFile, certificate
+}
+
+func TestClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	serverCert, serverKey, _ := writeCertificate(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey, clientCertificate := writeCertificate(t, dir, "client", x509.ExtKeyUsageClientAuth)
+
+	clientPool := x509.NewCertPool()
+	clientPool.AddCert(clientCertificate)
+	serverPair, err := tls.LoadX509KeyPair(serverCert, serverKey)
+	if err != nil {
+		t.Fatalf("Unable to load server certificate: %v", err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "pong")
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverPair},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientPool,
+	}
+	server.StartTLS()
+	defer server.Close()
+	axleAddress := server.URL + "/"
+
+	config, err := ClientCertificate(clientCert, clientKey, serverCert)
+	if err != nil {
+		t.Fatalf("Unable to load client certificate: %v", err)
+	}
+	RegisterClient(axleAddress, &Client{TLSConfig: config})
+	defer UnregisterClient(axleAddress)
+	if err := Ping(axleAddress); err != nil {
+		t.Fatalf("Unable to ping with a client certificate: %v", err)
+	}
+
+	// without the certificate the handshake fails
+	RegisterClient(axleAddress, &Client{TLSConfig: &tls.Config{RootCAs: config.RootCAs}})
+	if err := Ping(axleAddress); err == nil {
+		t.Fatalf("Ping succeeded without a client certificate")
+	}
+
+	if _, err := ClientCertificate(clientCert, clientKey, filepath.Join(dir, "missing.pem")); err == nil {
+		t.Fatalf("Loaded a missing CA file")
+	}
+}
+
+/* ex: set noexpandtab: */
@@ -2,14 +2,11 @@
 package goaxle
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
+	"math"
 	"strconv"
 	"time"
-	"strings"
 )
 
 // API protocol type.
@@ -45,33 +42,19 @@ const (
 
 func Info(axleAddress string) (info map[string]interface{}, err error) {
 	reqAddress := fmt.Sprintf("%s%sinfo", axleAddress, VERSION_ENDPOINT)
-	body, err := doHttpRequest("GET", reqAddress, nil)
+	info, err = doResultsRequest[map[string]interface{}]("GET", reqAddress, nil)
 	if err != nil {
 		return nil, fmt.Errorf("Unable to get Axle info: %s", err)
 	}
-	out := make(map[string]interface{})
-	err = json.Unmarshal(body, &out)
-	if err != nil {
-		return nil, fmt.Errorf("Unable to get unmarshal info: %s", err)
+	if info == nil {
+		return nil, fmt.Errorf("Unable to get axle info, results was not a map")
 	}
-	if resp, exists := out["results"]; exists {
-		// cast it on
-		info, isValidCast := resp.(map[string]interface{})
-		if !isValidCast {
-			return nil, fmt.Errorf("Unable to get axle info, results was not a map")
-		}
-		return info, nil
-	}
-	return nil, fmt.Errorf("Unable to get axle info, missing results in response")
+	return info, nil
 }
 
 func Ping(axleAddress string) (err error) {
 	reqAddress := fmt.Sprintf("%s%sping", axleAddress, VERSION_ENDPOINT)
-	resp, err := http.Get(reqAddress)
-	if err != nil {
-		return fmt.Errorf("Unable to ping server at %v: %v", axleAddress, err)
-	}
-	body, err := ioutil.ReadAll(resp.Body)
+	body, err := doHttpRequest("GET", reqAddress, nil)
 	if err != nil {
 		return fmt.Errorf("Unable to ping server at %v: %v", axleAddress, err)
 	}
@@ -85,74 +68,23 @@ func Ping(axleAddress string) (err error) {
 	return nil
 }
 
-// doHttpRequest performs verb on reqAddress, optionally posting postData.
+// doHttpRequest performs verb on reqAddress, optionally posting postData,
+// using the Client registered for the address.
 // It returns the full page contents as a slice, and / or an error object
 // describing any issues encountered.
 func doHttpRequest(verb string, reqAddress string, postData []byte) (body []byte, err error) {
-
-	buf := bytes.NewBuffer(make([]byte, 0))
-	var req *http.Request = nil
-	if postData != nil {
-		buf = bytes.NewBuffer(postData)
-	}
-	req, err = http.NewRequest(verb, reqAddress, buf)
-	if err != nil {
-		return nil, fmt.Errorf(
-			"Unable to prepare %s - %s: %s",
-			verb,
-			reqAddress,
-			err.Error(),
-		)
-	}
-	path := strings.TrimPrefix(req.URL.Scheme, reqAddress)
-	path = strings.Split(reqAddress, "?")[0]
-	req.URL.Opaque = path
-
-	req.Header = map[string][]string{
-		"Content-type": {"application/json"},
-	}
-	client := new(http.Client)
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf(
-			"Unable to %s api at %s: %s",
-			verb,
-			reqAddress,
-			err.Error(),
-		)
-	}
-	defer resp.Body.Close()
-
-	body, err = ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf(
-			"Unable to read response from %s: %s",
-			verb,
-			err.Error(),
-		)
-	}
-
-	if resp.StatusCode != 200 {
-		return body, fmt.Errorf(
-			"Unable to %s api at %s, server returned status \"%s\" (%s)",
-			verb,
-			reqAddress,
-			resp.Status,
-			string(body),
-		)
-	}
-
-	return body, nil
+	return clientFor(reqAddress).do(verb, reqAddress, postData)
 }
 
 // parseFloatToTime is a utility function to convert a Javascript number
 // respresentation of a date to a Go time.
 func parseFloatToTime(theTime float64) time.Time {
-	// this.CreatedAt is a float representing number of milliseconds since epoch
-	seconds := int64(theTime / 1000)
-	milliSeconds := int64(theTime) % 1000
-	nanoSeconds := milliSeconds * 1000 * 1000
-	return time.Unix(seconds, nanoSeconds)
+	// theTime is a float representing number of milliseconds since epoch,
+	// possibly with a fractional part.  A float64 holds present day times
+	// to within a microsecond, so round to that.
+	seconds := math.Floor(theTime / 1000)
+	microSeconds := math.Round((theTime - seconds*1000) * 1000)
+	return time.Unix(int64(seconds), int64(microSeconds)*1000)
 }
 
 func doStatsRequest(reqAddress string) (stats map[HitType]map[time.Time]map[int]int, err error) {
@@ -160,52 +92,39 @@ func doStatsRequest(reqAddress string) (stats map[HitType]map[time.Time]map[int]
 	if err != nil {
 		return nil, err
 	}
-
-	responseMap := make(map[string]interface{})
-	err = json.Unmarshal(body, &responseMap)
+	stats, err = decodeStats(body)
 	if err != nil {
-		return nil, fmt.Errorf(
-			"Unable to unmarshal response from %s: %s",
-			reqAddress,
-			err.Error(),
-		)
+		return nil, fmt.Errorf("Bad response from %s: %s", reqAddress, err.Error())
 	}
+	return stats, nil
+}
 
-	resultsInterface, exists := responseMap["results"]
-	if !exists {
-		return nil, fmt.Errorf("Missing results from %s", reqAddress)
-	}
-	results, validCast := resultsInterface.(map[string]interface{})
-	if !validCast {
-		return nil, fmt.Errorf("Missing stat details from %s", reqAddress)
+// decodeStats converts a stats response, keyed by hit type, timestamp and
+// response code, into Go types.
+func decodeStats(body []byte) (stats map[HitType]map[time.Time]map[int]int, err error) {
+	envelope, err := DecodeEnvelope[map[HitType]map[string]map[string]int](body)
+	if err != nil {
+		return nil, err
 	}
 
-	stats = make(map[HitType]map[time.Time]map[int]int)
-	for hitType, value := range results {
-		if _, exists := stats[HitType(hitType)]; !exists {
-			stats[HitType(hitType)] = make(map[time.Time]map[int]int)
-		}
-		statsInterface, goodCast := value.(map[string]interface{})
-		if !goodCast {
-			return nil, fmt.Errorf("Bad stats object at %s", reqAddress)
-		}
-		for timeStampStr, value := range statsInterface {
-			timeStamp, _ := strconv.Atoi(timeStampStr)
-			timeGroup := time.Unix(int64(timeStamp), 0)
-			if _, exists := stats[HitType(hitType)][timeGroup]; !exists {
-				stats[HitType(hitType)][timeGroup] = make(map[int]int)
+	stats = make(map[HitType]map[time.Time]map[int]int, len(envelope.Results))
+	for hitType, timeGroups := range envelope.Results {
+		stats[hitType] = make(map[time.Time]map[int]int, len(timeGroups))
+		for timeStampStr, responseCodes := range timeGroups {
+			timeStamp, err := strconv.ParseInt(timeStampStr, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Bad timestamp %q in stats", timeStampStr)
 			}
-			statsInterface, goodCast := value.(map[string]interface{})
-			if !goodCast {
-				return nil, fmt.Errorf("Bad stats object at %s", reqAddress)
+			timeGroup := time.Unix(timeStamp, 0)
+			if _, exists := stats[hitType][timeGroup]; !exists {
+				stats[hitType][timeGroup] = make(map[int]int, len(responseCodes))
 			}
-			for responseCodeStr, countInterface := range statsInterface {
-				responseCode, _ := strconv.Atoi(responseCodeStr)
-				countFloat, goodCast := countInterface.(float64)
-				if !goodCast {
-					return nil, fmt.Errorf("Bad stats object at %s", reqAddress)
+			for responseCodeStr, count := range responseCodes {
+				responseCode, err := strconv.Atoi(responseCodeStr)
+				if err != nil {
+					return nil, fmt.Errorf("Bad response code %q in stats", responseCodeStr)
 				}
-				stats[HitType(hitType)][timeGroup][responseCode] = int(countFloat)
+				stats[hitType][timeGroup][responseCode] += count
 			}
 		}
 	}
@@ -214,122 +133,38 @@ func doStatsRequest(reqAddress string) (stats map[HitType]map[time.Time]map[int]
 }
 
 func doChartsRequest(reqAddress string) (out map[string]int, err error) {
-
-	body, err := doHttpRequest("GET", reqAddress, nil)
+	out, err = doResultsRequest[map[string]int]("GET", reqAddress, nil)
 	if err != nil {
 		return nil, err
 	}
-
-	responseMap := make(map[string]interface{})
-	err = json.Unmarshal(body, &responseMap)
-	if err != nil {
-		return nil, fmt.Errorf(
-			"Unable to unmarshal response from %s: %s",
-			reqAddress,
-			err.Error(),
-		)
-	}
-
-	resultsInterface, exists := responseMap["results"]
-	if !exists {
-		return nil, fmt.Errorf("Missing results from %s", reqAddress)
-	}
-	results, isValidCast := resultsInterface.(map[string]interface{})
-	if !isValidCast {
+	if out == nil {
 		return nil, fmt.Errorf("Unable to cast to map from %s", reqAddress)
 	}
-	out = make(map[string]int, len(results))
-	for key, count := range results {
-		out[key] = int(count.(float64))
-	}
-
 	return out, nil
 }
 
 func doKeysRequest(reqAddress string, axleAddress string) (keys []*Key, err error) {
-
-	body, err := doHttpRequest("GET", reqAddress, nil)
+	results, err := doResultsRequest[map[string]json.RawMessage]("GET", reqAddress, nil)
 	if err != nil {
 		return nil, err
 	}
-
-	responseMap := make(map[string]interface{})
-	err = json.Unmarshal(body, &responseMap)
-	if err != nil {
-		return nil, fmt.Errorf(
-			"Unable to unmarshal response from %s: %s",
-			reqAddress,
-			err.Error(),
-		)
-	}
-
-	resultsInterface, exists := responseMap["results"]
-	if !exists {
-		return nil, fmt.Errorf("Missing results from %s", reqAddress)
-	}
-	results, isValidCast := resultsInterface.(map[string]interface{})
-	if !isValidCast {
-		return nil, fmt.Errorf("Unable to cast to list of keys from %s", reqAddress)
-	}
-	keys = make([]*Key, len(results))
-	x := 0
-	for identifier, keyInterface := range results {
+	return decodeListing(KIND_KEY, results, func(identifier string) *Key {
 		key := NewKey(axleAddress, identifier)
-		jsonvalue, err := json.Marshal(keyInterface)
-		if err != nil {
-			return nil, fmt.Errorf("Unable to decode key in response: %s", err)
-		}
-		err = json.Unmarshal(jsonvalue, key)
-		if err != nil {
-			return nil, fmt.Errorf("Unable to decode key in response: %s", err)
-		}
 		key.createOnSave = false
-		keys[x] = key
-		x++
-	}
-
-	return keys, nil
+		return key
+	})
 }
 
 func doApisRequest(reqAddress string, axleAddress string) (out []*Api, err error) {
-	body, err := doHttpRequest("GET", reqAddress, nil)
+	results, err := doResultsRequest[map[string]json.RawMessage]("GET", reqAddress, nil)
 	if err != nil {
 		return nil, err
 	}
-
-	response := make(map[string]interface{})
-	err = json.Unmarshal(body, &response)
-	if err != nil {
-		return nil, fmt.Errorf(
-			"Unable to unmarshal response: %s",
-			err.Error(),
-		)
-	}
-	response, validCast := response["results"].(map[string]interface{})
-	if !validCast {
-		return nil, fmt.Errorf(
-			"Unable to unmarshal response: %s",
-			err.Error(),
-		)
-	}
-	out = make([]*Api, len(response))
-	x := 0
-	for identifier, value := range response {
+	return decodeListing(KIND_API, results, func(identifier string) *Api {
 		api := NewApi(axleAddress, identifier, "")
-		jsonvalue, err := json.Marshal(value)
-		if err != nil {
-			return nil, fmt.Errorf("Unable to decode api in response: %s", err.Error())
-		}
-		err = json.Unmarshal(jsonvalue, api)
-		if err != nil {
-			return nil, fmt.Errorf("Unable to decode api in response: %s", err.Error())
-		}
 		api.createOnSave = false
-		out[x] = api
-		x++
-	}
-
-	return out, nil
+		return api
+	})
 }
 
 /* ex: set noexpandtab: */
@@ -1,8 +1,11 @@
 package goaxle
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
-	//"fmt"
 )
 
 const (
@@ -74,4 +77,65 @@ func testInfo(t *testing.T) {
 	}
 }
 
+// testAxle is a canned stand-in for an ApiAxle server, used by tests which
+// don't need the real thing.
+type testAxle struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	responses map[string]string
+	requests  []*http.Request
+}
+
+// newTestAxle starts a testAxle answering each "VERB /path" in responses with
+// the given body.  Anything else gets a 404.
+func newTestAxle(t *testing.T, responses map[string]string) *testAxle {
+	axle := &testAxle{responses: make(map[string]string)}
+	for route, body := range responses {
+		axle.responses[route] = body
+	}
+	axle.Server = httptest.NewServer(http.HandlerFunc(axle.serve))
+	t.Cleanup(axle.Close)
+	return axle
+}
+
+func (this *testAxle) serve(w http.ResponseWriter, r *http.Request) {
+	this.mu.Lock()
+	this.requests = append(this.requests, r)
+	body, exists := this.responses[r.Method+" "+r.URL.Path]
+	this.mu.Unlock()
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"meta":{"version":1,"status_code":404},"results":{"error":{"type":"NotFound","message":"%s not found"}}}`, r.URL.Path)
+		return
+	}
+	fmt.Fprint(w, body)
+}
+
+// address returns the axleAddress to hand to the library.
+func (this *testAxle) address() string {
+	return this.URL + "/"
+}
+
+// set replaces the response for route.
+func (this *testAxle) set(route string, body string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.responses[route] = body
+}
+
+// remove stops answering route.
+func (this *testAxle) remove(route string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	delete(this.responses, route)
+}
+
+// requestCount returns the number of requests received so far.
+func (this *testAxle) requestCount() int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return len(this.requests)
+}
+
 /* ex: set noexpandtab: */
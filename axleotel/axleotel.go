@@ -0,0 +1,141 @@
+// Package axleotel reports goaxle management calls through OpenTelemetry.
+//
+// Every request made through a goaxle.Client configured with this
+// instrumentation is wrapped in a client span and recorded in latency and
+// error metrics.  Without a configured provider the global OpenTelemetry
+// providers are used, which do nothing until an SDK is installed.
+//
+//	instrumentation, err := axleotel.New(axleotel.Options{})
+//	if err != nil {
+//		return err
+//	}
+//	goaxle.DefaultClient.Instrumentation = instrumentation
+package axleotel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	goaxle "github.com/rjohnsondev/go-axle"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name of the instrumentation scope used for the tracer and meter.
+const ScopeName = "github.com/rjohnsondev/go-axle"
+
+// Attribute keys set on spans and metrics.
+const (
+	AttributeOperation    = attribute.Key("goaxle.operation")
+	AttributeResourceType = attribute.Key("goaxle.resource.type")
+	AttributeResourceID   = attribute.Key("goaxle.resource.id")
+	AttributeMethod       = attribute.Key("http.request.method")
+	AttributeStatusCode   = attribute.Key("http.response.status_code")
+	AttributePath         = attribute.Key("url.path")
+)
+
+// Options configures the instrumentation.
+type Options struct {
+	// Defaults to otel.GetTracerProvider().
+	TracerProvider trace.TracerProvider
+
+	// Defaults to otel.GetMeterProvider().
+	MeterProvider metric.MeterProvider
+
+	// Record key identifiers on spans.  They are redacted by default as
+	// they act as credentials for the proxied apis.
+	RecordKeyIdentifiers bool
+}
+
+// Instrumentation implements goaxle.Instrumentation using OpenTelemetry.
+type Instrumentation struct {
+	tracer  trace.Tracer
+	latency metric.Float64Histogram
+	errors  metric.Int64Counter
+
+	recordKeyIdentifiers bool
+}
+
+var _ goaxle.Instrumentation = (*Instrumentation)(nil)
+
+// New creates the tracer and instruments described by options.
+func New(options Options) (out *Instrumentation, err error) {
+	if options.TracerProvider == nil {
+		options.TracerProvider = otel.GetTracerProvider()
+	}
+	if options.MeterProvider == nil {
+		options.MeterProvider = otel.GetMeterProvider()
+	}
+	meter := options.MeterProvider.Meter(ScopeName)
+
+	out = &Instrumentation{
+		tracer:               options.TracerProvider.Tracer(ScopeName),
+		recordKeyIdentifiers: options.RecordKeyIdentifiers,
+	}
+	out.latency, err = meter.Float64Histogram(
+		"goaxle.request.duration",
+		metric.WithDescription("Duration of ApiAxle management requests."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create latency histogram: %s", err)
+	}
+	out.errors, err = meter.Int64Counter(
+		"goaxle.request.errors",
+		metric.WithDescription("Number of ApiAxle management requests which failed."),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create error counter: %s", err)
+	}
+	return out, nil
+}
+
+// StartRequest implements goaxle.Instrumentation.
+func (this *Instrumentation) StartRequest(ctx context.Context, info goaxle.RequestInfo) (context.Context, func(int, error)) {
+	start := time.Now()
+
+	identifier := info.Identifier
+	if info.Resource == "key" && identifier != "" && !this.recordKeyIdentifiers {
+		identifier = "[REDACTED]"
+	}
+	common := []attribute.KeyValue{
+		AttributeOperation.String(info.Operation),
+		AttributeResourceType.String(info.Resource),
+		AttributeMethod.String(info.Verb),
+	}
+
+	ctx, span := this.tracer.Start(
+		ctx,
+		info.Operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(common...),
+		trace.WithAttributes(
+			AttributeResourceID.String(identifier),
+			AttributePath.String(info.Path),
+		),
+	)
+
+	return ctx, func(status int, err error) {
+		defer span.End()
+
+		attributes := append(common, AttributeStatusCode.Int(status))
+		span.SetAttributes(AttributeStatusCode.Int(status))
+		if err != nil {
+			if !this.recordKeyIdentifiers {
+				err = errors.New(goaxle.Redact(err.Error()))
+			}
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			this.errors.Add(ctx, 1, metric.WithAttributes(attributes...))
+		}
+		this.latency.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attributes...))
+	}
+}
+
+/* ex: set noexpandtab: */
@@ -0,0 +1,131 @@
+package axleotel
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	goaxle "github.com/rjohnsondev/go-axle"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestInstrumentation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/api/weather/linkkey/secretkey" {
+			fmt.Fprint(w, `{"meta":{"version":1,"status_code":200},"results":{"qps":2,"qpd":10}}`)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"meta":{"version":1,"status_code":404},"results":{"error":{"message":"not found"}}}`)
+	}))
+	defer server.Close()
+	axleAddress := server.URL + "/"
+
+	exporter := tracetest.NewInMemoryExporter()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	reader := sdkmetric.NewManualReader()
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	instrumentation, err := New(Options{
+		TracerProvider: tracerProvider,
+		MeterProvider:  meterProvider,
+	})
+	if err != nil {
+		t.Fatalf("Unable to create instrumentation: %v", err)
+	}
+	goaxle.RegisterClient(axleAddress, &goaxle.Client{Instrumentation: instrumentation})
+	defer goaxle.UnregisterClient(axleAddress)
+
+	if _, err := goaxle.ApiLinkKey(axleAddress, "weather", "secretkey"); err != nil {
+		t.Fatalf("Unable to link key: %v", err)
+	}
+	if _, err := goaxle.KeyRingStats(axleAddress, "partners", time.Now(), time.Now(), "", "", goaxle.GRANULARITY_DAYS); err == nil {
+		t.Fatalf("Stats succeeded against a missing keyring")
+	}
+
+	spans := exporter.GetSpans().Snapshots()
+	if len(spans) != 2 {
+		t.Fatalf("Expected two spans, got %d", len(spans))
+	}
+
+	linked := spans[0]
+	if linked.Name() != "ApiLinkKey" {
+		t.Errorf("Unexpected span name %q", linked.Name())
+	}
+	if spanAttribute(linked, AttributeResourceType).AsString() != "api" ||
+		spanAttribute(linked, AttributeResourceID).AsString() != "weather" ||
+		spanAttribute(linked, AttributeStatusCode).AsInt64() != 200 {
+		t.Errorf("Unexpected attributes: %v", linked.Attributes())
+	}
+	if path := spanAttribute(linked, AttributePath).AsString(); path != "/v1/api/weather/linkkey/[REDACTED]" {
+		t.Errorf("Key identifier not redacted from path: %q", path)
+	}
+
+	failed := spans[1]
+	if failed.Name() != "KeyRingStats" || failed.Status().Code != codes.Error {
+		t.Errorf("Unexpected failed span: %v %v", failed.Name(), failed.Status())
+	}
+	if spanAttribute(failed, AttributeStatusCode).AsInt64() != 404 {
+		t.Errorf("Status code not recorded on failure: %v", failed.Attributes())
+	}
+
+	var metrics metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &metrics); err != nil {
+		t.Fatalf("Unable to collect metrics: %v", err)
+	}
+	found := make(map[string]metricdata.Aggregation)
+	for _, scope := range metrics.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			found[m.Name] = m.Data
+		}
+	}
+	latency, ok := found["goaxle.request.duration"].(metricdata.Histogram[float64])
+	if !ok || len(latency.DataPoints) != 2 {
+		t.Errorf("Unexpected latency metric: %+v", found["goaxle.request.duration"])
+	}
+	errors, ok := found["goaxle.request.errors"].(metricdata.Sum[int64])
+	if !ok || len(errors.DataPoints) != 1 || errors.DataPoints[0].Value != 1 {
+		t.Errorf("Unexpected error metric: %+v", found["goaxle.request.errors"])
+	}
+}
+
+func TestKeyIdentifiersRedacted(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	instrumentation, err := New(Options{
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)),
+	})
+	if err != nil {
+		t.Fatalf("Unable to create instrumentation: %v", err)
+	}
+	_, finish := instrumentation.StartRequest(context.Background(), goaxle.RequestInfo{
+		Verb:       "GET",
+		Operation:  "GetKey",
+		Resource:   "key",
+		Identifier: "secretkey",
+	})
+	finish(200, nil)
+
+	spans := exporter.GetSpans().Snapshots()
+	if id := spanAttribute(spans[0], AttributeResourceID).AsString(); id != "[REDACTED]" {
+		t.Errorf("Key identifier recorded: %q", id)
+	}
+}
+
+/* ex: set noexpandtab: */
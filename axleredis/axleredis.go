@@ -0,0 +1,543 @@
+// Package axleredis reads ApiAxle's configuration and stats straight out of
+// its Redis database, which is much faster than paging through the
+// management api for large deployments.
+//
+// The Reader is read-only and implements server.Storage, so it can also back
+// a goaxle management server in front of an existing ApiAxle deployment:
+//
+//	reader, err := axleredis.Dial(axleredis.Options{
+//		Address: "localhost:6379",
+//		Layout:  axleredis.DefaultLayout("production"),
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	defer reader.Close()
+//	keys, err := reader.Keys()
+package axleredis
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	goaxle "github.com/rjohnsondev/go-axle"
+	"github.com/rjohnsondev/go-axle/server"
+)
+
+// PIPELINE_SIZE is the most commands sent to Redis in one round trip.
+const PIPELINE_SIZE = 1000
+
+// ErrReadOnly is returned by every method of Reader which would write.
+var ErrReadOnly = errors.New("The ApiAxle redis reader is read-only")
+
+// Layout describes where ApiAxle keeps things in Redis.  Each template is
+// relative to Prefix and may contain these placeholders:
+//
+//	{kind}         "api", "key" or "keyring"
+//	{id}           the identifier of the resource
+//	{forKind}      the kind of resource stats are narrowed to
+//	{forId}        the identifier stats are narrowed to
+//	{hitType}      "cached", "uncached" or "error"
+//	{granularity}  "second", "minute", "hour" or "day"
+//	{bucket}       unix time of the start of the stats bucket
+//
+// Collections may be lists, sets or sorted sets.
+type Layout struct {
+	// Prepended to every key, "gk:<env>:" for ApiAxle.
+	Prefix string
+
+	// Hash holding the fields of a resource.
+	Resource string
+
+	// Collection of the identifiers of every resource of a kind.
+	Index string
+
+	// Collection of the keys linked with an api or keyring.
+	LinkedKeys string
+
+	// Collection of the apis a key is linked with.
+	KeyApis string
+
+	// Hash of status to count for a resource.
+	Stats string
+
+	// Hash of status to count for a resource narrowed to hits involving
+	// another resource, such as an api's hits by one key.
+	StatsFor string
+}
+
+// DefaultLayout returns the layout ApiAxle 1.x uses for environment env,
+// such as "production" or "development".  Its models keep each resource in
+// a hash named after its kind, index every kind in a "meta:all" list and
+// name stats narrowed to another resource after both kinds, as in
+// "api-key".  Check the key names against your database with redis-cli and
+// override any templates which differ.
+func DefaultLayout(env string) Layout {
+	return Layout{
+		Prefix:     "gk:" + env + ":",
+		Resource:   "{kind}:{id}",
+		Index:      "{kind}:meta:all",
+		LinkedKeys: "{kind}:{id}:keys",
+		KeyApis:    "key:{id}:apis",
+		Stats:      "stats:{kind}:{id}:{hitType}:{granularity}:{bucket}",
+		StatsFor:   "stats:{kind}-{forKind}:{id}:{forId}:{hitType}:{granularity}:{bucket}",
+	}
+}
+
+// key expands template with the placeholder, value pairs in replacements.
+func (this Layout) key(template string, replacements ...string) string {
+	pairs := make([]string, 0, len(replacements))
+	for x := 0; x+1 < len(replacements); x += 2 {
+		pairs = append(pairs, "{"+replacements[x]+"}", replacements[x+1])
+	}
+	return this.Prefix + strings.NewReplacer(pairs...).Replace(template)
+}
+
+// Options configures a Reader.
+type Options struct {
+	// host:port of the Redis server.
+	Address string
+
+	// Sent with AUTH if set.
+	Password string
+
+	// Database number, selected if not 0.
+	DB int
+
+	// Where ApiAxle keeps things.  Defaults to DefaultLayout("production").
+	Layout Layout
+
+	// Timeout for connecting and for each round trip.  Defaults to 10
+	// seconds.
+	Timeout time.Duration
+}
+
+// Reader reads ApiAxle's Redis database.  It is safe for concurrent use,
+// though requests are sent over a single connection one at a time.  The
+// connection is dialled again after a network error.
+type Reader struct {
+	conn   *conn
+	layout Layout
+	// the current time, which retention is measured back from
+	now func() time.Time
+}
+
+// Dial connects to Redis.
+func Dial(options Options) (out *Reader, err error) {
+	if options.Layout == (Layout{}) {
+		options.Layout = DefaultLayout("production")
+	}
+	if options.Timeout == 0 {
+		options.Timeout = 10 * time.Second
+	}
+	// resent whenever the connection is dialled again
+	setup := [][]string{{"PING"}}
+	if options.Password != "" {
+		setup = append(setup, []string{"AUTH", options.Password})
+	}
+	if options.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(options.DB)})
+	}
+	conn, err := dial(options.Address, options.Timeout, setup...)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{conn: conn, layout: options.Layout, now: time.Now}, nil
+}
+
+// Close closes the connection.
+func (this *Reader) Close() error {
+	return this.conn.close()
+}
+
+// pipeline sends commands PIPELINE_SIZE at a time.
+func (this *Reader) pipeline(commands [][]string) (replies []interface{}, err error) {
+	replies = make([]interface{}, 0, len(commands))
+	for start := 0; start < len(commands); start += PIPELINE_SIZE {
+		end := min(start+PIPELINE_SIZE, len(commands))
+		batch, err := this.conn.do(commands[start:end]...)
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, batch...)
+	}
+	return replies, nil
+}
+
+// stream sends the count commands made by command PIPELINE_SIZE at a time,
+// passing each reply to reply as it arrives rather than holding them all.
+func (this *Reader) stream(count int, command func(x int) []string, reply func(x int, reply interface{}) error) (err error) {
+	for start := 0; start < count; start += PIPELINE_SIZE {
+		end := min(start+PIPELINE_SIZE, count)
+		commands := make([][]string, 0, end-start)
+		for x := start; x < end; x++ {
+			commands = append(commands, command(x))
+		}
+		batch, err := this.conn.do(commands...)
+		if err != nil {
+			return err
+		}
+		for x, value := range batch {
+			if err = reply(start+x, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// members returns the sorted members of each collection in keys, whatever
+// type of collection it is.  Missing collections are empty.
+func (this *Reader) members(keys []string) (out [][]string, err error) {
+	commands := make([][]string, len(keys))
+	for x, key := range keys {
+		commands[x] = []string{"TYPE", key}
+	}
+	types, err := this.pipeline(commands)
+	if err != nil {
+		return nil, err
+	}
+	// only read the collections which exist
+	out = make([][]string, len(keys))
+	var reads [][]string
+	var readIndexes []int
+	for x, key := range keys {
+		out[x] = []string{}
+		switch types[x] {
+		case "list":
+			reads = append(reads, []string{"LRANGE", key, "0", "-1"})
+		case "set":
+			reads = append(reads, []string{"SMEMBERS", key})
+		case "zset":
+			reads = append(reads, []string{"ZRANGE", key, "0", "-1"})
+		case "none":
+			continue
+		default:
+			return nil, fmt.Errorf("Unable to read %s, it is a %v", key, types[x])
+		}
+		readIndexes = append(readIndexes, x)
+	}
+	replies, err := this.pipeline(reads)
+	if err != nil {
+		return nil, err
+	}
+	for y, reply := range replies {
+		x := readIndexes[y]
+		if out[x], err = replyStrings(reply); err != nil {
+			return nil, fmt.Errorf("Unable to read %s: %s", keys[x], err)
+		}
+		sort.Strings(out[x])
+	}
+	return out, nil
+}
+
+// resources loads the identified resources of kind, skipping any which no
+// longer exist.
+func (this *Reader) resources(kind goaxle.Kind, identifiers []string) (out map[string]goaxle.Resource, err error) {
+	commands := make([][]string, len(identifiers))
+	for x, identifier := range identifiers {
+		commands[x] = []string{"HGETALL", this.layout.key(this.layout.Resource, "kind", string(kind), "id", identifier)}
+	}
+	replies, err := this.pipeline(commands)
+	if err != nil {
+		return nil, err
+	}
+	out = make(map[string]goaxle.Resource, len(identifiers))
+	for x, identifier := range identifiers {
+		fields, err := replyHash(replies[x])
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read %s %s: %s", kind, identifier, err)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		if out[identifier], err = decodeHash(kind, identifier, fields); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// decodeHash builds a resource from the hash ApiAxle stores it in.  Redis
+// only holds strings, so each value is tried as JSON first, then as a
+// string.
+func decodeHash(kind goaxle.Kind, identifier string, fields map[string]string) (resource goaxle.Resource, err error) {
+	resource, err = server.NewResource(kind, identifier)
+	if err != nil {
+		return nil, err
+	}
+	for field, value := range fields {
+		name, _ := json.Marshal(field)
+		quoted, _ := json.Marshal(value)
+		if json.Unmarshal([]byte(`{`+string(name)+`:`+value+`}`), resource) == nil {
+			continue
+		}
+		if err = json.Unmarshal([]byte(`{`+string(name)+`:`+string(quoted)+`}`), resource); err != nil {
+			return nil, fmt.Errorf("Unable to decode %s of %s %s: %s", field, kind, identifier, err)
+		}
+	}
+	return resource, nil
+}
+
+// All loads every resource of kind, keyed by identifier.
+func (this *Reader) All(kind goaxle.Kind) (out map[string]goaxle.Resource, err error) {
+	identifiers, err := this.List(kind)
+	if err != nil {
+		return nil, err
+	}
+	return this.resources(kind, identifiers)
+}
+
+// Apis loads every api.
+func (this *Reader) Apis() (out map[string]*goaxle.Api, err error) {
+	return all[goaxle.Api](this, goaxle.KIND_API)
+}
+
+// Keys loads every key.
+func (this *Reader) Keys() (out map[string]*goaxle.Key, err error) {
+	return all[goaxle.Key](this, goaxle.KIND_KEY)
+}
+
+// KeyRings loads every keyring.
+func (this *Reader) KeyRings() (out map[string]*goaxle.KeyRing, err error) {
+	return all[goaxle.KeyRing](this, goaxle.KIND_KEYRING)
+}
+
+func all[T any](this *Reader, kind goaxle.Kind) (out map[string]*T, err error) {
+	resources, err := this.All(kind)
+	if err != nil {
+		return nil, err
+	}
+	out = make(map[string]*T, len(resources))
+	for identifier, resource := range resources {
+		out[identifier] = any(resource).(*T)
+	}
+	return out, nil
+}
+
+// Snapshot loads every api, key and keyring along with their links.  The
+// objects can't be saved, as they aren't associated with a management
+// server.
+func (this *Reader) Snapshot() (snapshot *goaxle.Snapshot, err error) {
+	snapshot = &goaxle.Snapshot{}
+	if snapshot.Apis, err = this.Apis(); err != nil {
+		return nil, err
+	}
+	if snapshot.Keys, err = this.Keys(); err != nil {
+		return nil, err
+	}
+	if snapshot.KeyRings, err = this.KeyRings(); err != nil {
+		return nil, err
+	}
+	if snapshot.ApiKeys, err = linkedAll(this, goaxle.KIND_API, snapshot.Apis); err != nil {
+		return nil, err
+	}
+	if snapshot.KeyApis, err = linkedAll(this, goaxle.KIND_KEY, snapshot.Keys); err != nil {
+		return nil, err
+	}
+	if snapshot.KeyRingKeys, err = linkedAll(this, goaxle.KIND_KEYRING, snapshot.KeyRings); err != nil {
+		return nil, err
+	}
+	snapshot.LoadedAt = time.Now()
+	return snapshot, nil
+}
+
+// linkedAll returns the links of every resource in resources.
+func linkedAll[V any](this *Reader, kind goaxle.Kind, resources map[string]V) (out map[string][]string, err error) {
+	identifiers := make([]string, 0, len(resources))
+	keys := make([]string, 0, len(resources))
+	for identifier := range resources {
+		identifiers = append(identifiers, identifier)
+		keys = append(keys, this.linkedKey(kind, identifier))
+	}
+	members, err := this.members(keys)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load %s links: %s", kind, err)
+	}
+	out = make(map[string][]string, len(identifiers))
+	for x, identifier := range identifiers {
+		out[identifier] = members[x]
+	}
+	return out, nil
+}
+
+// linkedKey returns the collection holding the links of a resource.
+func (this *Reader) linkedKey(kind goaxle.Kind, identifier string) string {
+	if kind == goaxle.KIND_KEY {
+		return this.layout.key(this.layout.KeyApis, "id", identifier)
+	}
+	return this.layout.key(this.layout.LinkedKeys, "kind", string(kind), "id", identifier)
+}
+
+// Stats reads the stats of target, as goaxle.StatsTarget.Stats would from
+// the management api.
+func (this *Reader) Stats(target goaxle.StatsTarget, from time.Time, to time.Time, granularity goaxle.Granularity) (stats map[goaxle.HitType]map[time.Time]map[int]int, err error) {
+	var forKind goaxle.Kind
+	var forId string
+	switch {
+	case target.Kind != goaxle.KIND_KEY && target.ForKey != "":
+		forKind, forId = goaxle.KIND_KEY, target.ForKey
+	case target.Kind != goaxle.KIND_API && target.ForApi != "":
+		forKind, forId = goaxle.KIND_API, target.ForApi
+	}
+	counts, err := this.counts(target.Kind, target.Identifier, forKind, forId, granularity, from, to)
+	if err != nil {
+		return nil, err
+	}
+	stats = make(map[goaxle.HitType]map[time.Time]map[int]int)
+	for hitType, buckets := range counts {
+		stats[hitType] = make(map[time.Time]map[int]int, len(buckets))
+		for bucket, statuses := range buckets {
+			stats[hitType][time.Unix(bucket, 0)] = statuses
+		}
+	}
+	return stats, nil
+}
+
+// counts reads the counters of a resource, narrowed to hits involving
+// forId if set.
+func (this *Reader) counts(kind goaxle.Kind, identifier string, forKind goaxle.Kind, forId string, granularity goaxle.Granularity, from time.Time, to time.Time) (out server.Counts, err error) {
+	step, err := server.Step(granularity)
+	if err != nil {
+		return nil, err
+	}
+	// buckets outside retention have expired, so aren't asked for
+	now := this.now()
+	first, _ := server.Bucket(granularity, from)
+	if oldest, limited := server.Oldest(granularity, now); limited && oldest > first {
+		first = oldest
+	}
+	last, _ := server.Bucket(granularity, to)
+	if newest, _ := server.Bucket(granularity, now); newest < last {
+		last = newest
+	}
+	if last < first {
+		return make(server.Counts), nil
+	}
+
+	template := this.layout.Stats
+	if forId != "" {
+		template = this.layout.StatsFor
+	}
+	hitTypes := len(server.HIT_TYPES)
+	counter := func(x int) (hitType goaxle.HitType, bucket int64) {
+		return server.HIT_TYPES[x%hitTypes], first + int64(x/hitTypes)*step
+	}
+	key := func(x int) string {
+		hitType, bucket := counter(x)
+		return this.layout.key(template,
+			"kind", string(kind), "id", identifier,
+			"forKind", string(forKind), "forId", forId,
+			"hitType", string(hitType), "granularity", string(granularity),
+			"bucket", strconv.FormatInt(bucket, 10))
+	}
+
+	out = make(server.Counts)
+	count := int((last-first)/step+1) * hitTypes
+	err = this.stream(count, func(x int) []string {
+		return []string{"HGETALL", key(x)}
+	}, func(x int, reply interface{}) error {
+		statuses, err := replyHash(reply)
+		if err != nil {
+			return fmt.Errorf("Unable to read %s: %s", key(x), err)
+		}
+		hitType, bucket := counter(x)
+		for status, value := range statuses {
+			code, err := strconv.Atoi(status)
+			if err != nil {
+				return fmt.Errorf("Unable to read %s: bad status %q", key(x), status)
+			}
+			count, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("Unable to read %s: bad count %q", key(x), value)
+			}
+			out.Add(hitType, bucket, code, count)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read stats: %s", err)
+	}
+	return out, nil
+}
+
+func (this *Reader) Get(kind goaxle.Kind, identifier string) (resource goaxle.Resource, err error) {
+	resources, err := this.resources(kind, []string{identifier})
+	if err != nil {
+		return nil, err
+	}
+	resource, exists := resources[identifier]
+	if !exists {
+		return nil, server.NotFound(kind, identifier)
+	}
+	return resource, nil
+}
+
+func (this *Reader) List(kind goaxle.Kind) (identifiers []string, err error) {
+	if _, err = server.NewResource(kind, ""); err != nil {
+		return nil, err
+	}
+	members, err := this.members([]string{this.layout.key(this.layout.Index, "kind", string(kind))})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list %ss: %s", kind, err)
+	}
+	return members[0], nil
+}
+
+func (this *Reader) Linked(kind goaxle.Kind, identifier string) (out []string, err error) {
+	replies, err := this.conn.do([]string{"EXISTS", this.layout.key(this.layout.Resource, "kind", string(kind), "id", identifier)})
+	if err != nil {
+		return nil, err
+	}
+	if replies[0] != int64(1) {
+		return nil, server.NotFound(kind, identifier)
+	}
+	members, err := this.members([]string{this.linkedKey(kind, identifier)})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list links of %s %s: %s", kind, identifier, err)
+	}
+	return members[0], nil
+}
+
+func (this *Reader) Counts(query server.CountQuery) (out server.Counts, err error) {
+	switch {
+	case query.Api != "" && query.Key != "":
+		return this.counts(goaxle.KIND_API, query.Api, goaxle.KIND_KEY, query.Key, query.Granularity, query.From, query.To)
+	case query.Api != "":
+		return this.counts(goaxle.KIND_API, query.Api, "", "", query.Granularity, query.From, query.To)
+	case query.Key != "":
+		return this.counts(goaxle.KIND_KEY, query.Key, "", "", query.Granularity, query.From, query.To)
+	}
+	return nil, fmt.Errorf("Unable to count hits without an api or key")
+}
+
+func (this *Reader) Create(resource goaxle.Resource) error {
+	return ErrReadOnly
+}
+
+func (this *Reader) Update(resource goaxle.Resource) error {
+	return ErrReadOnly
+}
+
+func (this *Reader) Delete(kind goaxle.Kind, identifier string) error {
+	return ErrReadOnly
+}
+
+func (this *Reader) Link(kind goaxle.Kind, owner string, key string) error {
+	return ErrReadOnly
+}
+
+func (this *Reader) Unlink(kind goaxle.Kind, owner string, key string) error {
+	return ErrReadOnly
+}
+
+func (this *Reader) RecordHit(hit server.Hit) error {
+	return ErrReadOnly
+}
+
+/* ex: set noexpandtab: */
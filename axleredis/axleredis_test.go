@@ -0,0 +1,364 @@
+package axleredis
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	goaxle "github.com/rjohnsondev/go-axle"
+	"github.com/rjohnsondev/go-axle/server"
+)
+
+// fakeRedis is an in-process stand in for Redis, answering the commands a
+// Reader sends from fixed data.  Values are map[string]string for hashes,
+// []string for lists and map[string]bool for sets.
+type fakeRedis struct {
+	listener net.Listener
+	data     map[string]interface{}
+
+	mu       sync.Mutex
+	commands []string
+	reads    int
+
+	// If set, the next command gets no reply and its connection is closed.
+	hangUp bool
+}
+
+func newFakeRedis(t *testing.T, data map[string]interface{}) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	fake := &fakeRedis{listener: listener, data: data}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			netConn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go fake.serve(netConn)
+		}
+	}()
+	return fake
+}
+
+func (this *fakeRedis) address() string {
+	return this.listener.Addr().String()
+}
+
+func (this *fakeRedis) serve(netConn net.Conn) {
+	defer netConn.Close()
+	reader := bufio.NewReader(netConn)
+	writer := bufio.NewWriter(netConn)
+	for {
+		request, err := readReply(reader)
+		if err != nil {
+			return
+		}
+		args, _ := replyStrings(request)
+		this.mu.Lock()
+		if this.hangUp {
+			this.hangUp = false
+			this.mu.Unlock()
+			return
+		}
+		this.commands = append(this.commands, args[0])
+		// count round trips: a read is anything the client waits on
+		if reader.Buffered() == 0 {
+			this.reads++
+		}
+		this.mu.Unlock()
+		writer.WriteString(this.reply(args))
+		if reader.Buffered() == 0 {
+			writer.Flush()
+		}
+	}
+}
+
+func bulk(value string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+}
+
+func array(values []string) string {
+	out := fmt.Sprintf("*%d\r\n", len(values))
+	for _, value := range values {
+		out += bulk(value)
+	}
+	return out
+}
+
+func (this *fakeRedis) reply(args []string) string {
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "AUTH":
+		if args[1] != "secret" {
+			return "-WRONGPASS invalid password\r\n"
+		}
+		return "+OK\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "TYPE":
+		switch this.data[args[1]].(type) {
+		case map[string]string:
+			return "+hash\r\n"
+		case []string:
+			return "+list\r\n"
+		case map[string]bool:
+			return "+set\r\n"
+		}
+		return "+none\r\n"
+	case "EXISTS":
+		if _, exists := this.data[args[1]]; exists {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	case "HGETALL":
+		hash, _ := this.data[args[1]].(map[string]string)
+		var values []string
+		for field, value := range hash {
+			values = append(values, field, value)
+		}
+		return array(values)
+	case "LRANGE":
+		list, _ := this.data[args[1]].([]string)
+		return array(list)
+	case "SMEMBERS":
+		set, _ := this.data[args[1]].(map[string]bool)
+		var members []string
+		for member := range set {
+			members = append(members, member)
+		}
+		sort.Strings(members)
+		return array(members)
+	}
+	return "-ERR unknown command '" + args[0] + "'\r\n"
+}
+
+var at = time.Unix(1380000000, 0)
+
+// testData loads the fixture in testdata, replaying the RPUSH, SADD and
+// HSET commands in it.
+func testData(t *testing.T) map[string]interface{} {
+	file, err := os.ReadFile("testdata/apiaxle-1.x.redis")
+	if err != nil {
+		t.Fatalf("Unable to read fixture: %v", err)
+	}
+	data := make(map[string]interface{})
+	for _, line := range strings.Split(string(file), "\n") {
+		args := strings.Fields(line)
+		if len(args) < 3 || strings.HasPrefix(args[0], "#") {
+			continue
+		}
+		key, values := args[1], args[2:]
+		switch args[0] {
+		case "RPUSH":
+			list, _ := data[key].([]string)
+			data[key] = append(list, values...)
+		case "SADD":
+			set, exists := data[key].(map[string]bool)
+			if !exists {
+				set = make(map[string]bool)
+				data[key] = set
+			}
+			for _, member := range values {
+				set[member] = true
+			}
+		case "HSET":
+			hash, exists := data[key].(map[string]string)
+			if !exists {
+				hash = make(map[string]string)
+				data[key] = hash
+			}
+			for x := 0; x+1 < len(values); x += 2 {
+				hash[values[x]] = values[x+1]
+			}
+		default:
+			t.Fatalf("Unexpected command in fixture: %s", line)
+		}
+	}
+	return data
+}
+
+func dialFake(t *testing.T, fake *fakeRedis, options Options) *Reader {
+	options.Address = fake.address()
+	options.Layout = DefaultLayout("development")
+	reader, err := Dial(options)
+	if err != nil {
+		t.Fatalf("Unable to dial: %v", err)
+	}
+	t.Cleanup(func() { reader.Close() })
+	reader.now = func() time.Time { return at.Add(time.Hour) }
+	return reader
+}
+
+func TestReaderResources(t *testing.T) {
+	fake := newFakeRedis(t, testData(t))
+	reader := dialFake(t, fake, Options{Password: "secret", DB: 2})
+
+	apis, err := reader.Apis()
+	if err != nil {
+		t.Fatalf("Unable to read apis: %v", err)
+	}
+	weather := apis["weather"]
+	if len(apis) != 2 || weather.Identifier != "weather" || weather.EndPoint != "weather.example.com" ||
+		weather.Protocol != goaxle.API_PROTOCOL_HTTPS || weather.EndPointTimeout != 5 || !weather.StrictSSL ||
+		weather.ParseCreatedAt().IsZero() {
+		t.Fatalf("Unexpected apis: %+v", apis)
+	}
+
+	keys, err := reader.Keys()
+	if err != nil {
+		t.Fatalf("Unable to read keys: %v", err)
+	}
+	// ghost is listed but has no hash
+	if len(keys) != 2 || keys["alpha"].Qps != 10 || keys["alpha"].SharedSecret != "12345" || keys["beta"].Qpd != -1 {
+		t.Fatalf("Unexpected keys: %+v", keys)
+	}
+
+	if _, err := reader.Get(goaxle.KIND_KEY, "ghost"); err == nil {
+		t.Fatalf("Expected an error getting a key without a hash")
+	}
+	if err := reader.Create(goaxle.NewKey("", "new")); err != ErrReadOnly {
+		t.Fatalf("Expected ErrReadOnly, got %v", err)
+	}
+}
+
+func TestReaderSnapshot(t *testing.T) {
+	fake := newFakeRedis(t, testData(t))
+	reader := dialFake(t, fake, Options{})
+
+	snapshot, err := reader.Snapshot()
+	if err != nil {
+		t.Fatalf("Unable to load snapshot: %v", err)
+	}
+	if strings.Join(snapshot.ApiKeys["weather"], ",") != "alpha,beta" || len(snapshot.ApiKeys["maps"]) != 0 {
+		t.Fatalf("Unexpected api keys: %v", snapshot.ApiKeys)
+	}
+	if strings.Join(snapshot.KeyApis["alpha"], ",") != "weather" || len(snapshot.KeyRingKeys["partners"]) != 1 {
+		t.Fatalf("Unexpected links: %v %v", snapshot.KeyApis, snapshot.KeyRingKeys)
+	}
+
+	// everything is pipelined: a couple of round trips per kind, not per
+	// object
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.reads > 20 {
+		t.Fatalf("Expected pipelined reads, made %d round trips for %d commands", fake.reads, len(fake.commands))
+	}
+}
+
+func TestReaderStats(t *testing.T) {
+	fake := newFakeRedis(t, testData(t))
+	reader := dialFake(t, fake, Options{})
+
+	stats, err := reader.Stats(goaxle.StatsTarget{Kind: goaxle.KIND_API, Identifier: "weather"}, at, at.Add(time.Minute), goaxle.GRANULARITY_MINUTES)
+	if err != nil {
+		t.Fatalf("Unable to read stats: %v", err)
+	}
+	if stats[goaxle.HIT_TYPE_UNCACHED][at][200] != 7 || stats[goaxle.HIT_TYPE_UNCACHED][at][404] != 1 ||
+		stats[goaxle.HIT_TYPE_ERROR][at.Add(time.Minute)][502] != 2 {
+		t.Fatalf("Unexpected stats: %v", stats)
+	}
+
+	stats, err = reader.Stats(goaxle.StatsTarget{Kind: goaxle.KIND_API, Identifier: "weather", ForKey: "alpha"}, at, at, goaxle.GRANULARITY_MINUTES)
+	if err != nil || stats[goaxle.HIT_TYPE_UNCACHED][at][200] != 4 {
+		t.Fatalf("Unexpected stats for alpha: %v %v", stats, err)
+	}
+
+	// the reader can back a management server
+	httpServer := httptest.NewServer(server.New(reader))
+	defer httpServer.Close()
+	address := httpServer.URL + "/"
+	key, err := goaxle.GetKey(address, "alpha")
+	if err != nil || key.Qps != 10 {
+		t.Fatalf("Unable to get key through the server: %+v %v", key, err)
+	}
+	stats, err = goaxle.ApiStats(address, "weather", at, at, "alpha", goaxle.GRANULARITY_MINUTES)
+	if err != nil || stats[goaxle.HIT_TYPE_UNCACHED][at][200] != 4 {
+		t.Fatalf("Unexpected stats through the server: %v %v", stats, err)
+	}
+	if err := goaxle.NewKey(address, "new").Save(); err == nil {
+		t.Fatalf("Expected the server to refuse writes")
+	}
+}
+
+func TestReaderStatsWithinRetention(t *testing.T) {
+	fake := newFakeRedis(t, testData(t))
+	reader := dialFake(t, fake, Options{})
+
+	// only the day of minutes still kept is asked for, however long the
+	// range
+	stats, err := reader.Stats(goaxle.StatsTarget{Kind: goaxle.KIND_API, Identifier: "weather"}, time.Unix(0, 0), at.Add(365*24*time.Hour), goaxle.GRANULARITY_MINUTES)
+	if err != nil || stats[goaxle.HIT_TYPE_UNCACHED][at][200] != 7 {
+		t.Fatalf("Unexpected stats: %v %v", stats, err)
+	}
+	hgetalls := 0
+	for _, command := range fake.commands {
+		if command == "HGETALL" {
+			hgetalls++
+		}
+	}
+	if expected := (24*60 + 1) * len(server.HIT_TYPES); hgetalls != expected {
+		t.Fatalf("Expected %d HGETALLs, got %d", expected, hgetalls)
+	}
+
+	// a range which has expired entirely isn't asked for at all
+	fake.commands = nil
+	stats, err = reader.Stats(goaxle.StatsTarget{Kind: goaxle.KIND_API, Identifier: "weather"}, time.Unix(0, 0), time.Unix(60, 0), goaxle.GRANULARITY_MINUTES)
+	if err != nil || len(stats) != 0 || len(fake.commands) != 0 {
+		t.Fatalf("Expected nothing for an expired range: %v %v %v", stats, fake.commands, err)
+	}
+}
+
+func TestReaderRedials(t *testing.T) {
+	fake := newFakeRedis(t, testData(t))
+	reader := dialFake(t, fake, Options{Password: "secret"})
+
+	fake.mu.Lock()
+	fake.hangUp = true
+	fake.mu.Unlock()
+	if _, err := reader.Apis(); err == nil {
+		t.Fatalf("Expected an error when the connection is closed")
+	}
+	apis, err := reader.Apis()
+	if err != nil || len(apis) != 2 {
+		t.Fatalf("Expected the reader to redial, got %v %v", apis, err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	auths := 0
+	for _, command := range fake.commands {
+		if command == "AUTH" {
+			auths++
+		}
+	}
+	if auths != 2 {
+		t.Fatalf("Expected AUTH to be sent again after redialling, sent %d times", auths)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	data := testData(t)
+	data["gk:development:api:meta:all"] = map[string]string{"not": "a collection"}
+	fake := newFakeRedis(t, data)
+	if _, err := Dial(Options{Address: fake.address(), Password: "wrong"}); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Fatalf("Expected an authentication error, got %v", err)
+	}
+
+	reader := dialFake(t, fake, Options{})
+	if _, err := reader.Apis(); err == nil {
+		t.Fatalf("Expected an error reading a hash as a collection")
+	}
+}
+
+/* ex: set noexpandtab: */
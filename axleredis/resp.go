@@ -0,0 +1,224 @@
+package axleredis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// redisError is an error reply from the server.
+type redisError string
+
+func (this redisError) Error() string {
+	return "Redis error: " + string(this)
+}
+
+// conn is a minimal RESP connection.  Replies are decoded as string for
+// simple and bulk strings, nil for null, int64 for integers and
+// []interface{} for arrays.
+//
+// After any I/O error the connection may be out of step with the server, so
+// it is closed and dialled again, resending setup, on the next call to do.
+type conn struct {
+	address string
+	timeout time.Duration
+
+	// Commands sent after connecting, such as AUTH and SELECT.
+	setup [][]string
+
+	mu      sync.Mutex
+	netConn net.Conn
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+}
+
+// dial connects to address and sends the setup commands.
+func dial(address string, timeout time.Duration, setup ...[]string) (out *conn, err error) {
+	out = &conn{address: address, timeout: timeout, setup: setup}
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	if err = out.connect(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// connect opens the network connection and sends the setup commands.  The
+// lock must be held.
+func (this *conn) connect() (err error) {
+	netConn, err := net.DialTimeout("tcp", this.address, this.timeout)
+	if err != nil {
+		return fmt.Errorf("Unable to connect to redis at %s: %s", this.address, err)
+	}
+	this.netConn = netConn
+	this.reader = bufio.NewReader(netConn)
+	this.writer = bufio.NewWriter(netConn)
+	if len(this.setup) == 0 {
+		return nil
+	}
+	if _, err = this.send(this.setup); err != nil {
+		this.drop()
+		return fmt.Errorf("Unable to set up redis connection: %s", err)
+	}
+	return nil
+}
+
+// drop closes a broken network connection so the next call redials.  The
+// lock must be held.
+func (this *conn) drop() {
+	if this.netConn != nil {
+		this.netConn.Close()
+		this.netConn = nil
+	}
+}
+
+func (this *conn) close() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.netConn == nil {
+		return nil
+	}
+	err := this.netConn.Close()
+	this.netConn = nil
+	return err
+}
+
+// do sends commands in one pipeline and returns their replies in order.
+// If any reply is an error the first is returned.
+func (this *conn) do(commands ...[]string) (replies []interface{}, err error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.netConn == nil {
+		if err = this.connect(); err != nil {
+			return nil, err
+		}
+	}
+	return this.send(commands)
+}
+
+// send writes commands and reads their replies, dropping the connection on
+// any I/O error.  The lock must be held.
+func (this *conn) send(commands [][]string) (replies []interface{}, err error) {
+	if this.timeout > 0 {
+		if err = this.netConn.SetDeadline(time.Now().Add(this.timeout)); err != nil {
+			this.drop()
+			return nil, fmt.Errorf("Unable to send to redis: %s", err)
+		}
+	}
+	for _, command := range commands {
+		fmt.Fprintf(this.writer, "*%d\r\n", len(command))
+		for _, arg := range command {
+			fmt.Fprintf(this.writer, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if err = this.writer.Flush(); err != nil {
+		this.drop()
+		return nil, fmt.Errorf("Unable to send to redis: %s", err)
+	}
+
+	// read every reply even after an error, so the connection stays in step
+	var replyErr error
+	replies = make([]interface{}, len(commands))
+	for x := range commands {
+		replies[x], err = readReply(this.reader)
+		if err != nil {
+			this.drop()
+			return nil, fmt.Errorf("Unable to read from redis: %s", err)
+		}
+		if problem, isError := replies[x].(redisError); isError && replyErr == nil {
+			replyErr = fmt.Errorf("%s: %w", commands[x][0], problem)
+		}
+	}
+	return replies, replyErr
+}
+
+// readReply decodes one RESP value.
+func readReply(reader *bufio.Reader) (reply interface{}, err error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("Malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return redisError(body), nil
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		length, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("Malformed bulk length %q", body)
+		}
+		if length < 0 {
+			return nil, nil
+		}
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:length]), nil
+	case '*':
+		length, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("Malformed array length %q", body)
+		}
+		if length < 0 {
+			return nil, nil
+		}
+		out := make([]interface{}, length)
+		for x := range out {
+			if out[x], err = readReply(reader); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("Unknown reply type %q", kind)
+}
+
+// replyStrings converts an array reply of strings.
+func replyStrings(reply interface{}) (out []string, err error) {
+	if reply == nil {
+		return []string{}, nil
+	}
+	values, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Expected an array reply, got %T", reply)
+	}
+	out = make([]string, 0, len(values))
+	for _, value := range values {
+		text, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("Expected a string in array reply, got %T", value)
+		}
+		out = append(out, text)
+	}
+	return out, nil
+}
+
+// replyHash converts an HGETALL reply.
+func replyHash(reply interface{}) (out map[string]string, err error) {
+	values, err := replyStrings(reply)
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%2 != 0 {
+		return nil, fmt.Errorf("Expected field value pairs, got %d values", len(values))
+	}
+	out = make(map[string]string, len(values)/2)
+	for x := 0; x < len(values); x += 2 {
+		out[values[x]] = values[x+1]
+	}
+	return out, nil
+}
+
+/* ex: set noexpandtab: */
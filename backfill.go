@@ -0,0 +1,504 @@
+package goaxle
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// granularities lists every granularity from finest to coarsest.
+var granularities = []Granularity{
+	GRANULARITY_SECONDS,
+	GRANULARITY_MINUTES,
+	GRANULARITY_HOURS,
+	GRANULARITY_DAYS,
+}
+
+// DefaultRetention is how long an ApiAxle server keeps the stats of each
+// granularity.  Adjust it to match the server's configuration.  A
+// granularity without an entry is assumed to be kept forever.
+var DefaultRetention = map[Granularity]time.Duration{
+	GRANULARITY_SECONDS: time.Hour,
+	GRANULARITY_MINUTES: 24 * time.Hour,
+	GRANULARITY_HOURS:   7 * 24 * time.Hour,
+	GRANULARITY_DAYS:    365 * 24 * time.Hour,
+}
+
+// StatsWindow is a period of time to request stats for at a single
+// granularity.  To is exclusive.
+type StatsWindow struct {
+	From        time.Time
+	To          time.Time
+	Granularity Granularity
+}
+
+// RangeOptions configures how long ranges are split up.
+type RangeOptions struct {
+	// The finest granularity to use.  Defaults to GRANULARITY_MINUTES.
+	Finest Granularity
+
+	// How long the server keeps each granularity.  Defaults to
+	// DefaultRetention.
+	Retention map[Granularity]time.Duration
+
+	// The current time, which retention is measured back from.  Defaults to
+	// time.Now().
+	Now time.Time
+}
+
+func (this RangeOptions) withDefaults() RangeOptions {
+	if this.Finest == "" {
+		this.Finest = GRANULARITY_MINUTES
+	}
+	if this.Retention == nil {
+		this.Retention = DefaultRetention
+	}
+	if this.Now.IsZero() {
+		this.Now = time.Now()
+	}
+	return this
+}
+
+// SplitRange splits the range from / to into windows, in chronological
+// order, each using the finest granularity the server still holds for it.
+// Where the granularity changes, the boundary is aligned to the coarser
+// buckets so no hit is counted twice.  Periods older than any retention
+// are left out.
+func SplitRange(from time.Time, to time.Time, options RangeOptions) (windows []StatsWindow, err error) {
+	options = options.withDefaults()
+	first := -1
+	for x, granularity := range granularities {
+		if granularity == options.Finest {
+			first = x
+		}
+	}
+	if first < 0 {
+		return nil, fmt.Errorf("Unknown granularity: %s", options.Finest)
+	}
+
+	// work backwards from the most recent, finest data
+	end := to
+	for x := first; x < len(granularities) && end.After(from); x++ {
+		granularity := granularities[x]
+		start := from
+		if retention, exists := options.Retention[granularity]; exists {
+			if oldest := options.Now.Add(-retention); oldest.After(start) {
+				start = oldest
+			}
+		}
+		// let the next granularity take over from one of its bucket edges
+		if x+1 < len(granularities) && start.After(from) {
+			start = ceilTime(start, granularitySteps[granularities[x+1]])
+		}
+		if start.Before(end) {
+			windows = append(windows, StatsWindow{From: start, To: end, Granularity: granularity})
+			end = start
+		}
+	}
+
+	for i, j := 0, len(windows)-1; i < j; i, j = i+1, j-1 {
+		windows[i], windows[j] = windows[j], windows[i]
+	}
+	return windows, nil
+}
+
+// ceilTime rounds t up to a multiple of step.
+func ceilTime(t time.Time, step time.Duration) time.Time {
+	truncated := t.Truncate(step)
+	if truncated.Equal(t) {
+		return t
+	}
+	return truncated.Add(step)
+}
+
+// rowCollector is a RowWriter which keeps rows in memory.
+type rowCollector struct {
+	rows []StatsRow
+}
+
+func (this *rowCollector) WriteRow(row StatsRow) error {
+	this.rows = append(this.rows, row)
+	return nil
+}
+
+func (this *rowCollector) Flush() error {
+	return nil
+}
+
+// QueryRange fetches the stats of target over a range of any length,
+// splitting it with SplitRange and merging the results into rows in
+// chronological order.  Each row records the granularity it came from.
+func QueryRange(axleAddress string, target StatsTarget, from time.Time, to time.Time, options RangeOptions) (rows []StatsRow, err error) {
+	windows, err := SplitRange(from, to, options)
+	if err != nil {
+		return nil, err
+	}
+	for _, window := range windows {
+		windowRows, err := queryWindow(axleAddress, target, window)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, windowRows...)
+	}
+	return rows, nil
+}
+
+// queryWindow fetches the stats of target over a single window.
+func queryWindow(axleAddress string, target StatsTarget, window StatsWindow) (rows []StatsRow, err error) {
+	collector := &rowCollector{}
+	_, err = ExportStats(collector, ExportOptions{
+		AxleAddress: axleAddress,
+		Target:      target,
+		From:        window.From,
+		To:          window.To,
+		Granularity: window.Granularity,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return collector.rows, nil
+}
+
+// statsScope identifies what a row was recorded against.
+type statsScope struct {
+	Api     string
+	Key     string
+	KeyRing string
+}
+
+// statsSeries identifies the rows which count the same thing over time.
+type statsSeries struct {
+	statsScope
+	HitType HitType
+	Status  int
+}
+
+func seriesOf(row StatsRow) statsSeries {
+	return statsSeries{statsScope{row.Api, row.Key, row.KeyRing}, row.HitType, row.Status}
+}
+
+// archiveSpan is a period of time.  To is exclusive.
+type archiveSpan struct {
+	From time.Time
+	To   time.Time
+}
+
+// addSpan merges span into spans, which are kept in order and without
+// overlaps.
+func addSpan(spans []archiveSpan, span archiveSpan) (merged []archiveSpan) {
+	for _, existing := range spans {
+		if existing.To.Before(span.From) || span.To.Before(existing.From) {
+			merged = append(merged, existing)
+			continue
+		}
+		if existing.From.Before(span.From) {
+			span.From = existing.From
+		}
+		if existing.To.After(span.To) {
+			span.To = existing.To
+		}
+	}
+	merged = append(merged, span)
+	sort.Slice(merged, func(i, j int) bool { return merged[i].From.Before(merged[j].From) })
+	return merged
+}
+
+// spansCover reports whether spans cover the whole of from / to.
+func spansCover(spans []archiveSpan, from time.Time, to time.Time) bool {
+	for _, span := range spans {
+		if !span.From.After(from) && span.To.After(from) {
+			from = span.To
+		}
+	}
+	return !from.Before(to)
+}
+
+// spansContain reports whether at falls within spans.
+func spansContain(spans []archiveSpan, at time.Time) bool {
+	for _, span := range spans {
+		if !at.Before(span.From) && at.Before(span.To) {
+			return true
+		}
+	}
+	return false
+}
+
+// archivedWindow is a window the archive has fetched, as saved alongside
+// it.
+type archivedWindow struct {
+	Api         string      `json:"api,omitempty"`
+	Key         string      `json:"key,omitempty"`
+	KeyRing     string      `json:"keyring,omitempty"`
+	Granularity Granularity `json:"granularity"`
+	From        time.Time   `json:"from"`
+	To          time.Time   `json:"to"`
+}
+
+// StatsArchive keeps stats rows in a local JSON Lines file so history
+// survives beyond the server's retention.  The windows fetched at each
+// granularity are kept in a second file, the archive's path with
+// ".windows" appended, so that Rows never returns two rows counting the
+// same hits.  It is safe for concurrent use.
+type StatsArchive struct {
+	path string
+
+	mu     sync.Mutex
+	series map[statsSeries]map[archiveBucket]StatsRow
+	// periods fetched at each granularity, including those without hits
+	fetched map[statsScope]map[Granularity][]archiveSpan
+}
+
+// archiveBucket identifies a bucket of a series.
+type archiveBucket struct {
+	Granularity Granularity
+	Timestamp   time.Time
+}
+
+// OpenStatsArchive loads the archive at path, which need not exist yet.
+func OpenStatsArchive(path string) (archive *StatsArchive, err error) {
+	archive = &StatsArchive{
+		path:    path,
+		series:  make(map[statsSeries]map[archiveBucket]StatsRow),
+		fetched: make(map[statsScope]map[Granularity][]archiveSpan),
+	}
+
+	var windows []archivedWindow
+	err = loadJSONFile(archive.windowsPath(), "stats archive windows", &windows)
+	if err != nil {
+		return nil, err
+	}
+	for _, window := range windows {
+		scope := statsScope{window.Api, window.Key, window.KeyRing}
+		archive.fetch(scope, window.Granularity, archiveSpan{window.From, window.To})
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return archive, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open stats archive: %s", err.Error())
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var row StatsRow
+		err = json.Unmarshal(scanner.Bytes(), &row)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read stats archive line %d: %s", line, err.Error())
+		}
+		archive.add(row)
+		// archives saved without windows only know of their rows
+		if windows == nil {
+			archive.fetchRow(row)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Unable to read stats archive: %s", err.Error())
+	}
+	archive.prune()
+	return archive, nil
+}
+
+func (this *StatsArchive) windowsPath() string {
+	return this.path + ".windows"
+}
+
+// Add merges rows into the archive.  Rows replace any existing row for the
+// same bucket, as counts for recent buckets grow.  Each row is taken to be
+// all that was fetched for its bucket, so finer rows only replace a coarser
+// row once they cover every one of its buckets.  Use Backfill where the
+// server omits buckets without hits.
+func (this *StatsArchive) Add(rows []StatsRow) (err error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	for _, row := range rows {
+		if _, exists := granularitySteps[row.Granularity]; !exists {
+			return fmt.Errorf("Unable to archive row without a known granularity: %+v", row)
+		}
+	}
+	for _, row := range rows {
+		this.add(row)
+		this.fetchRow(row)
+	}
+	this.prune()
+	return nil
+}
+
+func (this *StatsArchive) add(row StatsRow) {
+	row.Timestamp = row.Timestamp.UTC()
+	series := seriesOf(row)
+	if _, exists := this.series[series]; !exists {
+		this.series[series] = make(map[archiveBucket]StatsRow)
+	}
+	this.series[series][archiveBucket{row.Granularity, row.Timestamp}] = row
+}
+
+// fetch records that scope has been fetched over span at granularity.
+func (this *StatsArchive) fetch(scope statsScope, granularity Granularity, span archiveSpan) {
+	if _, exists := this.fetched[scope]; !exists {
+		this.fetched[scope] = make(map[Granularity][]archiveSpan)
+	}
+	span.From, span.To = span.From.UTC(), span.To.UTC()
+	this.fetched[scope][granularity] = addSpan(this.fetched[scope][granularity], span)
+}
+
+// fetchRow records the bucket of row as fetched.
+func (this *StatsArchive) fetchRow(row StatsRow) {
+	at := row.Timestamp.UTC()
+	span := archiveSpan{at, at.Add(granularitySteps[row.Granularity])}
+	this.fetch(seriesOf(row).statsScope, row.Granularity, span)
+}
+
+// prune drops the rows whose whole bucket has been fetched at finer
+// granularities.
+func (this *StatsArchive) prune() {
+	finer := make(map[statsScope]map[Granularity][]archiveSpan)
+	for scope, fetched := range this.fetched {
+		finer[scope] = make(map[Granularity][]archiveSpan)
+		var spans []archiveSpan
+		for _, granularity := range granularities {
+			finer[scope][granularity] = spans
+			for _, span := range fetched[granularity] {
+				spans = addSpan(spans, span)
+			}
+		}
+	}
+
+	for series, buckets := range this.series {
+		for bucket := range buckets {
+			end := bucket.Timestamp.Add(granularitySteps[bucket.Granularity])
+			if spansCover(finer[series.statsScope][bucket.Granularity], bucket.Timestamp, end) {
+				delete(buckets, bucket)
+			}
+		}
+	}
+}
+
+// Rows returns the archived rows with timestamps in from / to, in
+// chronological order.  Zero times leave that end of the range open.  Rows
+// never overlap: finer rows within the fetched part of a coarser row's
+// bucket are left out in favour of it.
+func (this *StatsArchive) Rows(from time.Time, to time.Time) (rows []StatsRow) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	for series, buckets := range this.series {
+		fetched := this.fetched[series.statsScope]
+		// periods already counted by coarser rows
+		var counted []archiveSpan
+		for x := len(granularities) - 1; x >= 0; x-- {
+			granularity := granularities[x]
+			step := granularitySteps[granularity]
+			var shown []archiveSpan
+			for bucket, row := range buckets {
+				if bucket.Granularity != granularity || spansContain(counted, bucket.Timestamp) {
+					continue
+				}
+				end := bucket.Timestamp.Add(step)
+				for _, span := range fetched[granularity] {
+					if span.From.Before(end) && span.To.After(bucket.Timestamp) {
+						shown = append(shown, archiveSpan{maxTime(span.From, bucket.Timestamp), minTime(span.To, end)})
+					}
+				}
+				if !from.IsZero() && row.Timestamp.Before(from) {
+					continue
+				}
+				if !to.IsZero() && !row.Timestamp.Before(to) {
+					continue
+				}
+				rows = append(rows, row)
+			}
+			for _, span := range shown {
+				counted = addSpan(counted, span)
+			}
+		}
+	}
+	sortStatsRows(rows)
+	return rows
+}
+
+func maxTime(a time.Time, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func minTime(a time.Time, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// Save writes the archive and its windows back to their files, replacing
+// each atomically.
+func (this *StatsArchive) Save() (err error) {
+	this.mu.Lock()
+	var buffer bytes.Buffer
+	writer := NewJSONLinesRowWriter(&buffer)
+	var rows []StatsRow
+	for _, buckets := range this.series {
+		for _, row := range buckets {
+			rows = append(rows, row)
+		}
+	}
+	windows := []archivedWindow{}
+	for scope, fetched := range this.fetched {
+		for _, granularity := range granularities {
+			for _, span := range fetched[granularity] {
+				windows = append(windows, archivedWindow{scope.Api, scope.Key, scope.KeyRing, granularity, span.From, span.To})
+			}
+		}
+	}
+	this.mu.Unlock()
+
+	sortStatsRows(rows)
+	for _, row := range rows {
+		if err = writer.WriteRow(row); err != nil {
+			return fmt.Errorf("Unable to save stats archive: %s", err.Error())
+		}
+	}
+	if err = writeFileAtomic(this.path, buffer.Bytes()); err != nil {
+		return fmt.Errorf("Unable to save stats archive: %s", err.Error())
+	}
+	// saved second, so a crash leaves the windows understated rather than
+	// claiming rows which were never saved
+	return saveJSONFile(this.windowsPath(), "stats archive windows", windows)
+}
+
+// Backfill fetches the stats of target over from / to, split up with
+// SplitRange, adds them to the archive along with the windows fetched and
+// saves it.
+func (this *StatsArchive) Backfill(axleAddress string, target StatsTarget, from time.Time, to time.Time, options RangeOptions) (err error) {
+	windows, err := SplitRange(from, to, options)
+	if err != nil {
+		return err
+	}
+	scope := seriesOf(target.template()).statsScope
+	for _, window := range windows {
+		rows, err := queryWindow(axleAddress, target, window)
+		if err != nil {
+			return err
+		}
+		this.mu.Lock()
+		for _, row := range rows {
+			this.add(row)
+		}
+		// ExportStats fetches from the start of the first bucket
+		window.From = window.From.Truncate(granularitySteps[window.Granularity])
+		this.fetch(scope, window.Granularity, archiveSpan{window.From, window.To})
+		this.prune()
+		this.mu.Unlock()
+	}
+	return this.Save()
+}
+
+/* ex: set noexpandtab: */
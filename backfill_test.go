@@ -0,0 +1,166 @@
+package goaxle
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSplitRange(t *testing.T) {
+	now := time.Date(2013, 9, 24, 12, 30, 30, 0, time.UTC)
+	windows, err := SplitRange(now.Add(-30*24*time.Hour), now, RangeOptions{
+		Finest: GRANULARITY_SECONDS,
+		Now:    now,
+	})
+	if err != nil {
+		t.Fatalf("Unable to split range: %v", err)
+	}
+	expected := []StatsWindow{
+		{now.Add(-30 * 24 * time.Hour), time.Date(2013, 9, 18, 0, 0, 0, 0, time.UTC), GRANULARITY_DAYS},
+		{time.Date(2013, 9, 18, 0, 0, 0, 0, time.UTC), time.Date(2013, 9, 23, 13, 0, 0, 0, time.UTC), GRANULARITY_HOURS},
+		{time.Date(2013, 9, 23, 13, 0, 0, 0, time.UTC), time.Date(2013, 9, 24, 11, 31, 0, 0, time.UTC), GRANULARITY_MINUTES},
+		{time.Date(2013, 9, 24, 11, 31, 0, 0, time.UTC), now, GRANULARITY_SECONDS},
+	}
+	if len(windows) != len(expected) {
+		t.Fatalf("Expected %d windows, got %+v", len(expected), windows)
+	}
+	for x := range expected {
+		if !windows[x].From.Equal(expected[x].From) || !windows[x].To.Equal(expected[x].To) ||
+			windows[x].Granularity != expected[x].Granularity {
+			t.Errorf("Window %d is %+v, expected %+v", x, windows[x], expected[x])
+		}
+	}
+
+	// a short, recent range needs only one window
+	windows, _ = SplitRange(now.Add(-time.Hour), now, RangeOptions{Now: now})
+	if len(windows) != 1 || windows[0].Granularity != GRANULARITY_MINUTES {
+		t.Fatalf("Unexpected windows: %+v", windows)
+	}
+}
+
+func TestStatsArchive(t *testing.T) {
+	now := time.Date(2013, 9, 24, 12, 30, 0, 0, time.UTC)
+	axle := newTestAxle(t, map[string]string{
+		"GET /v1/api/weather/stats": statsResponse(time.Date(2013, 9, 24, 12, 10, 0, 0, time.UTC), map[int]int{200: 3}, nil),
+	})
+	path := filepath.Join(t.TempDir(), "weather.jsonl")
+	archive, err := OpenStatsArchive(path)
+	if err != nil {
+		t.Fatalf("Unable to open archive: %v", err)
+	}
+	target := StatsTarget{Kind: KIND_API, Identifier: "weather"}
+	err = archive.Backfill(axle.address(), target, now.Add(-time.Hour), now, RangeOptions{Now: now})
+	if err != nil {
+		t.Fatalf("Unable to backfill: %v", err)
+	}
+
+	// coarser rows are kept over finer rows which only partly cover them
+	err = archive.Add([]StatsRow{
+		{Timestamp: time.Date(2013, 9, 24, 12, 0, 0, 0, time.UTC), Api: "weather", HitType: HIT_TYPE_UNCACHED, Status: 200, Count: 9, Granularity: GRANULARITY_HOURS},
+		{Timestamp: time.Date(2013, 9, 24, 11, 0, 0, 0, time.UTC), Api: "weather", HitType: HIT_TYPE_UNCACHED, Status: 200, Count: 4, Granularity: GRANULARITY_HOURS},
+		{Timestamp: time.Date(2013, 9, 24, 12, 10, 0, 0, time.UTC), Api: "weather", HitType: HIT_TYPE_UNCACHED, Status: 200, Count: 5, Granularity: GRANULARITY_MINUTES},
+	})
+	if err != nil {
+		t.Fatalf("Unable to add rows: %v", err)
+	}
+	if err = archive.Save(); err != nil {
+		t.Fatalf("Unable to save: %v", err)
+	}
+
+	reopened, err := OpenStatsArchive(path)
+	if err != nil {
+		t.Fatalf("Unable to reopen archive: %v", err)
+	}
+	rows := reopened.Rows(time.Time{}, time.Time{})
+	if len(rows) != 2 {
+		t.Fatalf("Expected two rows, got %+v", rows)
+	}
+	if rows[0].Granularity != GRANULARITY_HOURS || rows[0].Count != 4 ||
+		rows[1].Granularity != GRANULARITY_HOURS || rows[1].Count != 9 {
+		t.Fatalf("Unexpected rows: %+v", rows)
+	}
+
+	// finer rows replace a coarser one once they cover all of it, after
+	// which coarser rows for the period are ignored
+	var minutes []StatsRow
+	for minute := 0; minute < 60; minute++ {
+		minutes = append(minutes, StatsRow{Timestamp: time.Date(2013, 9, 24, 11, minute, 0, 0, time.UTC), Api: "weather", HitType: HIT_TYPE_UNCACHED, Status: 200, Count: 1, Granularity: GRANULARITY_MINUTES})
+	}
+	minutes = append(minutes, StatsRow{Timestamp: time.Date(2013, 9, 24, 11, 0, 0, 0, time.UTC), Api: "weather", HitType: HIT_TYPE_UNCACHED, Status: 200, Count: 4, Granularity: GRANULARITY_HOURS})
+	reopened.Add(minutes)
+	rows = reopened.Rows(time.Date(2013, 9, 24, 11, 0, 0, 0, time.UTC), time.Date(2013, 9, 24, 12, 0, 0, 0, time.UTC))
+	if len(rows) != 60 || rows[0].Granularity != GRANULARITY_MINUTES {
+		t.Fatalf("Coarse row not replaced: %d rows, first %+v", len(rows), rows[0])
+	}
+
+	if err := reopened.Add([]StatsRow{{Timestamp: now}}); err == nil {
+		t.Fatalf("Expected an error for a row without granularity")
+	}
+}
+
+func TestStatsArchiveRowsDontOverlap(t *testing.T) {
+	archive, err := OpenStatsArchive(filepath.Join(t.TempDir(), "weather.jsonl"))
+	if err != nil {
+		t.Fatalf("Unable to open archive: %v", err)
+	}
+	day := time.Date(2013, 9, 24, 0, 0, 0, 0, time.UTC)
+	err = archive.Add([]StatsRow{
+		{Timestamp: day, Api: "weather", HitType: HIT_TYPE_UNCACHED, Status: 200, Count: 1000, Granularity: GRANULARITY_DAYS},
+		{Timestamp: day.Add(10*time.Hour + 5*time.Minute), Api: "weather", HitType: HIT_TYPE_UNCACHED, Status: 200, Count: 3, Granularity: GRANULARITY_MINUTES},
+	})
+	if err != nil {
+		t.Fatalf("Unable to add rows: %v", err)
+	}
+	rows := archive.Rows(day, day.Add(24*time.Hour))
+	if len(rows) != 1 || rows[0].Granularity != GRANULARITY_DAYS || rows[0].Count != 1000 {
+		t.Fatalf("Expected just the day row, got %+v", rows)
+	}
+}
+
+func TestStatsArchiveBackfillReplacesCoarseRows(t *testing.T) {
+	now := time.Date(2013, 9, 24, 12, 0, 0, 0, time.UTC)
+	hour := time.Date(2013, 9, 24, 11, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "weather.jsonl")
+	archive, err := OpenStatsArchive(path)
+	if err != nil {
+		t.Fatalf("Unable to open archive: %v", err)
+	}
+	archive.Add([]StatsRow{
+		{Timestamp: hour, Api: "weather", HitType: HIT_TYPE_UNCACHED, Status: 200, Count: 7, Granularity: GRANULARITY_HOURS},
+	})
+
+	// the server omits the minutes without hits, but fetching them all
+	// still covers the hour
+	axle := newTestAxle(t, map[string]string{
+		"GET /v1/api/weather/stats": statsResponse(hour.Add(10*time.Minute), map[int]int{200: 7}, nil),
+	})
+	target := StatsTarget{Kind: KIND_API, Identifier: "weather"}
+	err = archive.Backfill(axle.address(), target, hour, now, RangeOptions{Now: now})
+	if err != nil {
+		t.Fatalf("Unable to backfill: %v", err)
+	}
+
+	reopened, err := OpenStatsArchive(path)
+	if err != nil {
+		t.Fatalf("Unable to reopen archive: %v", err)
+	}
+	rows := reopened.Rows(time.Time{}, time.Time{})
+	if len(rows) != 1 || rows[0].Granularity != GRANULARITY_MINUTES || rows[0].Count != 7 {
+		t.Fatalf("Expected the minute row alone, got %+v", rows)
+	}
+
+	// a coarse row fetched before a partial hour hides only the minutes it
+	// counted
+	day := time.Date(2013, 9, 24, 0, 0, 0, 0, time.UTC)
+	axle.set("GET /v1/api/weather/stats", statsResponse(day, map[int]int{200: 20}, nil))
+	err = reopened.Backfill(axle.address(), target, day, hour, RangeOptions{Now: now, Finest: GRANULARITY_DAYS})
+	if err != nil {
+		t.Fatalf("Unable to backfill: %v", err)
+	}
+	rows = reopened.Rows(time.Time{}, time.Time{})
+	if len(rows) != 2 || rows[0].Granularity != GRANULARITY_DAYS || rows[1].Granularity != GRANULARITY_MINUTES {
+		t.Fatalf("Expected the day row and the later minute row, got %+v", rows)
+	}
+}
+
+/* ex: set noexpandtab: */
@@ -0,0 +1,357 @@
+package goaxle
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client holds the settings used when talking to an ApiAxle server.  The
+// zero value is ready to use.
+type Client struct {
+	// HTTPClient performs the requests.  Defaults to http.DefaultClient, or
+	// a client using TLSConfig if that is set.
+	HTTPClient *http.Client
+
+	// TLSConfig, if set and HTTPClient isn't, is used for HTTPS connections,
+	// e.g. to present a client certificate from ClientCertificate.  It must
+	// be set before the Client is first used.
+	TLSConfig *tls.Config
+
+	// Auth, if set, adds credentials to every request.
+	Auth Authenticator
+
+	// Logger, if set, records every management request at debug level and
+	// every failure at warn level.  Key identifiers and shared secrets are
+	// redacted.
+	Logger *slog.Logger
+
+	// Number of times a GET that failed to reach the server is retried.
+	MaxRetries int
+
+	// Instrumentation, if set, is notified around every request.
+	Instrumentation Instrumentation
+
+	// Limiter, if set, throttles every request made through this Client.
+	Limiter *Limiter
+
+	// Cluster, if set, spreads requests over the servers of the Cluster
+	// instead of sending them to the address given.  It is set by
+	// Cluster.Register.
+	Cluster *Cluster
+
+	// set by WithContext
+	ctx context.Context
+
+	tlsClientOnce sync.Once
+	tlsClient     *http.Client
+}
+
+// WithContext returns a copy of the Client whose requests, including time
+// spent waiting on the Limiter, are bound by ctx.  Cancelling ctx aborts the
+// copy's queued and in-flight calls; the original is unaffected.  The copy
+// shares the original's Limiter and connections.
+func (this *Client) WithContext(ctx context.Context) *Client {
+	return &Client{
+		HTTPClient:      this.httpClient(),
+		Auth:            this.Auth,
+		Logger:          this.Logger,
+		MaxRetries:      this.MaxRetries,
+		Instrumentation: this.Instrumentation,
+		Limiter:         this.Limiter,
+		Cluster:         this.Cluster,
+		ctx:             ctx,
+	}
+}
+
+// context returns the context requests are bound by.
+func (this *Client) context() context.Context {
+	if this.ctx == nil {
+		return context.Background()
+	}
+	return this.ctx
+}
+
+// DefaultClient is used for any address without a registered Client.
+var DefaultClient = &Client{}
+
+var registeredClients = struct {
+	sync.RWMutex
+	byAddress map[string]*Client
+}{byAddress: make(map[string]*Client)}
+
+// RegisterClient makes every call against axleAddress, including calls on
+// objects retrieved from it, use client.
+func RegisterClient(axleAddress string, client *Client) {
+	registeredClients.Lock()
+	defer registeredClients.Unlock()
+	registeredClients.byAddress[axleAddress] = client
+}
+
+// UnregisterClient reverts axleAddress to using DefaultClient.
+func UnregisterClient(axleAddress string) {
+	registeredClients.Lock()
+	defer registeredClients.Unlock()
+	delete(registeredClients.byAddress, axleAddress)
+}
+
+// clientFor returns the Client registered for the longest address that
+// prefixes reqAddress, or DefaultClient.
+func clientFor(reqAddress string) *Client {
+	registeredClients.RLock()
+	defer registeredClients.RUnlock()
+	var client *Client
+	longest := -1
+	for address, registered := range registeredClients.byAddress {
+		if len(address) > longest && strings.HasPrefix(reqAddress, address) {
+			client = registered
+			longest = len(address)
+		}
+	}
+	if client == nil {
+		return DefaultClient
+	}
+	return client
+}
+
+// do performs verb on reqAddress, optionally posting postData.
+// It returns the full page contents as a slice, and / or an error object
+// describing any issues encountered.
+func (this *Client) do(verb string, reqAddress string, postData []byte) (body []byte, err error) {
+	if this.Cluster != nil {
+		return this.Cluster.do(this.context(), verb, reqAddress, postData)
+	}
+	_, body, err = this.request(this.context(), verb, reqAddress, postData)
+	return body, err
+}
+
+// request performs verb on reqAddress, as do, but also returns the HTTP
+// status of the response, or 0 if the server couldn't be reached.
+func (this *Client) request(ctx context.Context, verb string, reqAddress string, postData []byte) (status int, body []byte, err error) {
+	start := time.Now()
+	retries := 0
+	var throttled time.Duration
+	if this.Instrumentation != nil {
+		var finish func(int, error)
+		ctx, finish = this.Instrumentation.StartRequest(ctx, describeRequest(verb, reqAddress))
+		defer func() {
+			finish(status, err)
+		}()
+	}
+	defer func() {
+		this.log(verb, reqAddress, status, time.Since(start), throttled, retries, err)
+	}()
+
+	httpClient := this.httpClient()
+
+	for {
+		var waited time.Duration
+		status, body, waited, err = this.attempt(ctx, httpClient, verb, reqAddress, postData)
+		throttled += waited
+		// only retry reads which never got a response
+		if err != nil && status == 0 && verb == "GET" && retries < this.MaxRetries && ctx.Err() == nil {
+			retries++
+			continue
+		}
+		return status, body, err
+	}
+}
+
+// attempt makes a single request, waiting on the Limiter first if there is
+// one.  It returns the response status and body, and how long it was
+// throttled for.
+func (this *Client) attempt(ctx context.Context, httpClient *http.Client, verb string, reqAddress string, postData []byte) (status int, body []byte, throttled time.Duration, err error) {
+	if this.Limiter != nil {
+		waitStart := time.Now()
+		release, err := this.Limiter.Wait(ctx)
+		throttled = time.Since(waitStart)
+		if err != nil {
+			return 0, nil, throttled, fmt.Errorf(
+				"Unable to %s api at %s: %s",
+				verb,
+				reqAddress,
+				err.Error(),
+			)
+		}
+		defer release()
+	}
+
+	resp, err := this.send(ctx, httpClient, verb, reqAddress, postData)
+	if err != nil {
+		return 0, nil, throttled, err
+	}
+	defer resp.Body.Close()
+
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, throttled, fmt.Errorf(
+			"Unable to read response from %s: %s",
+			verb,
+			err.Error(),
+		)
+	}
+
+	if resp.StatusCode != 200 {
+		return resp.StatusCode, body, throttled, &statusError{
+			statusCode: resp.StatusCode,
+			message: fmt.Sprintf(
+				"Unable to %s api at %s, server returned status \"%s\" (%s)",
+				verb,
+				reqAddress,
+				resp.Status,
+				string(body),
+			),
+		}
+	}
+
+	return resp.StatusCode, body, throttled, nil
+}
+
+// statusError is returned when the server answers with an error status.
+type statusError struct {
+	statusCode int
+	message    string
+}
+
+func (this *statusError) Error() string {
+	return this.message
+}
+
+// IsNotFound reports whether err, or an error it wraps, is the server
+// saying that what was asked for doesn't exist.
+func IsNotFound(err error) bool {
+	var status *statusError
+	return errors.As(err, &status) && status.statusCode == http.StatusNotFound
+}
+
+// httpClient returns the http.Client requests should be made with.
+func (this *Client) httpClient() *http.Client {
+	if this.HTTPClient != nil {
+		return this.HTTPClient
+	}
+	if this.TLSConfig == nil {
+		return http.DefaultClient
+	}
+	this.tlsClientOnce.Do(func() {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = this.TLSConfig
+		this.tlsClient = &http.Client{Transport: transport}
+	})
+	return this.tlsClient
+}
+
+// send issues a single attempt of a request.
+func (this *Client) send(ctx context.Context, httpClient *http.Client, verb string, reqAddress string, postData []byte) (resp *http.Response, err error) {
+	buf := bytes.NewBuffer(make([]byte, 0))
+	if postData != nil {
+		buf = bytes.NewBuffer(postData)
+	}
+	req, err := http.NewRequestWithContext(ctx, verb, reqAddress, buf)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"Unable to prepare %s - %s: %s",
+			verb,
+			reqAddress,
+			err.Error(),
+		)
+	}
+	req.URL.Opaque = strings.Split(reqAddress, "?")[0]
+
+	req.Header = map[string][]string{
+		"Content-type": {"application/json"},
+	}
+	if this.Auth != nil {
+		err = this.Auth.Authenticate(req)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"Unable to authenticate %s - %s: %s",
+				verb,
+				reqAddress,
+				err.Error(),
+			)
+		}
+	}
+	resp, err = httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"Unable to %s api at %s: %w",
+			verb,
+			reqAddress,
+			err,
+		)
+	}
+	return resp, nil
+}
+
+// neverSent reports whether err came from failing to connect, in which case
+// the request can't have reached the server.
+func neverSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// log records the outcome of a request if a Logger is configured.
+func (this *Client) log(verb string, reqAddress string, status int, duration time.Duration, throttled time.Duration, retries int, err error) {
+	if this.Logger == nil {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("verb", verb),
+		slog.String("path", Redact(requestPath(reqAddress))),
+		slog.Int("status", status),
+		slog.Duration("duration", duration),
+		slog.Duration("throttled", throttled),
+		slog.Int("retries", retries),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", Redact(err.Error())))
+		this.Logger.LogAttrs(context.Background(), slog.LevelWarn, "ApiAxle request failed", attrs...)
+		return
+	}
+	this.Logger.LogAttrs(context.Background(), slog.LevelDebug, "ApiAxle request", attrs...)
+}
+
+// requestPath strips the scheme and host from reqAddress.
+func requestPath(reqAddress string) string {
+	path := reqAddress
+	if index := strings.Index(path, "://"); index >= 0 {
+		path = path[index+3:]
+	}
+	if index := strings.Index(path, "/"); index >= 0 {
+		return path[index:]
+	}
+	return "/"
+}
+
+var redactions = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// key identifiers in paths, e.g. /key/<id>, /linkkey/<id>
+	{regexp.MustCompile(`(/(?:key|linkkey|unlinkkey)/)[^/?&"\s]+`), "${1}[REDACTED]"},
+	// key identifiers in query strings
+	{regexp.MustCompile(`((?:\?|&)forkey=)[^&"\s]+`), "${1}[REDACTED]"},
+	// shared secrets in bodies
+	{regexp.MustCompile(`("sharedSecret"\s*:\s*")(?:[^"\\]|\\.)*"`), `${1}[REDACTED]"`},
+}
+
+// Redact removes key identifiers and shared secrets from s so it is safe to
+// log.
+func Redact(s string) string {
+	for _, redaction := range redactions {
+		s = redaction.pattern.ReplaceAllString(s, redaction.replacement)
+	}
+	return s
+}
+
+/* ex: set noexpandtab: */
@@ -0,0 +1,117 @@
+package goaxle
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// roundTripFunc lets tests intercept requests made through a Client.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (this roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return this(req)
+}
+
+// logRecords decodes the JSON log lines written to buf.
+func logRecords(t *testing.T, buf *bytes.Buffer) (records []map[string]interface{}) {
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		record := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Bad log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestClientLogging(t *testing.T) {
+	axle := newTestAxle(t, map[string]string{
+		"GET /v1/key/supersecretkey": `{"meta":{"version":1,"status_code":200},"results":{"qps":2,"qpd":10,"sharedSecret":"hunter2"}}`,
+		"PUT /v1/key/supersecretkey": `{"results":{"error":{"message":"bad","sharedSecret":"hunter2"}}}`,
+	})
+	buf := new(bytes.Buffer)
+	RegisterClient(axle.address(), &Client{
+		Logger: slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	})
+	defer UnregisterClient(axle.address())
+
+	key, err := GetKey(axle.address(), "supersecretkey")
+	if err != nil {
+		t.Fatalf("Unable to get key: %v", err)
+	}
+	axle.remove("PUT /v1/key/supersecretkey")
+	if err := key.Save(); err == nil {
+		t.Fatalf("Save succeeded against missing route")
+	}
+
+	if strings.Contains(buf.String(), "supersecretkey") || strings.Contains(buf.String(), "hunter2") {
+		t.Fatalf("Secrets leaked into the log: %s", buf.String())
+	}
+
+	records := logRecords(t, buf)
+	if len(records) != 2 {
+		t.Fatalf("Expected two log records, got %d: %s", len(records), buf.String())
+	}
+	if records[0]["level"] != "DEBUG" || records[0]["verb"] != "GET" ||
+		records[0]["path"] != "/v1/key/[REDACTED]" || records[0]["status"] != float64(200) {
+		t.Fatalf("Unexpected success record: %v", records[0])
+	}
+	if records[1]["level"] != "WARN" || records[1]["verb"] != "PUT" ||
+		records[1]["status"] != float64(404) || records[1]["error"] == nil {
+		t.Fatalf("Unexpected failure record: %v", records[1])
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	axle := newTestAxle(t, map[string]string{
+		"GET /v1/keys": `{"meta":{"version":1,"status_code":200},"results":{}}`,
+	})
+	failures := 2
+	buf := new(bytes.Buffer)
+	RegisterClient(axle.address(), &Client{
+		HTTPClient: &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if failures > 0 {
+				failures--
+				return nil, fmt.Errorf("connection refused")
+			}
+			return http.DefaultTransport.RoundTrip(req)
+		})},
+		Logger:     slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		MaxRetries: 2,
+	})
+	defer UnregisterClient(axle.address())
+
+	if _, err := Keys(axle.address(), 0, 10); err != nil {
+		t.Fatalf("Request wasn't retried: %v", err)
+	}
+	records := logRecords(t, buf)
+	if len(records) != 1 || records[0]["retries"] != float64(2) {
+		t.Fatalf("Retry count not logged: %s", buf.String())
+	}
+}
+
+func TestRedact(t *testing.T) {
+	cases := map[string]string{
+		"/v1/key/abc":                              "/v1/key/[REDACTED]",
+		"/v1/keyring/ring/keys":                    "/v1/keyring/ring/keys",
+		"/v1/api/weather/linkkey/abc":              "/v1/api/weather/linkkey/[REDACTED]",
+		"/v1/api/weather/stats?from=1&forkey=abc":  "/v1/api/weather/stats?from=1&forkey=[REDACTED]",
+		`{"qps":1,"sharedSecret":"s\"ecret"}`:      `{"qps":1,"sharedSecret":"[REDACTED]"}`,
+		"/v1/keyring/ring/unlinkkey/abc?resolve=1": "/v1/keyring/ring/unlinkkey/[REDACTED]?resolve=1",
+	}
+	for input, expected := range cases {
+		if got := Redact(input); got != expected {
+			t.Errorf("Redact(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
+
+/* ex: set noexpandtab: */
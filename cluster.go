@@ -0,0 +1,266 @@
+package goaxle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Selection is how a Cluster chooses a server for reads.
+type Selection int
+
+const (
+	// Spread reads evenly over the healthy servers.
+	SELECTION_ROUND_ROBIN Selection = iota
+	// Send reads to the first healthy server, in the order given.
+	SELECTION_PRIMARY_SECONDARY
+)
+
+// ClusterOptions configures a Cluster.
+type ClusterOptions struct {
+	// How reads are spread over the servers.
+	Selection Selection
+
+	// How often Start checks the health of every server.  Defaults to 10
+	// seconds.
+	HealthCheckInterval time.Duration
+
+	// Client holds the settings, such as Auth or Logger, used for requests
+	// to each server.  It must not itself have a Cluster.  Defaults to a
+	// zero Client.
+	Client *Client
+}
+
+// ServerStatus describes the health of one server in a Cluster.
+type ServerStatus struct {
+	Address   string
+	Healthy   bool
+	LastError error
+	// When the server was last health checked or used.
+	LastCheck time.Time
+}
+
+// Cluster sends the calls made against its address to several replicas of
+// an ApiAxle server.  Reads go to a healthy server chosen by Selection, and
+// are retried on the next server if they get no response.  Writes stick to
+// one server so they are applied in order, moving on only when it can't be
+// connected to; a write which was sent but got no response may have been
+// applied, so it fails rather than being replayed elsewhere.
+type Cluster struct {
+	address string
+	options ClusterOptions
+	client  *Client
+
+	mu      sync.Mutex
+	servers []*ServerStatus
+	next    int
+	writer  int
+
+	stopMu sync.Mutex
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewCluster creates a Cluster answering on address, a name of the form
+// "cluster://name/" which is passed to the library in place of a server
+// address, and forwarding to servers.  Servers are assumed healthy until a
+// call or health check fails.  Call Register to start using it.
+func NewCluster(address string, servers []string, options ClusterOptions) (out *Cluster, err error) {
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("Unable to create cluster %s: no servers given", address)
+	}
+	if !strings.HasSuffix(address, "/") {
+		return nil, fmt.Errorf("Unable to create cluster %s: address must end in /", address)
+	}
+	if options.HealthCheckInterval <= 0 {
+		options.HealthCheckInterval = 10 * time.Second
+	}
+	client := options.Client
+	if client == nil {
+		client = &Client{}
+	}
+	if client.Cluster != nil {
+		return nil, fmt.Errorf("Unable to create cluster %s: client already belongs to a cluster", address)
+	}
+
+	out = &Cluster{
+		address: address,
+		options: options,
+		client:  client,
+	}
+	for _, server := range servers {
+		if !strings.HasSuffix(server, "/") {
+			server += "/"
+		}
+		out.servers = append(out.servers, &ServerStatus{Address: server, Healthy: true})
+	}
+	return out, nil
+}
+
+// Address returns the address to pass to the library to use this Cluster.
+func (this *Cluster) Address() string {
+	return this.address
+}
+
+// Register routes every call made against Address through this Cluster.
+func (this *Cluster) Register() {
+	RegisterClient(this.address, &Client{Cluster: this})
+}
+
+// Unregister stops routing calls through this Cluster.
+func (this *Cluster) Unregister() {
+	UnregisterClient(this.address)
+}
+
+// Status returns the health of each server, in the order given.
+func (this *Cluster) Status() (out []ServerStatus) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	for _, server := range this.servers {
+		out = append(out, *server)
+	}
+	return out
+}
+
+// Check pings every server concurrently and records whether it is healthy.
+// It returns the errors of any unhealthy servers joined together.
+func (this *Cluster) Check() error {
+	errs := make([]error, len(this.servers))
+	var wg sync.WaitGroup
+	for x, server := range this.Status() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, body, err := this.client.request(this.client.context(), "GET", server.Address+VERSION_ENDPOINT+"ping", nil)
+			if err == nil && string(body) != "pong" {
+				err = fmt.Errorf("ApiAxle server at %v didn't respond with pong, but with \"%v\"", server.Address, string(body))
+			}
+			this.record(x, err)
+			errs[x] = err
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Start checks the health of every server every HealthCheckInterval until
+// Stop is called.
+func (this *Cluster) Start() {
+	this.stopMu.Lock()
+	defer this.stopMu.Unlock()
+	if this.stop != nil {
+		return
+	}
+	this.stop = make(chan struct{})
+	this.done = make(chan struct{})
+	go this.checkLoop(this.stop, this.done)
+}
+
+// Stop halts background health checks.
+func (this *Cluster) Stop() {
+	this.stopMu.Lock()
+	defer this.stopMu.Unlock()
+	if this.stop == nil {
+		return
+	}
+	close(this.stop)
+	<-this.done
+	this.stop = nil
+	this.done = nil
+}
+
+func (this *Cluster) checkLoop(stop chan struct{}, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(this.options.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			// failures are recorded and exposed through Status
+			this.Check()
+		}
+	}
+}
+
+// record updates the health of a server after a request to it.
+func (this *Cluster) record(index int, err error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	server := this.servers[index]
+	server.Healthy = err == nil
+	server.LastError = err
+	server.LastCheck = time.Now()
+}
+
+// candidates returns the order in which servers should be tried for a
+// request.  Healthy servers come first; unhealthy ones are a last resort.
+func (this *Cluster) candidates(write bool) (order []int) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	first := 0
+	switch {
+	case write:
+		first = this.writer
+	case this.options.Selection == SELECTION_ROUND_ROBIN:
+		first = this.next
+		this.next = (this.next + 1) % len(this.servers)
+	}
+
+	var unhealthy []int
+	for x := range this.servers {
+		index := (first + x) % len(this.servers)
+		if this.servers[index].Healthy {
+			order = append(order, index)
+		} else {
+			unhealthy = append(unhealthy, index)
+		}
+	}
+	return append(order, unhealthy...)
+}
+
+// do sends a request made against the cluster address to its servers in
+// turn until one responds, or a write fails after being sent.
+func (this *Cluster) do(ctx context.Context, verb string, reqAddress string, postData []byte) (body []byte, err error) {
+	if !strings.HasPrefix(reqAddress, this.address) {
+		return nil, fmt.Errorf("Unable to %s %s: not an address of cluster %s", verb, reqAddress, this.address)
+	}
+	path := reqAddress[len(this.address):]
+	write := verb != "GET"
+
+	var errs []error
+	for _, index := range this.candidates(write) {
+		status, body, err := this.client.request(ctx, verb, this.servers[index].Address+path, postData)
+		if err == nil || status != 0 {
+			// the server answered, even if with an error
+			this.record(index, nil)
+			if write {
+				this.stickTo(index)
+			}
+			return body, err
+		}
+		this.record(index, err)
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+		if write && !neverSent(err) {
+			return nil, fmt.Errorf("Unable to %s %s on cluster %s, it may have been applied: %w", verb, path, this.address, err)
+		}
+	}
+	return nil, fmt.Errorf("Unable to reach any server of cluster %s: %w", this.address, errors.Join(errs...))
+}
+
+// stickTo makes index the server writes go to.
+func (this *Cluster) stickTo(index int) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.writer = index
+}
+
+/* ex: set noexpandtab: */
@@ -0,0 +1,135 @@
+package goaxle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func clusterAxles(t *testing.T) (a *testAxle, b *testAxle) {
+	responses := map[string]string{
+		"GET /v1/ping":       "pong",
+		"GET /v1/key/alpha":  `{"meta":{"version":1,"status_code":200},"results":{"qps":2,"qpd":10}}`,
+		"POST /v1/key/gamma": `{"meta":{"version":1,"status_code":200},"results":{"qps":2,"qpd":10}}`,
+	}
+	return newTestAxle(t, responses), newTestAxle(t, responses)
+}
+
+func TestClusterRoundRobin(t *testing.T) {
+	a, b := clusterAxles(t)
+	cluster, err := NewCluster("cluster://test-rr/", []string{a.address(), b.address()}, ClusterOptions{})
+	if err != nil {
+		t.Fatalf("Unable to create cluster: %v", err)
+	}
+	cluster.Register()
+	defer cluster.Unregister()
+
+	for x := 0; x < 4; x++ {
+		if _, err := GetKey(cluster.Address(), "alpha"); err != nil {
+			t.Fatalf("Unable to get key: %v", err)
+		}
+	}
+	if a.requestCount() != 2 || b.requestCount() != 2 {
+		t.Fatalf("Reads not spread: %d / %d", a.requestCount(), b.requestCount())
+	}
+
+	// writes stick to one server
+	for x := 0; x < 3; x++ {
+		if err := NewKey(cluster.Address(), "gamma").Save(); err != nil {
+			t.Fatalf("Unable to save key: %v", err)
+		}
+	}
+	if a.requestCount() != 5 || b.requestCount() != 2 {
+		t.Fatalf("Writes not sticky: %d / %d", a.requestCount(), b.requestCount())
+	}
+
+	// a server error doesn't count as a failure to reach the server
+	if _, err := GetKey(cluster.Address(), "missing"); err == nil {
+		t.Fatalf("Expected an error for a missing key")
+	}
+	if a.requestCount()+b.requestCount() != 8 {
+		t.Fatalf("Missing key was retried on another server")
+	}
+}
+
+func TestClusterFailover(t *testing.T) {
+	a, b := clusterAxles(t)
+	dead := httptest.NewServer(nil)
+	dead.Close()
+
+	cluster, err := NewCluster("cluster://test-failover/", []string{dead.URL, a.address(), b.address()}, ClusterOptions{
+		Selection: SELECTION_PRIMARY_SECONDARY,
+	})
+	if err != nil {
+		t.Fatalf("Unable to create cluster: %v", err)
+	}
+	cluster.Register()
+	defer cluster.Unregister()
+
+	if _, err := GetKey(cluster.Address(), "alpha"); err != nil {
+		t.Fatalf("Read didn't fail over: %v", err)
+	}
+	if err := NewKey(cluster.Address(), "gamma").Save(); err != nil {
+		t.Fatalf("Write didn't fail over: %v", err)
+	}
+	status := cluster.Status()
+	if status[0].Healthy || status[0].LastError == nil || !status[1].Healthy {
+		t.Fatalf("Unexpected status: %+v", status)
+	}
+	if a.requestCount() != 2 || b.requestCount() != 0 {
+		t.Fatalf("Requests didn't go to the secondary: %d / %d", a.requestCount(), b.requestCount())
+	}
+
+	// once a is down too, both reads and writes move on to b
+	a.Close()
+	if err := NewKey(cluster.Address(), "gamma").Save(); err != nil {
+		t.Fatalf("Write didn't fail over: %v", err)
+	}
+	if err := Ping(cluster.Address()); err != nil {
+		t.Fatalf("Ping didn't fail over: %v", err)
+	}
+	if b.requestCount() != 2 {
+		t.Fatalf("Expected requests on b, got %d", b.requestCount())
+	}
+
+	if err := cluster.Check(); err == nil {
+		t.Fatalf("Expected health check failures")
+	}
+	status = cluster.Status()
+	if status[0].Healthy || status[1].Healthy || !status[2].Healthy {
+		t.Fatalf("Unexpected status after check: %+v", status)
+	}
+}
+
+func TestClusterWriteNotReplayed(t *testing.T) {
+	// accepts the request, then drops the connection without answering
+	hangUp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer hangUp.Close()
+	a, _ := clusterAxles(t)
+
+	cluster, err := NewCluster("cluster://test-replay/", []string{hangUp.URL, a.address()}, ClusterOptions{
+		Selection: SELECTION_PRIMARY_SECONDARY,
+	})
+	if err != nil {
+		t.Fatalf("Unable to create cluster: %v", err)
+	}
+	cluster.Register()
+	defer cluster.Unregister()
+
+	if err := NewKey(cluster.Address(), "gamma").Save(); err == nil {
+		t.Fatalf("Expected a write without a response to fail")
+	}
+	if a.requestCount() != 0 {
+		t.Fatalf("Write was replayed on another server")
+	}
+	if _, err := GetKey(cluster.Address(), "alpha"); err != nil || a.requestCount() != 1 {
+		t.Fatalf("Read didn't fail over: %v", err)
+	}
+}
+
+/* ex: set noexpandtab: */
@@ -0,0 +1,148 @@
+package goaxle
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule is a parsed five field cron expression: minute, hour, day of
+// month, month and day of week.  Fields accept "*", numbers, ranges
+// ("1-5"), lists ("1,15") and steps ("*/15", "0-30/10").  Day of week runs
+// from 0 (Sunday) to 6, with 7 also meaning Sunday.  As in cron, if both
+// day fields are restricted a day matching either is used.
+type CronSchedule struct {
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+
+	// whether each day field was "*"
+	anyDay     bool
+	anyWeekday bool
+}
+
+// cronShortcuts are the named schedules ParseCron accepts.
+var cronShortcuts = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+// ParseCron parses a cron expression, or one of @hourly, @daily, @weekly,
+// @monthly and @yearly.
+func ParseCron(spec string) (out *CronSchedule, err error) {
+	if shortcut, exists := cronShortcuts[strings.TrimSpace(spec)]; exists {
+		spec = shortcut
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Invalid cron expression \"%s\": expected 5 fields", spec)
+	}
+	out = &CronSchedule{
+		anyDay:     fields[2] == "*",
+		anyWeekday: fields[4] == "*",
+	}
+	bounds := []struct {
+		name   string
+		min    int
+		max    int
+		target *uint64
+	}{
+		{"minute", 0, 59, &out.minutes},
+		{"hour", 0, 23, &out.hours},
+		{"day of month", 1, 31, &out.days},
+		{"month", 1, 12, &out.months},
+		{"day of week", 0, 7, &out.weekdays},
+	}
+	for x, bound := range bounds {
+		*bound.target, err = parseCronField(fields[x], bound.min, bound.max)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cron expression \"%s\": %s %s", spec, bound.name, err)
+		}
+	}
+	// 7 is Sunday too
+	if out.weekdays&(1<<7) != 0 {
+		out.weekdays |= 1
+	}
+	return out, nil
+}
+
+// parseCronField returns a bit set of the values field selects.
+func parseCronField(field string, min int, max int) (set uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("has an invalid step \"%s\"", stepPart)
+			}
+		}
+		low, high := min, max
+		if rangePart != "*" {
+			lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+			if low, err = strconv.Atoi(lowPart); err != nil {
+				return 0, fmt.Errorf("has an invalid value \"%s\"", lowPart)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(highPart); err != nil {
+					return 0, fmt.Errorf("has an invalid value \"%s\"", highPart)
+				}
+			} else if hasStep {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("\"%s\" is outside %d-%d", part, min, max)
+		}
+		for value := low; value <= high; value += step {
+			set |= 1 << uint(value)
+		}
+	}
+	return set, nil
+}
+
+// dayMatches reports whether the date of t is selected.
+func (this *CronSchedule) dayMatches(t time.Time) bool {
+	day := this.days&(1<<uint(t.Day())) != 0
+	weekday := this.weekdays&(1<<uint(t.Weekday())) != 0
+	switch {
+	case this.anyDay && this.anyWeekday:
+		return true
+	case this.anyDay:
+		return weekday
+	case this.anyWeekday:
+		return day
+	}
+	return day || weekday
+}
+
+// Next returns the first time after after selected by the schedule, in the
+// location of after, or the zero time if there is none within five years.
+func (this *CronSchedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := after.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case this.months&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !this.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case this.hours&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case this.minutes&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+/* ex: set noexpandtab: */
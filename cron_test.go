@@ -0,0 +1,48 @@
+package goaxle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// a Tuesday
+	after := time.Date(2013, 9, 24, 10, 7, 30, 0, time.UTC)
+	for spec, expected := range map[string]time.Time{
+		"* * * * *":        time.Date(2013, 9, 24, 10, 8, 0, 0, time.UTC),
+		"*/15 * * * *":     time.Date(2013, 9, 24, 10, 15, 0, 0, time.UTC),
+		"0 9-17 * * 1-5":   time.Date(2013, 9, 24, 11, 0, 0, 0, time.UTC),
+		"0 6 * * 6":        time.Date(2013, 9, 28, 6, 0, 0, 0, time.UTC),
+		"30 2 * * 7":       time.Date(2013, 9, 29, 2, 30, 0, 0, time.UTC),
+		"0 0 1,15 * *":     time.Date(2013, 10, 1, 0, 0, 0, 0, time.UTC),
+		"0 0 31 * *":       time.Date(2013, 10, 31, 0, 0, 0, 0, time.UTC),
+		"0 0 29 2 *":       time.Date(2016, 2, 29, 0, 0, 0, 0, time.UTC),
+		"0 12 13 * 5":      time.Date(2013, 9, 27, 12, 0, 0, 0, time.UTC),
+		"@monthly":         time.Date(2013, 10, 1, 0, 0, 0, 0, time.UTC),
+		"5-20/5 10 24 9 *": time.Date(2013, 9, 24, 10, 10, 0, 0, time.UTC),
+	} {
+		schedule, err := ParseCron(spec)
+		if err != nil {
+			t.Fatalf("Unable to parse %q: %v", spec, err)
+		}
+		if next := schedule.Next(after); !next.Equal(expected) {
+			t.Fatalf("Expected %q to next occur at %v, got %v", spec, expected, next)
+		}
+	}
+
+	schedule, _ := ParseCron("0 0 30 2 *")
+	if next := schedule.Next(after); !next.IsZero() {
+		t.Fatalf("Expected February 30th never to occur, got %v", next)
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *",
+		"* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@often"} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Fatalf("Expected %q to be invalid", spec)
+		}
+	}
+}
+
+/* ex: set noexpandtab: */
@@ -0,0 +1,109 @@
+package goaxle
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Meta is the metadata ApiAxle returns alongside every result.
+type Meta struct {
+	Version    int `json:"version"`
+	StatusCode int `json:"status_code"`
+}
+
+// Envelope is the wrapper around every ApiAxle management response.
+type Envelope[T any] struct {
+	Meta    Meta `json:"meta"`
+	Results T    `json:"results"`
+}
+
+// DecodeEnvelope parses body as an Envelope holding a T.  Responses which
+// are malformed, are missing their results or carry an error status are
+// reported as errors.
+func DecodeEnvelope[T any](body []byte) (envelope *Envelope[T], err error) {
+	raw := struct {
+		Meta    Meta            `json:"meta"`
+		Results json.RawMessage `json:"results"`
+	}{}
+	err = json.Unmarshal(body, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to unmarshal response: %s", err.Error())
+	}
+	if raw.Meta.StatusCode >= 400 {
+		return nil, &statusError{
+			statusCode: raw.Meta.StatusCode,
+			message: fmt.Sprintf(
+				"Server returned status %d: %s",
+				raw.Meta.StatusCode,
+				string(raw.Results),
+			),
+		}
+	}
+	if len(raw.Results) == 0 || bytes.Equal(raw.Results, []byte("null")) {
+		return nil, fmt.Errorf("Response did not contain results")
+	}
+
+	envelope = &Envelope[T]{Meta: raw.Meta}
+	err = json.Unmarshal(raw.Results, &envelope.Results)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to unmarshal results: %s", err.Error())
+	}
+	return envelope, nil
+}
+
+// doResultsRequest performs verb on reqAddress and decodes the results of the
+// response into a T.
+func doResultsRequest[T any](verb string, reqAddress string, postData []byte) (results T, err error) {
+	body, err := doHttpRequest(verb, reqAddress, postData)
+	if err != nil {
+		return results, err
+	}
+	envelope, err := DecodeEnvelope[T](body)
+	if err != nil {
+		return results, fmt.Errorf("Bad response from %s: %s", reqAddress, err.Error())
+	}
+	return envelope.Results, nil
+}
+
+// decodeListing decodes the objects of a resolved listing, keyed by their
+// identifiers, over the defaults provided by create.  The output is sorted by
+// identifier.
+func decodeListing[R Resource](kind Kind, results map[string]json.RawMessage, create func(identifier string) R) (out []R, err error) {
+	identifiers := make([]string, 0, len(results))
+	for identifier := range results {
+		identifiers = append(identifiers, identifier)
+	}
+	sort.Strings(identifiers)
+
+	out = make([]R, 0, len(results))
+	for _, identifier := range identifiers {
+		resource := create(identifier)
+		err = decodeObject(kind, results[identifier], resource)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, resource)
+	}
+	return out, nil
+}
+
+// decodeObject unmarshals a JSON object into object, rejecting any other
+// JSON value.
+func decodeObject(kind Kind, raw json.RawMessage, object interface{}) (err error) {
+	fields := make(map[string]json.RawMessage)
+	err = json.Unmarshal(raw, &fields)
+	if err == nil && fields == nil {
+		err = fmt.Errorf("expected an object but got null")
+	}
+	if err == nil {
+		err = json.Unmarshal(raw, object)
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to decode %s in response: %s", kind, err.Error())
+	}
+	return nil
+}
+
+/* ex: set noexpandtab: */
@@ -0,0 +1,139 @@
+package goaxle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+var envelopeSeeds = []string{
+	`{"meta":{"version":1,"status_code":200},"results":{"weather":{"endPoint":"weather.example.com"}}}`,
+	`{"meta":{"version":1,"status_code":200},"results":{"uncached":{"1380000000":{"200":4}}}}`,
+	`{"meta":{"version":1,"status_code":200},"results":{"new":{"qps":1},"old":{"qps":2}}}`,
+	`{"meta":{"version":1,"status_code":200},"results":{"alpha":"many"}}`,
+	`{"meta":{"version":1,"status_code":404},"results":{"error":{"type":"KeyNotFoundError"}}}`,
+	`{"meta":{"version":1,"status_code":200},"results":true}`,
+	`{"meta":{"version":1,"status_code":200},"results":null}`,
+	`{"meta":"nope","results":[]}`,
+	`{"results":{"uncached":{"soon":{"ok":1}}}}`,
+	`[]`,
+	`pong`,
+	``,
+}
+
+func TestDecodeEnvelope(t *testing.T) {
+	envelope, err := DecodeEnvelope[map[string]int]([]byte(`{"meta":{"version":1,"status_code":200},"results":{"alpha":3}}`))
+	if err != nil {
+		t.Fatalf("Unable to decode: %v", err)
+	}
+	if envelope.Meta.Version != 1 || envelope.Meta.StatusCode != 200 || envelope.Results["alpha"] != 3 {
+		t.Fatalf("Unexpected envelope: %+v", envelope)
+	}
+
+	failures := map[string]string{
+		`{"meta":{"version":1,"status_code":200},"results":{"alpha":"many"}}`:             "Unable to unmarshal results",
+		`{"meta":{"version":1,"status_code":200}}`:                                        "did not contain results",
+		`{"meta":{"version":1,"status_code":404},"results":{"error":{"message":"gone"}}}`: "status 404",
+		`not json`: "Unable to unmarshal response",
+	}
+	for body, expected := range failures {
+		_, err := DecodeEnvelope[map[string]int]([]byte(body))
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Decoding %s gave %v, expected %q", body, err, expected)
+		}
+	}
+
+	_, err = DecodeEnvelope[map[string]int]([]byte(`{"meta":{"version":1,"status_code":404},"results":{"error":{"message":"gone"}}}`))
+	if !IsNotFound(fmt.Errorf("Unable to get key: %w", err)) {
+		t.Errorf("Expected a 404 to be reported as not found, got %v", err)
+	}
+	if IsNotFound(fmt.Errorf("Unable to get key: %w", errors.New("gone"))) {
+		t.Errorf("Expected only 404s to be reported as not found")
+	}
+}
+
+func TestChartsRejectsBadCounts(t *testing.T) {
+	axle := newTestAxle(t, map[string]string{
+		"GET /v1/keys/charts": `{"meta":{"version":1,"status_code":200},"results":{"alpha":"many"}}`,
+	})
+	if _, err := KeysCharts(axle.address(), GRANULARITY_DAYS); err == nil {
+		t.Fatalf("Expected an error for a non-numeric count")
+	}
+}
+
+func TestDecodeStats(t *testing.T) {
+	stats, err := decodeStats([]byte(`{"meta":{"version":1,"status_code":200},"results":{"cached":{},"uncached":{"1380000000":{"200":4,"404":1}}}}`))
+	if err != nil {
+		t.Fatalf("Unable to decode stats: %v", err)
+	}
+	if stats[HIT_TYPE_UNCACHED][time.Unix(1380000000, 0)][404] != 1 {
+		t.Fatalf("Unexpected stats: %v", stats)
+	}
+	if _, err := decodeStats([]byte(`{"results":{"uncached":{"soon":{"200":1}}}}`)); err == nil {
+		t.Fatalf("Expected an error for a bad timestamp")
+	}
+}
+
+func FuzzDecodeEnvelope(f *testing.F) {
+	for _, seed := range envelopeSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		DecodeEnvelope[map[string]interface{}](body)
+		DecodeEnvelope[bool](body)
+		DecodeEnvelope[map[string]int](body)
+
+		envelope, err := DecodeEnvelope[json.RawMessage](body)
+		if err == nil && (len(envelope.Results) == 0 || envelope.Meta.StatusCode >= 400) {
+			t.Fatalf("Accepted an envelope without usable results: %q", body)
+		}
+	})
+}
+
+func FuzzDecodeStats(f *testing.F) {
+	for _, seed := range envelopeSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		stats, err := decodeStats(body)
+		if err != nil {
+			return
+		}
+		for _, timeGroups := range stats {
+			if timeGroups == nil {
+				t.Fatalf("nil time groups from %q", body)
+			}
+		}
+	})
+}
+
+func FuzzPopulateFromResponse(f *testing.F) {
+	for _, seed := range envelopeSeeds {
+		f.Add([]byte(seed), false)
+		f.Add([]byte(seed), true)
+	}
+	f.Fuzz(func(t *testing.T, body []byte, update bool) {
+		var detailsLocation []string
+		if update {
+			detailsLocation = []string{"new"}
+		}
+		api := NewApi("http://localhost/", "fuzz", "")
+		if err := populateFromResponse(KIND_API, api, body, detailsLocation, "endPoint"); err == nil && api.Identifier != "fuzz" {
+			t.Fatalf("Identifier overwritten by %q", body)
+		}
+		populateFromResponse(KIND_KEY, NewKey("http://localhost/", "fuzz"), body, detailsLocation)
+		populateFromResponse(KIND_KEYRING, NewKeyRing("http://localhost/", "fuzz"), body, detailsLocation)
+
+		envelope, err := DecodeEnvelope[map[string]json.RawMessage](body)
+		if err == nil {
+			decodeListing(KIND_KEY, envelope.Results, func(identifier string) *Key {
+				return NewKey("http://localhost/", identifier)
+			})
+		}
+	})
+}
+
+/* ex: set noexpandtab: */
@@ -0,0 +1,295 @@
+package goaxle
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// StatsRow is a single count of hits in long form.
+type StatsRow struct {
+	Timestamp time.Time `json:"timestamp"`
+	Api       string    `json:"api,omitempty"`
+	Key       string    `json:"key,omitempty"`
+	KeyRing   string    `json:"keyring,omitempty"`
+	HitType   HitType   `json:"hitType,omitempty"`
+	Status    int       `json:"status,omitempty"`
+	Count     int       `json:"count"`
+
+	// Granularity the count was recorded at.  Only set by ExportStats.
+	Granularity Granularity `json:"granularity,omitempty"`
+}
+
+// statsRowColumns are the columns written by DelimitedRowWriter.
+var statsRowColumns = []string{"timestamp", "api", "key", "keyring", "hit_type", "status", "count"}
+
+// StatsTarget identifies what a set of stats were recorded against.
+type StatsTarget struct {
+	// The kind of resource the stats are for.
+	Kind Kind
+
+	// Identifier of the resource.
+	Identifier string
+
+	// Optionally restrict the stats to hits against this api.  Ignored for
+	// KIND_API.
+	ForApi string
+
+	// Optionally restrict the stats to hits by this key.  Ignored for
+	// KIND_KEY.
+	ForKey string
+}
+
+// Stats fetches the stats of the target.
+func (this StatsTarget) Stats(axleAddress string, from time.Time, to time.Time, granularity Granularity) (stats map[HitType]map[time.Time]map[int]int, err error) {
+	switch this.Kind {
+	case KIND_API:
+		return ApiStats(axleAddress, this.Identifier, from, to, this.ForKey, granularity)
+	case KIND_KEY:
+		return KeyStats(axleAddress, this.Identifier, from, to, this.ForApi, granularity)
+	case KIND_KEYRING:
+		return KeyRingStats(axleAddress, this.Identifier, from, to, this.ForApi, this.ForKey, granularity)
+	}
+	return nil, fmt.Errorf("Unknown resource kind: %s", this.Kind)
+}
+
+// template returns a row naming the api, key and keyring of the target.
+func (this StatsTarget) template() (template StatsRow) {
+	template = StatsRow{Api: this.ForApi, Key: this.ForKey}
+	switch this.Kind {
+	case KIND_API:
+		template.Api = this.Identifier
+	case KIND_KEY:
+		template.Key = this.Identifier
+	case KIND_KEYRING:
+		template.KeyRing = this.Identifier
+	}
+	return template
+}
+
+// Rows converts stats of the target into rows, ordered by timestamp, hit
+// type and status.
+func (this StatsTarget) Rows(stats map[HitType]map[time.Time]map[int]int) (rows []StatsRow) {
+	template := this.template()
+	for hitType, timeGroups := range stats {
+		for timeGroup, statuses := range timeGroups {
+			for status, count := range statuses {
+				row := template
+				row.Timestamp = timeGroup.UTC()
+				row.HitType = hitType
+				row.Status = status
+				row.Count = count
+				rows = append(rows, row)
+			}
+		}
+	}
+	sortStatsRows(rows)
+	return rows
+}
+
+// ChartRows converts charts, as returned by ApisCharts, KeysCharts,
+// ApiKeyCharts or KeyApiCharts, into rows.  The names in the chart are
+// recorded as apis or keys according to kind, and every row is stamped with
+// at.  Rows are ordered by descending count.
+func ChartRows(charts map[string]int, kind Kind, at time.Time) (rows []StatsRow) {
+	for name, count := range charts {
+		row := StatsRow{Timestamp: at.UTC(), Count: count}
+		if kind == KIND_KEY {
+			row.Key = name
+		} else {
+			row.Api = name
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Count != rows[j].Count {
+			return rows[i].Count > rows[j].Count
+		}
+		return rows[i].Api+rows[i].Key < rows[j].Api+rows[j].Key
+	})
+	return rows
+}
+
+func sortStatsRows(rows []StatsRow) {
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		switch {
+		case !a.Timestamp.Equal(b.Timestamp):
+			return a.Timestamp.Before(b.Timestamp)
+		case a.Api != b.Api:
+			return a.Api < b.Api
+		case a.Key != b.Key:
+			return a.Key < b.Key
+		case a.KeyRing != b.KeyRing:
+			return a.KeyRing < b.KeyRing
+		case a.HitType != b.HitType:
+			return a.HitType < b.HitType
+		case a.Status != b.Status:
+			return a.Status < b.Status
+		}
+		// coarser rows first where an archive holds several
+		return granularitySteps[a.Granularity] > granularitySteps[b.Granularity]
+	})
+}
+
+// RowWriter writes StatsRows in some output format.
+type RowWriter interface {
+	WriteRow(row StatsRow) error
+
+	// Flush writes any buffered rows to the underlying writer.
+	Flush() error
+}
+
+// DelimitedRowWriter writes rows as delimited text, such as CSV, with a
+// header line.  Timestamps are written in RFC 3339 format.
+type DelimitedRowWriter struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+// NewCSVRowWriter returns a RowWriter producing CSV.
+func NewCSVRowWriter(w io.Writer) *DelimitedRowWriter {
+	return NewDelimitedRowWriter(w, ',')
+}
+
+// NewDelimitedRowWriter returns a RowWriter separating columns with
+// delimiter, e.g. '\t' for TSV.
+func NewDelimitedRowWriter(w io.Writer, delimiter rune) *DelimitedRowWriter {
+	writer := csv.NewWriter(w)
+	writer.Comma = delimiter
+	return &DelimitedRowWriter{writer: writer}
+}
+
+func (this *DelimitedRowWriter) WriteRow(row StatsRow) (err error) {
+	if !this.headerWritten {
+		err = this.writer.Write(statsRowColumns)
+		if err != nil {
+			return fmt.Errorf("Unable to write header: %s", err.Error())
+		}
+		this.headerWritten = true
+	}
+	status := ""
+	if row.Status != 0 {
+		status = strconv.Itoa(row.Status)
+	}
+	err = this.writer.Write([]string{
+		row.Timestamp.Format(time.RFC3339),
+		row.Api,
+		row.Key,
+		row.KeyRing,
+		string(row.HitType),
+		status,
+		strconv.Itoa(row.Count),
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to write row: %s", err.Error())
+	}
+	return nil
+}
+
+func (this *DelimitedRowWriter) Flush() error {
+	this.writer.Flush()
+	return this.writer.Error()
+}
+
+// JSONLinesRowWriter writes each row as a line of JSON.
+type JSONLinesRowWriter struct {
+	encoder *json.Encoder
+}
+
+// NewJSONLinesRowWriter returns a RowWriter producing JSON Lines.
+func NewJSONLinesRowWriter(w io.Writer) *JSONLinesRowWriter {
+	return &JSONLinesRowWriter{encoder: json.NewEncoder(w)}
+}
+
+func (this *JSONLinesRowWriter) WriteRow(row StatsRow) (err error) {
+	err = this.encoder.Encode(row)
+	if err != nil {
+		return fmt.Errorf("Unable to write row: %s", err.Error())
+	}
+	return nil
+}
+
+func (this *JSONLinesRowWriter) Flush() error {
+	return nil
+}
+
+// DefaultExportChunks is the length of time fetched per request for each
+// granularity, keeping every request to under a thousand data points.
+var DefaultExportChunks = map[Granularity]time.Duration{
+	GRANULARITY_SECONDS: 10 * time.Minute,
+	GRANULARITY_MINUTES: 12 * time.Hour,
+	GRANULARITY_HOURS:   30 * 24 * time.Hour,
+	GRANULARITY_DAYS:    365 * 24 * time.Hour,
+}
+
+// granularitySteps is the width of the buckets of each granularity.
+var granularitySteps = map[Granularity]time.Duration{
+	GRANULARITY_SECONDS: time.Second,
+	GRANULARITY_MINUTES: time.Minute,
+	GRANULARITY_HOURS:   time.Hour,
+	GRANULARITY_DAYS:    24 * time.Hour,
+}
+
+// ExportOptions configures ExportStats.
+type ExportOptions struct {
+	AxleAddress string
+	Target      StatsTarget
+	From        time.Time
+	To          time.Time
+	Granularity Granularity
+
+	// Length of time fetched per request.  It is rounded up to a whole
+	// number of granularity buckets.  Defaults to the DefaultExportChunks
+	// entry for Granularity.
+	Chunk time.Duration
+}
+
+// ExportStats streams the stats of a target between From and To to w, one
+// chunk at a time, and returns the number of rows written.  Rows are only
+// written for buckets starting within the range.
+func ExportStats(w RowWriter, options ExportOptions) (written int, err error) {
+	step, exists := granularitySteps[options.Granularity]
+	if !exists {
+		return 0, fmt.Errorf("Unknown granularity: %s", options.Granularity)
+	}
+	chunk := options.Chunk
+	if chunk <= 0 {
+		chunk = DefaultExportChunks[options.Granularity]
+	}
+	// keep buckets from straddling two chunks
+	if remainder := chunk % step; remainder != 0 {
+		chunk += step - remainder
+	}
+
+	for start := options.From.Truncate(step); start.Before(options.To); start = start.Add(chunk) {
+		end := start.Add(chunk)
+		if end.After(options.To) {
+			end = options.To
+		}
+		// ApiAxle includes the to time, so stop short of the next chunk
+		stats, err := options.Target.Stats(options.AxleAddress, start, end.Add(-time.Second), options.Granularity)
+		if err != nil {
+			return written, err
+		}
+		for _, row := range options.Target.Rows(stats) {
+			if row.Timestamp.Before(start) || !row.Timestamp.Before(end) {
+				continue
+			}
+			row.Granularity = options.Granularity
+			err = w.WriteRow(row)
+			if err != nil {
+				return written, err
+			}
+			written++
+		}
+	}
+
+	return written, w.Flush()
+}
+
+/* ex: set noexpandtab: */
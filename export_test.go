@@ -0,0 +1,79 @@
+package goaxle
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportStats(t *testing.T) {
+	at := time.Date(2013, 9, 24, 12, 10, 0, 0, time.UTC)
+	axle := newTestAxle(t, map[string]string{
+		"GET /v1/keyring/partners/stats": statsResponse(at, map[int]int{200: 10}, map[int]int{500: 1}),
+	})
+
+	buf := new(bytes.Buffer)
+	written, err := ExportStats(NewCSVRowWriter(buf), ExportOptions{
+		AxleAddress: axle.address(),
+		Target:      StatsTarget{Kind: KIND_KEYRING, Identifier: "partners", ForApi: "weather"},
+		From:        at.Add(-time.Hour).Add(30 * time.Second),
+		To:          at.Add(time.Hour),
+		Granularity: GRANULARITY_MINUTES,
+		Chunk:       29*time.Minute + time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Unable to export: %v", err)
+	}
+	expected := "timestamp,api,key,keyring,hit_type,status,count\n" +
+		"2013-09-24T12:10:00Z,weather,,partners,error,500,1\n" +
+		"2013-09-24T12:10:00Z,weather,,partners,uncached,200,10\n"
+	if written != 2 || buf.String() != expected {
+		t.Fatalf("Unexpected export of %d rows:\n%s", written, buf.String())
+	}
+
+	// chunks are whole minutes, contiguous and don't overlap
+	axle.mu.Lock()
+	defer axle.mu.Unlock()
+	if len(axle.requests) != 4 {
+		t.Fatalf("Expected 4 chunks, got %d", len(axle.requests))
+	}
+	next := at.Add(-time.Hour).Unix()
+	for _, req := range axle.requests {
+		from, _ := strconv.ParseInt(req.URL.Query().Get("from"), 10, 64)
+		to, _ := strconv.ParseInt(req.URL.Query().Get("to"), 10, 64)
+		if from != next || req.URL.Query().Get("forapi") != "weather" {
+			t.Fatalf("Unexpected chunk %s", req.URL.RawQuery)
+		}
+		next = to + 1
+	}
+	if next != at.Add(time.Hour).Unix() {
+		t.Fatalf("Chunks ended at %d", next)
+	}
+}
+
+func TestJSONLinesRowWriter(t *testing.T) {
+	at := time.Date(2013, 9, 24, 0, 0, 0, 0, time.UTC)
+	buf := new(bytes.Buffer)
+	writer := NewJSONLinesRowWriter(buf)
+	for _, row := range ChartRows(map[string]int{"alpha": 3, "beta": 7}, KIND_KEY, at) {
+		if err := writer.WriteRow(row); err != nil {
+			t.Fatalf("Unable to write row: %v", err)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected two lines, got %q", buf.String())
+	}
+	var row StatsRow
+	if err := json.Unmarshal([]byte(lines[0]), &row); err != nil {
+		t.Fatalf("Bad line %q: %v", lines[0], err)
+	}
+	if row.Key != "beta" || row.Count != 7 || !row.Timestamp.Equal(at) {
+		t.Fatalf("Unexpected first row: %+v", row)
+	}
+}
+
+/* ex: set noexpandtab: */
@@ -0,0 +1,177 @@
+package goaxle
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CHARTS_LIMIT is the number of entries ApiAxle returns in charts.
+const CHARTS_LIMIT = 100
+
+// Federation queries several independent ApiAxle deployments, such as one
+// per region, as if they were one.
+type Federation struct {
+	// Addresses of each deployment, keyed by a name for it.
+	clusters map[string]string
+}
+
+// NewFederation creates a Federation over clusters, which maps a name for
+// each deployment to its address.
+func NewFederation(clusters map[string]string) (out *Federation) {
+	out = &Federation{clusters: make(map[string]string, len(clusters))}
+	for name, address := range clusters {
+		out.clusters[name] = address
+	}
+	return out
+}
+
+// FederatedStats holds stats merged from every cluster of a Federation.
+type FederatedStats struct {
+	// Counts summed over every cluster which answered.
+	Total map[HitType]map[time.Time]map[int]int
+
+	// The stats of each cluster which answered.
+	ByCluster map[string]map[HitType]map[time.Time]map[int]int
+
+	// Why each cluster which didn't answer failed.
+	Failures map[string]error
+}
+
+// FederatedCharts holds charts merged from every cluster of a Federation.
+type FederatedCharts struct {
+	// The CHARTS_LIMIT entries with the highest counts summed over every
+	// cluster which answered.
+	Total map[string]int
+
+	// The charts of each cluster which answered.
+	ByCluster map[string]map[string]int
+
+	// Why each cluster which didn't answer failed.
+	Failures map[string]error
+}
+
+// ApiStats gets the stats for an api from every cluster.  See StatsFor.
+func (this *Federation) ApiStats(apiIdentifier string, from time.Time, to time.Time, forkey string, granularity Granularity) (out *FederatedStats, err error) {
+	return this.StatsFor(StatsTarget{Kind: KIND_API, Identifier: apiIdentifier, ForKey: forkey}, from, to, granularity)
+}
+
+// KeyStats gets the stats for a key from every cluster.  See StatsFor.
+func (this *Federation) KeyStats(keyIdentifier string, from time.Time, to time.Time, forapi string, granularity Granularity) (out *FederatedStats, err error) {
+	return this.StatsFor(StatsTarget{Kind: KIND_KEY, Identifier: keyIdentifier, ForApi: forapi}, from, to, granularity)
+}
+
+// StatsFor gets the stats of target from every cluster concurrently and
+// sums them.  Clusters which fail are listed in Failures; an error is only
+// returned if every cluster failed.
+func (this *Federation) StatsFor(target StatsTarget, from time.Time, to time.Time, granularity Granularity) (out *FederatedStats, err error) {
+	results, failures := federate(this, func(address string) (map[HitType]map[time.Time]map[int]int, error) {
+		return target.Stats(address, from, to, granularity)
+	})
+	out = &FederatedStats{
+		Total:     make(map[HitType]map[time.Time]map[int]int),
+		ByCluster: results,
+		Failures:  failures,
+	}
+	for _, stats := range results {
+		mergeStats(out.Total, stats)
+	}
+	return out, this.allFailed(failures)
+}
+
+// ApisCharts gets the most used apis over every cluster.  See Charts.
+func (this *Federation) ApisCharts(granularity Granularity) (out *FederatedCharts, err error) {
+	return this.Charts(func(address string) (map[string]int, error) {
+		return ApisCharts(address, granularity)
+	})
+}
+
+// KeysCharts gets the most used keys over every cluster.  See Charts.
+func (this *Federation) KeysCharts(granularity Granularity) (out *FederatedCharts, err error) {
+	return this.Charts(func(address string) (map[string]int, error) {
+		return KeysCharts(address, granularity)
+	})
+}
+
+// Charts calls charts against every cluster concurrently, sums the counts
+// and re-ranks them.  Clusters which fail are listed in Failures; an error
+// is only returned if every cluster failed.
+func (this *Federation) Charts(charts func(axleAddress string) (map[string]int, error)) (out *FederatedCharts, err error) {
+	results, failures := federate(this, charts)
+	total := make(map[string]int)
+	for _, chart := range results {
+		for name, count := range chart {
+			total[name] += count
+		}
+	}
+	out = &FederatedCharts{
+		Total:     TopCharts(total, CHARTS_LIMIT),
+		ByCluster: results,
+		Failures:  failures,
+	}
+	return out, this.allFailed(failures)
+}
+
+// TopCharts returns the limit entries of charts with the highest counts, as
+// ApiAxle's chart endpoints do.  Ties are broken by name so the result is
+// stable.
+func TopCharts(charts map[string]int, limit int) (out map[string]int) {
+	names := make([]string, 0, len(charts))
+	for name := range charts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if charts[names[i]] != charts[names[j]] {
+			return charts[names[i]] > charts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > limit {
+		names = names[:limit]
+	}
+	out = make(map[string]int, len(names))
+	for _, name := range names {
+		out[name] = charts[name]
+	}
+	return out
+}
+
+// allFailed returns an error joining failures if no cluster answered.
+func (this *Federation) allFailed(failures map[string]error) error {
+	if len(failures) < len(this.clusters) {
+		return nil
+	}
+	errs := make([]error, 0, len(failures))
+	for _, name := range unionKeys(failures, nil) {
+		errs = append(errs, fmt.Errorf("%s: %w", name, failures[name]))
+	}
+	return fmt.Errorf("Every cluster failed: %w", errors.Join(errs...))
+}
+
+// federate calls fetch against every cluster concurrently.
+func federate[T any](this *Federation, fetch func(axleAddress string) (T, error)) (results map[string]T, failures map[string]error) {
+	results = make(map[string]T)
+	failures = make(map[string]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, address := range this.clusters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := fetch(address)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failures[name] = err
+				return
+			}
+			results[name] = result
+		}()
+	}
+	wg.Wait()
+	return results, failures
+}
+
+/* ex: set noexpandtab: */
@@ -0,0 +1,76 @@
+package goaxle
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFederationStats(t *testing.T) {
+	at := time.Unix(1380000000, 0)
+	east := newTestAxle(t, map[string]string{
+		"GET /v1/api/weather/stats": statsResponse(at, map[int]int{200: 10}, map[int]int{500: 1}),
+	})
+	west := newTestAxle(t, map[string]string{
+		"GET /v1/api/weather/stats": statsResponse(at, map[int]int{200: 5, 404: 2}, nil),
+	})
+	down := newTestAxle(t, nil)
+
+	federation := NewFederation(map[string]string{
+		"east": east.address(),
+		"west": west.address(),
+		"down": down.address(),
+	})
+	stats, err := federation.ApiStats("weather", at, at, "", GRANULARITY_MINUTES)
+	if err != nil {
+		t.Fatalf("Unable to get stats: %v", err)
+	}
+	if stats.Total[HIT_TYPE_UNCACHED][at][200] != 15 || stats.Total[HIT_TYPE_UNCACHED][at][404] != 2 ||
+		stats.Total[HIT_TYPE_ERROR][at][500] != 1 {
+		t.Fatalf("Stats not summed: %v", stats.Total)
+	}
+	if stats.ByCluster["west"][HIT_TYPE_UNCACHED][at][200] != 5 || len(stats.ByCluster) != 2 {
+		t.Fatalf("Unexpected breakdown: %v", stats.ByCluster)
+	}
+	if len(stats.Failures) != 1 || stats.Failures["down"] == nil {
+		t.Fatalf("Expected the down cluster to fail: %v", stats.Failures)
+	}
+
+	_, err = NewFederation(map[string]string{"down": down.address()}).KeyStats("alpha", at, at, "", GRANULARITY_MINUTES)
+	if err == nil || !strings.Contains(err.Error(), "down:") {
+		t.Fatalf("Expected an error when every cluster fails, got %v", err)
+	}
+}
+
+func TestFederationCharts(t *testing.T) {
+	chart := func(offset int) string {
+		entries := make([]string, 0, CHARTS_LIMIT)
+		for x := 0; x < CHARTS_LIMIT; x++ {
+			entries = append(entries, fmt.Sprintf(`"key%03d":%d`, x+offset, 1000-x-offset))
+		}
+		return `{"meta":{"version":1,"status_code":200},"results":{` + strings.Join(entries, ",") + `}}`
+	}
+	east := newTestAxle(t, map[string]string{"GET /v1/keys/charts": chart(0)})
+	west := newTestAxle(t, map[string]string{"GET /v1/keys/charts": chart(50)})
+
+	charts, err := NewFederation(map[string]string{
+		"east": east.address(),
+		"west": west.address(),
+	}).KeysCharts(GRANULARITY_DAYS)
+	if err != nil {
+		t.Fatalf("Unable to get charts: %v", err)
+	}
+	if len(charts.Total) != CHARTS_LIMIT {
+		t.Fatalf("Expected %d entries, got %d", CHARTS_LIMIT, len(charts.Total))
+	}
+	// keys in both clusters outrank those in one
+	if charts.Total["key050"] != 950+950 || charts.Total["key000"] != 1000 {
+		t.Fatalf("Unexpected totals: key050=%d key000=%d", charts.Total["key050"], charts.Total["key000"])
+	}
+	if _, exists := charts.Total["key149"]; exists {
+		t.Fatalf("Low ranked key survived the cut")
+	}
+}
+
+/* ex: set noexpandtab: */
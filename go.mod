@@ -0,0 +1,3 @@
+module github.com/rjohnsondev/go-axle
+
+go 1.26.0
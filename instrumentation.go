@@ -0,0 +1,126 @@
+package goaxle
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// RequestInfo describes a management call to instrumentation.
+type RequestInfo struct {
+	// HTTP verb of the request.
+	Verb string
+
+	// Path of the request, with key identifiers redacted.
+	Path string
+
+	// The library call the request was made for, e.g. "Api.Save",
+	// "ApiLinkKey" or "KeyRingStats".
+	Operation string
+
+	// The type of resource targeted: "api", "key", "keyring", or "server"
+	// for calls such as Info and Ping.
+	Resource string
+
+	// Identifier of the targeted resource, if any.  This is not redacted, so
+	// key identifiers appear as is.
+	Identifier string
+}
+
+// Instrumentation is notified around every management call made through a
+// Client.
+type Instrumentation interface {
+	// StartRequest is called before a request is sent.  The returned context
+	// is used for the request and the returned function is called once it
+	// completes, with the HTTP status (0 if no response was received) and
+	// any error.
+	StartRequest(ctx context.Context, info RequestInfo) (context.Context, func(status int, err error))
+}
+
+// operations maps "<resource> <verb> <action>" to the library call which
+// produces it.  Resources ending in "s" are listings.
+var operations = map[string]string{
+	"api GET":               "GetApi",
+	"api POST":              "Api.Save",
+	"api PUT":               "Api.Save",
+	"api DELETE":            "DeleteApi",
+	"api PUT linkkey":       "ApiLinkKey",
+	"api PUT unlinkkey":     "ApiUnlinkKey",
+	"api GET keys":          "ApiKeys",
+	"api GET keycharts":     "ApiKeyCharts",
+	"api GET stats":         "ApiStats",
+	"apis GET":              "Apis",
+	"apis GET charts":       "ApisCharts",
+	"key GET":               "GetKey",
+	"key POST":              "Key.Save",
+	"key PUT":               "Key.Save",
+	"key DELETE":            "DeleteKey",
+	"key GET apis":          "KeyApis",
+	"key GET apicharts":     "KeyApiCharts",
+	"key GET stats":         "KeyStats",
+	"keys GET":              "Keys",
+	"keys GET charts":       "KeysCharts",
+	"keyring GET":           "GetKeyRing",
+	"keyring POST":          "KeyRing.Save",
+	"keyring PUT":           "KeyRing.Save",
+	"keyring DELETE":        "DeleteKeyRing",
+	"keyring PUT linkkey":   "KeyRingLinkKey",
+	"keyring PUT unlinkkey": "KeyRingUnlinkKey",
+	"keyring GET keys":      "KeyRingKeys",
+	"keyring GET stats":     "KeyRingStats",
+	"keyrings GET":          "KeyRings",
+	"info GET":              "Info",
+	"ping GET":              "Ping",
+}
+
+// describeRequest works out which call produced a request from its verb and
+// address.
+func describeRequest(verb string, reqAddress string) (info RequestInfo) {
+	path := strings.Split(requestPath(reqAddress), "?")[0]
+	info = RequestInfo{
+		Verb: verb,
+		Path: Redact(requestPath(reqAddress)),
+	}
+
+	// the server may be mounted below the root, so look for the version
+	if index := strings.Index(path, "/"+VERSION_ENDPOINT); index >= 0 {
+		path = path[index+len(VERSION_ENDPOINT)+1:]
+	}
+	parts := strings.Split(path, "/")
+	resource := parts[0]
+	action := ""
+	switch {
+	case len(parts) >= 3 && (resource == "api" || resource == "key" || resource == "keyring"):
+		action = parts[2]
+	case len(parts) >= 2 && (resource == "apis" || resource == "keys" || resource == "keyrings"):
+		action = parts[1]
+	}
+
+	if len(parts) >= 2 && (resource == "api" || resource == "key" || resource == "keyring") {
+		info.Identifier, _ = url.QueryUnescape(parts[1])
+	}
+
+	name := resource + " " + verb
+	if action != "" {
+		name += " " + action
+	}
+	info.Operation = operations[name]
+	if info.Operation == "" {
+		info.Operation = verb + " " + info.Path
+	}
+
+	switch resource {
+	case "api", "apis":
+		info.Resource = "api"
+	case "key", "keys":
+		info.Resource = "key"
+	case "keyring", "keyrings":
+		info.Resource = "keyring"
+	default:
+		info.Resource = "server"
+	}
+
+	return info
+}
+
+/* ex: set noexpandtab: */
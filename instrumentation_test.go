@@ -0,0 +1,62 @@
+package goaxle
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDescribeRequest(t *testing.T) {
+	cases := []struct {
+		verb       string
+		address    string
+		operation  string
+		resource   string
+		identifier string
+	}{
+		{"PUT", "http://axle/v1/api/weather", "Api.Save", "api", "weather"},
+		{"PUT", "http://axle/v1/api/weather/linkkey/abc", "ApiLinkKey", "api", "weather"},
+		{"GET", "http://axle/v1/keyring/ring%2F1/stats?from=1&to=2", "KeyRingStats", "keyring", "ring/1"},
+		{"GET", "http://axle/v1/keys/charts?granularity=minute", "KeysCharts", "key", ""},
+		{"DELETE", "http://axle/prefix/v1/key/abc", "DeleteKey", "key", "abc"},
+		{"GET", "http://axle/v1/info", "Info", "server", ""},
+	}
+	for _, c := range cases {
+		info := describeRequest(c.verb, c.address)
+		if info.Operation != c.operation || info.Resource != c.resource || info.Identifier != c.identifier {
+			t.Errorf("%s %s: got %+v", c.verb, c.address, info)
+		}
+	}
+}
+
+type recordingInstrumentation struct {
+	started  []RequestInfo
+	statuses []int
+}
+
+func (this *recordingInstrumentation) StartRequest(ctx context.Context, info RequestInfo) (context.Context, func(int, error)) {
+	this.started = append(this.started, info)
+	return ctx, func(status int, err error) {
+		this.statuses = append(this.statuses, status)
+	}
+}
+
+func TestClientInstrumentation(t *testing.T) {
+	axle := newTestAxle(t, map[string]string{
+		"GET /v1/api/weather": `{"meta":{"version":1,"status_code":200},"results":{"endPoint":"weather.example.com"}}`,
+	})
+	instrumentation := new(recordingInstrumentation)
+	RegisterClient(axle.address(), &Client{Instrumentation: instrumentation})
+	defer UnregisterClient(axle.address())
+
+	GetApi(axle.address(), "weather")
+	GetApi(axle.address(), "missing")
+
+	if len(instrumentation.started) != 2 || instrumentation.started[0].Operation != "GetApi" {
+		t.Fatalf("Unexpected requests: %+v", instrumentation.started)
+	}
+	if instrumentation.statuses[0] != 200 || instrumentation.statuses[1] != 404 {
+		t.Fatalf("Unexpected statuses: %v", instrumentation.statuses)
+	}
+}
+
+/* ex: set noexpandtab: */
@@ -1,7 +1,6 @@
 package goaxle
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/url"
 	"time"
@@ -55,37 +54,18 @@ func NewKey(axleAddress string, identifier string) (out *Key) {
 // Create / Update this Key on the ApiAxle server.
 // To modify an existing Key, be sure to retrieve it with GetKey, otherwise
 // the library will attempt to create a new Key of the same name.
+// Unless ValidateBeforeSave is false, Validate is called first.
 func (this *Key) Save() (err error) {
-	reqAddress := fmt.Sprintf(
-		"%s%skey/%s",
-		this.axleAddress,
-		VERSION_ENDPOINT,
-		url.QueryEscape(this.Identifier),
-	)
+	if ValidateBeforeSave {
+		err = this.Validate()
+		if err != nil {
+			return err
+		}
+	}
 
 	// update the updatedAt timestamp
 	this.UpdatedAt = float64(time.Now().UnixNano() / (1000 * 1000))
-	marshalled, err := json.Marshal(this)
-	if err != nil {
-		return fmt.Errorf("Unable to marshal Key: %s", err.Error())
-	}
-
-	httpMethod := "POST"
-	if !this.createOnSave {
-		httpMethod = "PUT"
-	}
-
-	body, err := doHttpRequest(httpMethod, reqAddress, marshalled)
-	if err != nil {
-		return err
-	}
-
-	if !this.createOnSave {
-		err = populateKeyFromResponse(&this, body, []string{"results", "new"})
-	} else {
-		err = populateKeyFromResponse(&this, body, []string{"results"})
-	}
-
+	err = saveResource(this.axleAddress, KIND_KEY, this.Identifier, !this.createOnSave, this)
 	if err != nil {
 		return err
 	}
@@ -97,16 +77,9 @@ func (this *Key) Save() (err error) {
 
 // GetKey retrieves an existing api object from the server.
 func GetKey(axleAddress string, identifier string) (out *Key, err error) {
-
-	reqAddress := fmt.Sprintf("%s%skey/%s", axleAddress, VERSION_ENDPOINT, url.QueryEscape(identifier))
-	body, err := doHttpRequest("GET", reqAddress, nil)
-	if err != nil {
-		return nil, err
-	}
-
 	// unmarshal into our new key object
 	key := NewKey(axleAddress, identifier)
-	err = populateKeyFromResponse(&key, body, []string{"results"})
+	err = getResource(axleAddress, KIND_KEY, identifier, key)
 	if err != nil {
 		return nil, err
 	}
@@ -115,103 +88,50 @@ func GetKey(axleAddress string, identifier string) (out *Key, err error) {
 	return key, err
 }
 
-// populateKeyFromResponse updates the provided Key pointer with the fields
-// provided in the response map.
-func populateKeyFromResponse(key **Key, body []byte, detailsLocation []string) (err error) {
+// Delete removes this Key from the server.
+func (this *Key) Delete() (err error) {
+	return DeleteKey(this.axleAddress, this.Identifier)
+}
 
-	response := make(map[string]interface{})
-	err = json.Unmarshal(body, &response)
+// Refresh reloads this Key from the server, discarding any local changes.
+func (this *Key) Refresh() (err error) {
+	key, err := GetKey(this.axleAddress, this.Identifier)
 	if err != nil {
-		return fmt.Errorf(
-			"Unable to unmarshal response: %s",
-			err.Error(),
-		)
+		return err
 	}
+	*this = *key
+	return nil
+}
 
-	// navigate to the correct spot in the response to read from
-	for _, key := range detailsLocation {
-		resultsInterface, exists := response[key]
-		if !exists {
-			return fmt.Errorf(
-				"Response map did not contain expected key: %s",
-				key,
-			)
-		}
-		var isValidCast bool
-		response, isValidCast = resultsInterface.(map[string]interface{})
-		if !isValidCast {
-			return fmt.Errorf(
-				"key %s did not contain map",
-				key,
-			)
-		}
-	}
+// ID returns the Key identifier.
+func (this *Key) ID() string {
+	return this.Identifier
+}
 
-	// making use of json to populate the object
-	jsonvalue, err := json.Marshal(response)
-	if err != nil {
-		return fmt.Errorf("Unable to decode key in response: %s", err.Error())
-	}
-	err = json.Unmarshal(jsonvalue, key)
-	if err != nil {
-		return fmt.Errorf("Unable to decode key in response: %s", err.Error())
-	}
-	return nil
+// Kind returns KIND_KEY.
+func (this *Key) Kind() Kind {
+	return KIND_KEY
+}
+
+// ParseCreatedAt returns the Key created time as a Go time.Time.
+func (this *Key) ParseCreatedAt() time.Time {
+	return parseFloatToTime(this.CreatedAt)
+}
+
+// ParseUpdatedAt returns the updated time as a Go time.Time.
+func (this *Key) ParseUpdatedAt() time.Time {
+	return parseFloatToTime(this.UpdatedAt)
 }
 
 // String provides a JSON-like formated representation of this Key object
 func (this *Key) String() string {
-	out, err := json.MarshalIndent(this, "", "    ")
-	if err != nil {
-		return "<nil>"
-	}
-	reqAddress := fmt.Sprintf(
-		"%s%skey/%s",
-		this.axleAddress,
-		VERSION_ENDPOINT,
-		url.QueryEscape(this.Identifier),
-	)
-	return fmt.Sprintf("Key - %s: %s", reqAddress, string(out))
+	return formatResource("Key", this.axleAddress, KIND_KEY, this.Identifier, this)
 }
 
 // DeleteKey removes the identified Key.  Any existing objects represting this
 // Key will error on Save().
 func DeleteKey(axleAddress string, identifier string) (err error) {
-	reqAddress := fmt.Sprintf("%s%skey/%s", axleAddress, VERSION_ENDPOINT, url.QueryEscape(identifier))
-
-	body, err := doHttpRequest("DELETE", reqAddress, nil)
-	if err != nil {
-		return err
-	}
-
-	responseMap := make(map[string]interface{})
-	err = json.Unmarshal(body, &responseMap)
-	if err != nil {
-		return fmt.Errorf(
-			"Unable to unmarshal response from %s: %s",
-			reqAddress,
-			err.Error(),
-		)
-	}
-
-	// in this case, our result is what is contained in the "results" key
-	resultsInterface, exists := responseMap["results"]
-	if !exists {
-		return fmt.Errorf("Missing response from %s", reqAddress)
-	}
-	succeeded, isValidCast := resultsInterface.(bool)
-	if !isValidCast {
-		return fmt.Errorf(
-			"Unable to extract response object from %s",
-			reqAddress,
-		)
-	}
-
-	if !succeeded {
-		return fmt.Errorf("Delete of Key at %s failed", reqAddress)
-	}
-
-	return nil
+	return deleteResource(axleAddress, KIND_KEY, identifier)
 }
 
 // ApiCharts lists the top 100 apis for this key and their hit rate for time period granularity.
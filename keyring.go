@@ -38,39 +38,23 @@ func NewKeyRing(axleAddress string, identifier string) (out *KeyRing) {
 // Create / Update this KeyRing on the ApiAxle server.
 // To modify an existing KeyRing, be sure to retrieve it with GetKeyRing, otherwise
 // the library will attempt to create a new KeyRing of the same name.
+// Unless ValidateBeforeSave is false, Validate is called first.
 func (this *KeyRing) Save() (err error) {
-	reqAddress := fmt.Sprintf(
-		"%s%skeyring/%s",
-		this.axleAddress,
-		VERSION_ENDPOINT,
-		url.QueryEscape(this.Identifier),
-	)
-
-	// update the updatedAt timestamp
-	this.UpdatedAt = float64(time.Now().UnixNano() / (1000 * 1000))
-	marshalled, err := json.Marshal(this)
-	if err != nil {
-		return fmt.Errorf("Unable to marshal KeyRing: %s", err.Error())
+	if ValidateBeforeSave {
+		err = this.Validate()
+		if err != nil {
+			return err
+		}
 	}
 
-	httpMethod := "POST"
 	if !this.createOnSave {
-		httpMethod = "PUT"
 		// TODO: why have an last updated field if you can't update it?
 		return fmt.Errorf("Unable to update key rings, it's not yet supported")
 	}
 
-	body, err := doHttpRequest(httpMethod, reqAddress, marshalled)
-	if err != nil {
-		return err
-	}
-
-	if !this.createOnSave {
-		err = populateKeyRingFromResponse(&this, body, []string{"results", "new"})
-	} else {
-		err = populateKeyRingFromResponse(&this, body, []string{"results"})
-	}
-
+	// update the updatedAt timestamp
+	this.UpdatedAt = float64(time.Now().UnixNano() / (1000 * 1000))
+	err = saveResource(this.axleAddress, KIND_KEYRING, this.Identifier, false, this)
 	if err != nil {
 		return err
 	}
@@ -82,16 +66,9 @@ func (this *KeyRing) Save() (err error) {
 
 // GetKeyRing retrieves an existing api object from the server.
 func GetKeyRing(axleAddress string, identifier string) (out *KeyRing, err error) {
-
-	reqAddress := fmt.Sprintf("%s%skeyring/%s", axleAddress, VERSION_ENDPOINT, url.QueryEscape(identifier))
-	body, err := doHttpRequest("GET", reqAddress, nil)
-	if err != nil {
-		return nil, err
-	}
-
 	// unmarshal into our new keyRing object
 	keyRing := NewKeyRing(axleAddress, identifier)
-	err = populateKeyRingFromResponse(&keyRing, body, []string{"results"})
+	err = getResource(axleAddress, KIND_KEYRING, identifier, keyRing)
 	if err != nil {
 		return nil, err
 	}
@@ -100,101 +77,50 @@ func GetKeyRing(axleAddress string, identifier string) (out *KeyRing, err error)
 	return keyRing, err
 }
 
-// populateKeyRingFromResponse updates the provided KeyRing pointer with the fields
-// provided in the response map.
-func populateKeyRingFromResponse(keyRing **KeyRing, body []byte, detailsLocation []string) (err error) {
-	response := make(map[string]interface{})
-	err = json.Unmarshal(body, &response)
-	if err != nil {
-		return fmt.Errorf(
-			"Unable to unmarshal response: %s",
-			err.Error(),
-		)
-	}
+// Delete removes this KeyRing from the server.
+func (this *KeyRing) Delete() (err error) {
+	return DeleteKeyRing(this.axleAddress, this.Identifier)
+}
 
-	// navigate to the correct spot in the response to read from
-	for _, key := range detailsLocation {
-		resultsInterface, exists := response[key]
-		if !exists {
-			return fmt.Errorf(
-				"Response map did not contain expected key: %s",
-				key,
-			)
-		}
-		var isValidCast bool
-		response, isValidCast = resultsInterface.(map[string]interface{})
-		if !isValidCast {
-			return fmt.Errorf(
-				"key %s did not contain map",
-				key,
-			)
-		}
-	}
-	// making use of json to populate the object
-	jsonvalue, err := json.Marshal(response)
-	if err != nil {
-		return fmt.Errorf("Unable to decode keyring in response: %s", err.Error())
-	}
-	err = json.Unmarshal(jsonvalue, keyRing)
+// Refresh reloads this KeyRing from the server, discarding any local changes.
+func (this *KeyRing) Refresh() (err error) {
+	keyRing, err := GetKeyRing(this.axleAddress, this.Identifier)
 	if err != nil {
-		return fmt.Errorf("Unable to decode keyring in response: %s", err.Error())
+		return err
 	}
+	*this = *keyRing
 	return nil
 }
 
+// ID returns the KeyRing identifier.
+func (this *KeyRing) ID() string {
+	return this.Identifier
+}
+
+// Kind returns KIND_KEYRING.
+func (this *KeyRing) Kind() Kind {
+	return KIND_KEYRING
+}
+
+// ParseCreatedAt returns the KeyRing created time as a Go time.Time.
+func (this *KeyRing) ParseCreatedAt() time.Time {
+	return parseFloatToTime(this.CreatedAt)
+}
+
+// ParseUpdatedAt returns the updated time as a Go time.Time.
+func (this *KeyRing) ParseUpdatedAt() time.Time {
+	return parseFloatToTime(this.UpdatedAt)
+}
+
 // String provides a JSON-like formated representation of this KeyRing object
 func (this *KeyRing) String() string {
-	out, err := json.MarshalIndent(this, "", "    ")
-	if err != nil {
-		return "<nil>"
-	}
-	reqAddress := fmt.Sprintf(
-		"%s%skeyring/%s",
-		this.axleAddress,
-		VERSION_ENDPOINT,
-		url.QueryEscape(this.Identifier),
-	)
-	return fmt.Sprintf("KeyRing - %s: %s", reqAddress, string(out))
+	return formatResource("KeyRing", this.axleAddress, KIND_KEYRING, this.Identifier, this)
 }
 
 // DeleteKeyRing removes the identified KeyRing.  Any existing objects represting this
 // KeyRing will error on Save().
 func DeleteKeyRing(axleAddress string, identifier string) (err error) {
-	reqAddress := fmt.Sprintf("%s%skeyring/%s", axleAddress, VERSION_ENDPOINT, url.QueryEscape(identifier))
-
-	body, err := doHttpRequest("DELETE", reqAddress, nil)
-	if err != nil {
-		return err
-	}
-
-	responseMap := make(map[string]interface{})
-	err = json.Unmarshal(body, &responseMap)
-	if err != nil {
-		return fmt.Errorf(
-			"Unable to unmarshal response from %s: %s",
-			reqAddress,
-			err.Error(),
-		)
-	}
-
-	// in this case, our result is what is contained in the "results" keyring
-	resultsInterface, exists := responseMap["results"]
-	if !exists {
-		return fmt.Errorf("Missing response from %s", reqAddress)
-	}
-	succeeded, isValidCast := resultsInterface.(bool)
-	if !isValidCast {
-		return fmt.Errorf(
-			"Unable to extract response object from %s",
-			reqAddress,
-		)
-	}
-
-	if !succeeded {
-		return fmt.Errorf("Delete of KeyRing at %s failed", reqAddress)
-	}
-
-	return nil
+	return deleteResource(axleAddress, KIND_KEYRING, identifier)
 }
 
 // Associate a key with a KEYRING.
@@ -219,7 +145,7 @@ func KeyRingLinkKey(axleAddress string, keyRingIdentifier string, keyIdentifier
 	}
 
 	key = NewKey(axleAddress, keyIdentifier)
-	err = populateKeyFromResponse(&key, body, []string{"results"})
+	err = populateFromResponse(KIND_KEY, key, body, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -249,7 +175,7 @@ func KeyRingUnlinkKey(axleAddress string, keyRingIdentifier string, keyIdentifie
 	}
 
 	key = NewKey(axleAddress, keyIdentifier)
-	err = populateKeyFromResponse(&key, body, []string{"results"})
+	err = populateFromResponse(KIND_KEY, key, body, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -326,44 +252,15 @@ func KeyRings(axleAddress string, from int, to int) (out []*KeyRing, err error)
 		to,
 	)
 
-	body, err := doHttpRequest("GET", reqAddress, nil)
+	results, err := doResultsRequest[map[string]json.RawMessage]("GET", reqAddress, nil)
 	if err != nil {
 		return nil, err
 	}
-
-	response := make(map[string]interface{})
-	err = json.Unmarshal(body, &response)
-	if err != nil {
-		return nil, fmt.Errorf(
-			"Unable to unmarshal response: %s",
-			err.Error(),
-		)
-	}
-	response, validCast := response["results"].(map[string]interface{})
-	if !validCast {
-		return nil, fmt.Errorf(
-			"Unable to unmarshal response: %s",
-			err.Error(),
-		)
-	}
-	out = make([]*KeyRing, len(response))
-	x := 0
-	for identifier, value := range response {
-		keyring := NewKeyRing(axleAddress, identifier)
-		jsonvalue, err := json.Marshal(value)
-		if err != nil {
-			return nil, fmt.Errorf("Unable to decode keyring in response: %s", err.Error())
-		}
-		err = json.Unmarshal(jsonvalue, keyring)
-		if err != nil {
-			return nil, fmt.Errorf("Unable to decode keyring in response: %s", err.Error())
-		}
-		keyring.createOnSave = false
-		out[x] = keyring
-		x++
-	}
-
-	return out, nil
+	return decodeListing(KIND_KEYRING, results, func(identifier string) *KeyRing {
+		keyRing := NewKeyRing(axleAddress, identifier)
+		keyRing.createOnSave = false
+		return keyRing
+	})
 }
 
 /* ex: set noexpandtab: */
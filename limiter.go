@@ -0,0 +1,125 @@
+package goaxle
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Limiter throttles calls to the management API to a steady rate, with a cap
+// on how many may be in flight at once.  A Limiter may be shared between
+// Clients to throttle them together.
+type Limiter struct {
+	// time between requests, zero for no rate limit
+	interval time.Duration
+
+	mu sync.Mutex
+	// earliest time the next request may start
+	next time.Time
+
+	// nil for no concurrency limit
+	slots chan struct{}
+
+	requests      atomic.Int64
+	throttled     atomic.Int64
+	throttledTime atomic.Int64
+}
+
+// LimiterStats reports how much a Limiter has throttled.
+type LimiterStats struct {
+	// Requests which have passed through the Limiter.
+	Requests int64
+	// Requests which had to wait.
+	Throttled int64
+	// Total time requests spent waiting.
+	ThrottledTime time.Duration
+}
+
+// NewLimiter creates a Limiter allowing requestsPerSecond requests to start
+// each second, with at most maxConcurrent in flight.  Zero or less for
+// either disables that limit.
+func NewLimiter(requestsPerSecond float64, maxConcurrent int) (out *Limiter) {
+	out = new(Limiter)
+	if requestsPerSecond > 0 {
+		out.interval = time.Duration(float64(time.Second) / requestsPerSecond)
+	}
+	if maxConcurrent > 0 {
+		out.slots = make(chan struct{}, maxConcurrent)
+	}
+	return out
+}
+
+// Wait blocks until a request may start, or ctx is done.  On success the
+// returned release function must be called once the request completes.
+func (this *Limiter) Wait(ctx context.Context) (release func(), err error) {
+	start := time.Now()
+	defer func() {
+		this.requests.Add(1)
+		if waited := time.Since(start); waited > time.Millisecond {
+			this.throttled.Add(1)
+			this.throttledTime.Add(int64(waited))
+		}
+	}()
+
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if this.slots != nil {
+		select {
+		case this.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release = func() {
+		if this.slots != nil {
+			<-this.slots
+		}
+	}
+
+	// the start time is only claimed once it arrives, so a cancelled wait
+	// never holds up those behind it
+	for {
+		delay := this.claim()
+		if delay <= 0 {
+			return release, nil
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			release()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// claim takes the next start time if it has arrived, returning zero, or
+// otherwise returns how long until it does.
+func (this *Limiter) claim() time.Duration {
+	if this.interval <= 0 {
+		return 0
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	now := time.Now()
+	if now.Before(this.next) {
+		return this.next.Sub(now)
+	}
+	this.next = now.Add(this.interval)
+	return 0
+}
+
+// Stats returns the Limiter's counters.
+func (this *Limiter) Stats() LimiterStats {
+	return LimiterStats{
+		Requests:      this.requests.Load(),
+		Throttled:     this.throttled.Load(),
+		ThrottledTime: time.Duration(this.throttledTime.Load()),
+	}
+}
+
+/* ex: set noexpandtab: */
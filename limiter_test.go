@@ -0,0 +1,116 @@
+package goaxle
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiterRate(t *testing.T) {
+	limiter := NewLimiter(50, 0)
+	start := time.Now()
+	for x := 0; x < 6; x++ {
+		release, err := limiter.Wait(context.Background())
+		if err != nil {
+			t.Fatalf("Wait failed: %v", err)
+		}
+		release()
+	}
+	// the first is free, the other five are spaced 20ms apart
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("Limiter allowed requests too quickly: %v", elapsed)
+	}
+	stats := limiter.Stats()
+	if stats.Requests != 6 || stats.Throttled < 4 || stats.ThrottledTime < 80*time.Millisecond {
+		t.Fatalf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestLimiterConcurrency(t *testing.T) {
+	limiter := NewLimiter(0, 2)
+	var inFlight, peak atomic.Int32
+	var wg sync.WaitGroup
+	for x := 0; x < 8; x++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := limiter.Wait(context.Background())
+			if err != nil {
+				t.Errorf("Wait failed: %v", err)
+				return
+			}
+			defer release()
+			current := inFlight.Add(1)
+			for {
+				seen := peak.Load()
+				if current <= seen || peak.CompareAndSwap(seen, current) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			inFlight.Add(-1)
+		}()
+	}
+	wg.Wait()
+	if peak.Load() > 2 {
+		t.Fatalf("%d requests were in flight at once", peak.Load())
+	}
+}
+
+func TestLimiterCancelFreesStart(t *testing.T) {
+	limiter := NewLimiter(10, 0)
+	start := time.Now()
+	release, err := limiter.Wait(context.Background())
+	if err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.Wait(ctx); err == nil {
+		t.Fatalf("Wait succeeded after cancellation")
+	}
+
+	// the cancelled wait mustn't push this one back another 100ms
+	release, err = limiter.Wait(context.Background())
+	if err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	release()
+	if elapsed := time.Since(start); elapsed > 180*time.Millisecond {
+		t.Fatalf("Cancelled wait delayed the next request: %v", elapsed)
+	}
+}
+
+func TestLimiterCancel(t *testing.T) {
+	axle := newTestAxle(t, map[string]string{"GET /v1/ping": "pong"})
+	limiter := NewLimiter(1, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	RegisterClient(axle.address(), (&Client{Limiter: limiter}).WithContext(ctx))
+	defer UnregisterClient(axle.address())
+
+	if err := Ping(axle.address()); err != nil {
+		t.Fatalf("Unable to ping: %v", err)
+	}
+
+	// the next call has to wait a second, cancelling should free it early
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	if err := Ping(axle.address()); err == nil {
+		t.Fatalf("Ping succeeded after cancellation")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("Cancellation didn't interrupt the wait: %v", elapsed)
+	}
+	if axle.requestCount() != 1 {
+		t.Fatalf("Throttled request still reached the server")
+	}
+}
+
+/* ex: set noexpandtab: */
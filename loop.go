@@ -0,0 +1,40 @@
+package goaxle
+
+import (
+	"context"
+	"time"
+)
+
+// runEvery calls run now and then every interval, defaulting to a minute,
+// sending what it returns on the returned channel.  The channel is closed
+// once ctx is done.
+func runEvery[T any](ctx context.Context, interval time.Duration, run func(now time.Time) []T) <-chan T {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	out := make(chan T)
+	go func() {
+		defer close(out)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			for _, result := range run(time.Now()) {
+				select {
+				case out <- result:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return out
+}
+
+/* ex: set noexpandtab: */
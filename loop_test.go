@@ -0,0 +1,28 @@
+package goaxle
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunEvery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	runs := 0
+	out := runEvery(ctx, time.Millisecond, func(now time.Time) []int {
+		runs++
+		return []int{runs, runs}
+	})
+
+	for _, expected := range []int{1, 1, 2, 2, 3} {
+		if result := <-out; result != expected {
+			t.Fatalf("Expected %d, got %d", expected, result)
+		}
+	}
+	cancel()
+	// drain anything already sent; the channel must then close
+	for range out {
+	}
+}
+
+/* ex: set noexpandtab: */
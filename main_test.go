@@ -0,0 +1,25 @@
+package goaxle_test
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"testing"
+
+	goaxle "github.com/rjohnsondev/go-axle"
+	"github.com/rjohnsondev/go-axle/server"
+)
+
+// TestMain serves an in-memory server at the address TestAll expects, unless
+// a real ApiAxle server is already answering there.
+func TestMain(m *testing.M) {
+	if goaxle.Ping("http://localhost:28902/") != nil {
+		listener, err := net.Listen("tcp", "localhost:28902")
+		if err == nil {
+			go http.Serve(listener, server.New(server.NewMemoryStorage()))
+		}
+	}
+	os.Exit(m.Run())
+}
+
+/* ex: set noexpandtab: */
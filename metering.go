@@ -0,0 +1,235 @@
+package goaxle
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// PriceTier prices the calls in one band of a month's usage.
+type PriceTier struct {
+	// Calls up to and including this many in the month are priced at this
+	// tier, counting from where the previous tier ended.  0 means no upper
+	// bound, and is required on the last tier.
+	UpTo int `json:"upTo"`
+
+	// Price per thousand calls, in the smallest unit of the currency, such
+	// as cents.
+	PerThousand int64 `json:"perThousand"`
+}
+
+// Pricing is a graduated price list: each call is priced by the tier it
+// falls in, so the first calls of a month can be free or cheaper.
+type Pricing struct {
+	Currency string      `json:"currency"`
+	Tiers    []PriceTier `json:"tiers"`
+}
+
+// Validate checks the tiers are in ascending order and that only the last
+// is unbounded.
+func (this *Pricing) Validate() error {
+	if len(this.Tiers) == 0 {
+		return fmt.Errorf("Invalid pricing: at least one tier is required")
+	}
+	previous := 0
+	for x, tier := range this.Tiers {
+		last := x == len(this.Tiers)-1
+		if (tier.UpTo == 0) != last {
+			return fmt.Errorf("Invalid pricing: the last tier, and only the last, must be unbounded")
+		}
+		if tier.UpTo != 0 && tier.UpTo <= previous {
+			return fmt.Errorf("Invalid pricing: tier %d must end after %d calls", x+1, previous)
+		}
+		if tier.PerThousand < 0 {
+			return fmt.Errorf("Invalid pricing: tier %d has a negative price", x+1)
+		}
+		previous = tier.UpTo
+	}
+	return nil
+}
+
+// TierCharge is the part of an invoice line priced at one tier.
+type TierCharge struct {
+	Calls       int   `json:"calls"`
+	PerThousand int64 `json:"perThousand"`
+	Amount      int64 `json:"amount"`
+}
+
+// Price charges calls against the tiers, rounding each tier's amount to the
+// nearest unit.
+func (this *Pricing) Price(calls int) (amount int64, charges []TierCharge) {
+	previous := 0
+	for _, tier := range this.Tiers {
+		if calls <= previous {
+			break
+		}
+		inTier := calls - previous
+		if tier.UpTo != 0 && calls > tier.UpTo {
+			inTier = tier.UpTo - previous
+		}
+		charge := TierCharge{
+			Calls:       inTier,
+			PerThousand: tier.PerThousand,
+			Amount:      (int64(inTier)*tier.PerThousand + 500) / 1000,
+		}
+		charges = append(charges, charge)
+		amount += charge.Amount
+		previous = tier.UpTo
+		if tier.UpTo == 0 {
+			break
+		}
+	}
+	return amount, charges
+}
+
+// InvoiceLine is the billable usage of one key or keyring for a month.
+type InvoiceLine struct {
+	// The month billed, as "2006-01".
+	Month      string `json:"month"`
+	Kind       Kind   `json:"kind"`
+	Identifier string `json:"identifier"`
+	Calls      int    `json:"calls"`
+	Amount     int64  `json:"amount"`
+	Currency   string `json:"currency"`
+
+	Charges []TierCharge `json:"charges"`
+}
+
+// invoiceColumns are the columns written by WriteInvoiceCSV.
+var invoiceColumns = []string{"month", "kind", "identifier", "calls", "amount", "currency"}
+
+// MeterOptions configures Meter.
+type MeterOptions struct {
+	AxleAddress string
+
+	// Any time within the month to bill.  Months are calendar months in
+	// UTC, matching ApiAxle's day buckets.
+	Month time.Time
+
+	// Keys billed individually.
+	Keys []string
+
+	// Keyrings billed as one, with the calls of all their keys counted
+	// together against the tiers.
+	KeyRings []string
+
+	// Don't bill calls answered from ApiAxle's cache.
+	ExcludeCached bool
+
+	// Don't bill calls which failed: ApiAxle errors and responses with a
+	// status of 400 or above.
+	ExcludeErrors bool
+
+	Pricing Pricing
+
+	// Maximum number of requests in flight at once.  Defaults to 4.
+	Concurrency int
+}
+
+// Meter computes the invoice lines of every key and keyring in options,
+// from their daily stats.  Lines are returned keys first, each sorted by
+// identifier.  If any stats can't be fetched the errors are joined and no
+// lines are returned.
+func Meter(options MeterOptions) (lines []InvoiceLine, err error) {
+	if err = options.Pricing.Validate(); err != nil {
+		return nil, err
+	}
+	month := options.Month.UTC()
+	start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+
+	var targets []StatsTarget
+	for _, key := range sortedSet(stringSet(options.Keys)) {
+		targets = append(targets, StatsTarget{Kind: KIND_KEY, Identifier: key})
+	}
+	for _, keyRing := range sortedSet(stringSet(options.KeyRings)) {
+		targets = append(targets, StatsTarget{Kind: KIND_KEYRING, Identifier: keyRing})
+	}
+
+	hitTypes := []HitType{HIT_TYPE_UNCACHED}
+	if !options.ExcludeCached {
+		hitTypes = append(hitTypes, HIT_TYPE_CACHED)
+	}
+	var statusRanges []StatusRange
+	if options.ExcludeErrors {
+		statusRanges = []StatusRange{{0, 399}}
+	} else {
+		hitTypes = append(hitTypes, HIT_TYPE_ERROR)
+	}
+
+	lines = make([]InvoiceLine, len(targets))
+	errs := fanOut(len(targets), options.Concurrency, func(x int) error {
+		target := targets[x]
+		stats, err := target.Stats(options.AxleAddress, start, end.Add(-time.Second), GRANULARITY_DAYS)
+		if err != nil {
+			return fmt.Errorf("Unable to meter %s %s: %s", target.Kind, target.Identifier, err)
+		}
+		calls := 0
+		for _, days := range FilterStats(stats, hitTypes, statusRanges) {
+			for day, statuses := range days {
+				if day.Before(start) || !day.Before(end) {
+					continue
+				}
+				for _, count := range statuses {
+					calls += count
+				}
+			}
+		}
+		amount, charges := options.Pricing.Price(calls)
+		lines[x] = InvoiceLine{
+			Month:      start.Format("2006-01"),
+			Kind:       target.Kind,
+			Identifier: target.Identifier,
+			Calls:      calls,
+			Amount:     amount,
+			Currency:   options.Pricing.Currency,
+			Charges:    charges,
+		}
+		return nil
+	})
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return lines, nil
+}
+
+// WriteInvoiceCSV writes lines as CSV with a header row.  Amounts are in
+// the smallest unit of the currency; tier breakdowns are left out.
+func WriteInvoiceCSV(w io.Writer, lines []InvoiceLine) (err error) {
+	writer := csv.NewWriter(w)
+	writer.Write(invoiceColumns)
+	for _, line := range lines {
+		writer.Write([]string{
+			line.Month,
+			string(line.Kind),
+			line.Identifier,
+			strconv.Itoa(line.Calls),
+			strconv.FormatInt(line.Amount, 10),
+			line.Currency,
+		})
+	}
+	writer.Flush()
+	if err = writer.Error(); err != nil {
+		return fmt.Errorf("Unable to write invoice: %s", err)
+	}
+	return nil
+}
+
+// WriteInvoiceJSON writes lines as a JSON array, including tier breakdowns.
+func WriteInvoiceJSON(w io.Writer, lines []InvoiceLine) (err error) {
+	if lines == nil {
+		lines = []InvoiceLine{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(lines); err != nil {
+		return fmt.Errorf("Unable to write invoice: %s", err)
+	}
+	return nil
+}
+
+/* ex: set noexpandtab: */
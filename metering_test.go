@@ -0,0 +1,120 @@
+package goaxle
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func unix(at time.Time) string {
+	return strconv.FormatInt(at.Unix(), 10)
+}
+
+func TestPricingPrice(t *testing.T) {
+	pricing := Pricing{Currency: "USD", Tiers: []PriceTier{
+		{UpTo: 1000, PerThousand: 0},
+		{UpTo: 11000, PerThousand: 50},
+		{PerThousand: 20},
+	}}
+	if err := pricing.Validate(); err != nil {
+		t.Fatalf("Unexpected invalid pricing: %v", err)
+	}
+	for calls, expected := range map[int]int64{0: 0, 900: 0, 2000: 50, 11000: 500, 61000: 1500} {
+		if amount, _ := pricing.Price(calls); amount != expected {
+			t.Fatalf("Expected %d calls to cost %d, got %d", calls, expected, amount)
+		}
+	}
+	_, charges := pricing.Price(12500)
+	if len(charges) != 3 || charges[0].Calls != 1000 || charges[1].Calls != 10000 || charges[2].Calls != 1500 || charges[2].Amount != 30 {
+		t.Fatalf("Unexpected charges: %+v", charges)
+	}
+
+	for _, tiers := range [][]PriceTier{
+		nil,
+		{{UpTo: 1000, PerThousand: 1}},
+		{{PerThousand: 1}, {PerThousand: 2}},
+		{{UpTo: 1000, PerThousand: 1}, {UpTo: 500, PerThousand: 1}, {PerThousand: 1}},
+		{{PerThousand: -1}},
+	} {
+		if err := (&Pricing{Tiers: tiers}).Validate(); err == nil {
+			t.Fatalf("Expected tiers %+v to be invalid", tiers)
+		}
+	}
+}
+
+func TestMeter(t *testing.T) {
+	day := time.Date(2013, 9, 24, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2013, 8, 31, 0, 0, 0, 0, time.UTC)
+	axle := newTestAxle(t, map[string]string{
+		"GET /v1/key/alpha/stats": `{"meta":{"version":1,"status_code":200},"results":{
+			"cached":{"` + unix(day) + `":{"200":1000}},
+			"uncached":{"` + unix(day) + `":{"200":2000,"404":500},"` + unix(before) + `":{"200":99999}},
+			"error":{"` + unix(day) + `":{"429":100}}}}`,
+		"GET /v1/keyring/partners/stats": statsResponse(day, map[int]int{200: 4000}, nil),
+	})
+	options := MeterOptions{
+		AxleAddress: axle.address(),
+		Month:       day.Add(5 * time.Hour),
+		Keys:        []string{"alpha"},
+		KeyRings:    []string{"partners"},
+		Pricing:     Pricing{Currency: "EUR", Tiers: []PriceTier{{UpTo: 1000, PerThousand: 0}, {PerThousand: 100}}},
+	}
+
+	lines, err := Meter(options)
+	if err != nil {
+		t.Fatalf("Unable to meter: %v", err)
+	}
+	if len(lines) != 2 || lines[0].Identifier != "alpha" || lines[0].Calls != 3600 || lines[0].Amount != 260 ||
+		lines[0].Month != "2013-09" || lines[0].Currency != "EUR" {
+		t.Fatalf("Unexpected lines: %+v", lines)
+	}
+	if lines[1].Kind != KIND_KEYRING || lines[1].Calls != 4000 || lines[1].Amount != 300 {
+		t.Fatalf("Unexpected keyring line: %+v", lines[1])
+	}
+	axle.mu.Lock()
+	request := axle.requests[0].URL.Query()
+	axle.mu.Unlock()
+	if request.Get("granularity") != string(GRANULARITY_DAYS) || request.Get("from") != unix(time.Date(2013, 9, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Unexpected stats request: %v", request)
+	}
+
+	options.ExcludeCached = true
+	options.ExcludeErrors = true
+	lines, err = Meter(options)
+	if err != nil || lines[0].Calls != 2000 {
+		t.Fatalf("Expected only successful uncached calls, got %+v %v", lines, err)
+	}
+
+	options.Keys = append(options.Keys, "missing")
+	if _, err := Meter(options); err == nil || !strings.Contains(err.Error(), "key missing") {
+		t.Fatalf("Expected an error metering a missing key, got %v", err)
+	}
+}
+
+func TestWriteInvoice(t *testing.T) {
+	lines := []InvoiceLine{{
+		Month: "2013-09", Kind: KIND_KEY, Identifier: "alpha", Calls: 3600, Amount: 260, Currency: "EUR",
+		Charges: []TierCharge{{Calls: 1000}, {Calls: 2600, PerThousand: 100, Amount: 260}},
+	}}
+	var out bytes.Buffer
+	if err := WriteInvoiceCSV(&out, lines); err != nil {
+		t.Fatalf("Unable to write CSV: %v", err)
+	}
+	if out.String() != "month,kind,identifier,calls,amount,currency\n2013-09,key,alpha,3600,260,EUR\n" {
+		t.Fatalf("Unexpected CSV: %q", out.String())
+	}
+
+	out.Reset()
+	if err := WriteInvoiceJSON(&out, lines); err != nil {
+		t.Fatalf("Unable to write JSON: %v", err)
+	}
+	var decoded []InvoiceLine
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || len(decoded[0].Charges) != 2 {
+		t.Fatalf("Unexpected JSON %s: %v", out.String(), err)
+	}
+}
+
+/* ex: set noexpandtab: */
@@ -0,0 +1,58 @@
+package goaxle
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// loadJSONFile decodes the JSON file at path into out, leaving out alone if
+// the file doesn't exist yet.  what names the contents in errors.
+func loadJSONFile(path string, what string, out interface{}) (err error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to open %s: %s", what, err)
+	}
+	if err = json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("Unable to read %s: %s", what, err)
+	}
+	return nil
+}
+
+// saveJSONFile replaces the file at path with value as indented JSON.  what
+// names the contents in errors.
+func saveJSONFile(path string, what string, value interface{}) (err error) {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Unable to save %s: %s", what, err)
+	}
+	if err = writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("Unable to save %s: %s", what, err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces the file at path with data, so readers never
+// see it partly written.
+func writeFileAtomic(path string, data []byte) (err error) {
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+/* ex: set noexpandtab: */
@@ -0,0 +1,198 @@
+package goaxle
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Plan is a tier of service, such as "free" or "pro", which keys are
+// assigned to.  Every key on a plan has its limits, is linked with its apis
+// and belongs to its keyring.
+type Plan struct {
+	Name string `json:"name"`
+
+	// Limits given to keys on the plan.  -1 means no limit.
+	Qps int `json:"qps"`
+	Qpd int `json:"qpd"`
+
+	// Apis keys on the plan may call.
+	Apis []string `json:"apis"`
+
+	// Keyring holding the keys on the plan.  Plans without a keyring can be
+	// assigned but not audited, as there is no record of which keys are on
+	// them.
+	KeyRing string `json:"keyRing,omitempty"`
+}
+
+// Validate checks the plan could be applied to a key.
+func (this *Plan) Validate() error {
+	if this.Name == "" {
+		return fmt.Errorf("Invalid plan: name is required")
+	}
+	if this.Qps < -1 || this.Qps == 0 || this.Qpd < -1 || this.Qpd == 0 {
+		return fmt.Errorf("Invalid plan %s: qps and qpd must be positive or -1", this.Name)
+	}
+	return nil
+}
+
+// AssignPlan puts a key on plan, setting its limits and linking it with the
+// plan's apis and keyring.  Existing links are left alone.
+func AssignPlan(axleAddress string, keyIdentifier string, plan *Plan) (err error) {
+	return MovePlan(axleAddress, keyIdentifier, nil, plan)
+}
+
+// MovePlan moves a key from one plan to another.  As well as what
+// AssignPlan does, apis only on the old plan are unlinked and the key
+// leaves the old plan's keyring.  If from is nil this is AssignPlan.
+//
+// Changes are made one at a time; if one fails the error says which, and
+// the move can be retried.
+func MovePlan(axleAddress string, keyIdentifier string, from *Plan, to *Plan) (err error) {
+	if err = to.Validate(); err != nil {
+		return err
+	}
+	key, err := GetKey(axleAddress, keyIdentifier)
+	if err != nil {
+		return fmt.Errorf("Unable to move key %s to plan %s: %s", keyIdentifier, to.Name, err)
+	}
+	linked, err := KeyApis(axleAddress, keyIdentifier)
+	if err != nil {
+		return fmt.Errorf("Unable to move key %s to plan %s: %s", keyIdentifier, to.Name, err)
+	}
+	isLinked := make(map[string]bool, len(linked))
+	for _, api := range linked {
+		isLinked[api.Identifier] = true
+	}
+
+	if key.Qps != to.Qps || key.Qpd != to.Qpd {
+		key.Qps, key.Qpd = to.Qps, to.Qpd
+		if err = key.Save(); err != nil {
+			return fmt.Errorf("Unable to set limits of key %s for plan %s: %s", keyIdentifier, to.Name, err)
+		}
+	}
+
+	wanted := stringSet(to.Apis)
+	for _, api := range sortedSet(wanted) {
+		if !isLinked[api] {
+			if _, err = ApiLinkKey(axleAddress, api, keyIdentifier); err != nil {
+				return fmt.Errorf("Unable to link key %s with api %s for plan %s: %s", keyIdentifier, api, to.Name, err)
+			}
+		}
+	}
+	if from != nil {
+		for _, api := range sortedSet(stringSet(from.Apis)) {
+			if isLinked[api] && !wanted[api] {
+				if _, err = ApiUnlinkKey(axleAddress, api, keyIdentifier); err != nil {
+					return fmt.Errorf("Unable to unlink key %s from api %s for plan %s: %s", keyIdentifier, api, to.Name, err)
+				}
+			}
+		}
+	}
+
+	if to.KeyRing != "" {
+		if _, err = KeyRingLinkKey(axleAddress, to.KeyRing, keyIdentifier); err != nil {
+			return fmt.Errorf("Unable to add key %s to keyring %s for plan %s: %s", keyIdentifier, to.KeyRing, to.Name, err)
+		}
+	}
+	if from != nil && from.KeyRing != "" && from.KeyRing != to.KeyRing {
+		if _, err = KeyRingUnlinkKey(axleAddress, from.KeyRing, keyIdentifier); err != nil {
+			return fmt.Errorf("Unable to remove key %s from keyring %s for plan %s: %s", keyIdentifier, from.KeyRing, to.Name, err)
+		}
+	}
+	return nil
+}
+
+// PlanDrift describes how a key differs from its plan.
+type PlanDrift struct {
+	Key  string
+	Plan string
+
+	// Limits which differ, Old being the key's and New the plan's.
+	Changes []FieldChange
+
+	// Apis of the plan the key isn't linked with.
+	MissingApis []string
+
+	// Apis the key is linked with which aren't on the plan.
+	ExtraApis []string
+
+	// Other plans whose keyrings also hold the key.
+	OtherPlans []string
+}
+
+// AuditPlans finds every key on one of plans, by keyring membership, which
+// has drifted from it.  Load snapshot with LoadSnapshot.  Keys on more than
+// one plan are reported against each.
+func AuditPlans(snapshot *Snapshot, plans []*Plan) (drifts []PlanDrift, err error) {
+	keyPlans := make(map[string][]string)
+	for _, plan := range plans {
+		if plan.KeyRing == "" {
+			continue
+		}
+		if _, exists := snapshot.KeyRings[plan.KeyRing]; !exists {
+			return nil, fmt.Errorf("Unable to audit plan %s: keyring %s doesn't exist", plan.Name, plan.KeyRing)
+		}
+		for _, key := range snapshot.KeyRingKeys[plan.KeyRing] {
+			keyPlans[key] = append(keyPlans[key], plan.Name)
+		}
+	}
+
+	for _, plan := range plans {
+		if plan.KeyRing == "" {
+			continue
+		}
+		wanted := stringSet(plan.Apis)
+		for _, identifier := range sortedSet(stringSet(snapshot.KeyRingKeys[plan.KeyRing])) {
+			key, exists := snapshot.Keys[identifier]
+			if !exists {
+				continue
+			}
+			drift := PlanDrift{Key: identifier, Plan: plan.Name}
+			if key.Qps != plan.Qps {
+				drift.Changes = append(drift.Changes, FieldChange{Field: "qps", Old: key.Qps, New: plan.Qps})
+			}
+			if key.Qpd != plan.Qpd {
+				drift.Changes = append(drift.Changes, FieldChange{Field: "qpd", Old: key.Qpd, New: plan.Qpd})
+			}
+			linked := stringSet(snapshot.KeyApis[identifier])
+			for _, api := range sortedSet(wanted) {
+				if !linked[api] {
+					drift.MissingApis = append(drift.MissingApis, api)
+				}
+			}
+			for _, api := range sortedSet(linked) {
+				if !wanted[api] {
+					drift.ExtraApis = append(drift.ExtraApis, api)
+				}
+			}
+			for _, other := range keyPlans[identifier] {
+				if other != plan.Name {
+					drift.OtherPlans = append(drift.OtherPlans, other)
+				}
+			}
+			if len(drift.Changes) > 0 || len(drift.MissingApis) > 0 || len(drift.ExtraApis) > 0 || len(drift.OtherPlans) > 0 {
+				drifts = append(drifts, drift)
+			}
+		}
+	}
+	return drifts, nil
+}
+
+func stringSet(values []string) (out map[string]bool) {
+	out = make(map[string]bool, len(values))
+	for _, value := range values {
+		out[value] = true
+	}
+	return out
+}
+
+func sortedSet(set map[string]bool) (out []string) {
+	out = make([]string, 0, len(set))
+	for value := range set {
+		out = append(out, value)
+	}
+	sort.Strings(out)
+	return out
+}
+
+/* ex: set noexpandtab: */
@@ -0,0 +1,99 @@
+package goaxle
+
+import (
+	"testing"
+)
+
+func TestMovePlan(t *testing.T) {
+	axle := newTestAxle(t, map[string]string{
+		"GET /v1/key/beta": `{"meta":{"version":1,"status_code":200},"results":{"qps":2,"qpd":1000}}`,
+		"GET /v1/key/beta/apis": `{"meta":{"version":1,"status_code":200},"results":{
+			"weather":{"endPoint":"weather.example.com"},"legacy":{"endPoint":"legacy.example.com"}}}`,
+		"PUT /v1/key/beta":                    `{"meta":{"version":1,"status_code":200},"results":{"new":{"qps":20,"qpd":100000},"old":{"qps":2,"qpd":1000}}}`,
+		"PUT /v1/api/maps/linkkey/beta":       `{"meta":{"version":1,"status_code":200},"results":{"qps":20,"qpd":100000}}`,
+		"PUT /v1/api/legacy/unlinkkey/beta":   `{"meta":{"version":1,"status_code":200},"results":{"qps":20,"qpd":100000}}`,
+		"PUT /v1/keyring/pro/linkkey/beta":    `{"meta":{"version":1,"status_code":200},"results":{"qps":20,"qpd":100000}}`,
+		"PUT /v1/keyring/free/unlinkkey/beta": `{"meta":{"version":1,"status_code":200},"results":{"qps":20,"qpd":100000}}`,
+	})
+	free := &Plan{Name: "free", Qps: 2, Qpd: 1000, Apis: []string{"weather", "legacy"}, KeyRing: "free"}
+	pro := &Plan{Name: "pro", Qps: 20, Qpd: 100000, Apis: []string{"weather", "maps"}, KeyRing: "pro"}
+
+	if err := MovePlan(axle.address(), "beta", free, pro); err != nil {
+		t.Fatalf("Unable to move plan: %v", err)
+	}
+	expected := []string{
+		"PUT /v1/key/beta",
+		"PUT /v1/api/maps/linkkey/beta",
+		"PUT /v1/api/legacy/unlinkkey/beta",
+		"PUT /v1/keyring/pro/linkkey/beta",
+		"PUT /v1/keyring/free/unlinkkey/beta",
+	}
+	got := writes(axle)
+	if len(got) != len(expected) {
+		t.Fatalf("Expected writes %v, got %v", expected, got)
+	}
+	for x := range expected {
+		if got[x] != expected[x] {
+			t.Fatalf("Expected writes %v, got %v", expected, got)
+		}
+	}
+
+	axle.remove("PUT /v1/api/maps/linkkey/beta")
+	if err := AssignPlan(axle.address(), "beta", pro); err == nil {
+		t.Fatalf("Expected an error when linking fails")
+	}
+	if err := AssignPlan(axle.address(), "beta", &Plan{Name: "broken", Qps: 0, Qpd: 10}); err == nil {
+		t.Fatalf("Expected an invalid plan to be refused")
+	}
+}
+
+func TestAuditPlans(t *testing.T) {
+	snapshot := &Snapshot{
+		Keys: map[string]*Key{
+			"alpha": {Identifier: "alpha", Qps: 2, Qpd: 1000},
+			"beta":  {Identifier: "beta", Qps: 5, Qpd: 1000},
+			"gamma": {Identifier: "gamma", Qps: 20, Qpd: 100000},
+		},
+		KeyRings: map[string]*KeyRing{"free": {Identifier: "free"}, "pro": {Identifier: "pro"}},
+		KeyApis: map[string][]string{
+			"alpha": {"weather"},
+			"beta":  {"weather", "maps"},
+			"gamma": {"weather"},
+		},
+		KeyRingKeys: map[string][]string{
+			"free": {"alpha", "beta", "gamma"},
+			"pro":  {"gamma"},
+		},
+	}
+	plans := []*Plan{
+		{Name: "free", Qps: 2, Qpd: 1000, Apis: []string{"weather"}, KeyRing: "free"},
+		{Name: "pro", Qps: 20, Qpd: 100000, Apis: []string{"weather", "maps"}, KeyRing: "pro"},
+	}
+	drifts, err := AuditPlans(snapshot, plans)
+	if err != nil {
+		t.Fatalf("Unable to audit: %v", err)
+	}
+	// alpha matches free; beta has qps 5 and an extra api; gamma is on both
+	// plans, matching neither
+	if len(drifts) != 3 {
+		t.Fatalf("Expected 3 drifts, got %+v", drifts)
+	}
+	beta := drifts[0]
+	if beta.Key != "beta" || len(beta.Changes) != 1 || beta.Changes[0].Field != "qps" || beta.Changes[0].Old != 5 ||
+		len(beta.ExtraApis) != 1 || beta.ExtraApis[0] != "maps" {
+		t.Fatalf("Unexpected drift for beta: %+v", beta)
+	}
+	if drifts[1].Key != "gamma" || drifts[1].Plan != "free" || len(drifts[1].OtherPlans) != 1 {
+		t.Fatalf("Unexpected drift for gamma on free: %+v", drifts[1])
+	}
+	if drifts[2].Plan != "pro" || len(drifts[2].MissingApis) != 1 || drifts[2].MissingApis[0] != "maps" || len(drifts[2].Changes) != 0 {
+		t.Fatalf("Unexpected drift for gamma on pro: %+v", drifts[2])
+	}
+
+	plans = append(plans, &Plan{Name: "gone", Qps: 1, Qpd: 1, KeyRing: "missing"})
+	if _, err := AuditPlans(snapshot, plans); err == nil {
+		t.Fatalf("Expected an error auditing a plan without its keyring")
+	}
+}
+
+/* ex: set noexpandtab: */
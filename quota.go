@@ -0,0 +1,343 @@
+package goaxle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Limit a quota alert refers to.
+type QuotaLimit string
+
+const (
+	QUOTA_LIMIT_QPD QuotaLimit = "qpd"
+	QUOTA_LIMIT_QPS QuotaLimit = "qps"
+)
+
+// QuotaUsage describes how much of its limits a key has consumed.
+type QuotaUsage struct {
+	// Identifier of the key.
+	Key string `json:"key"`
+
+	// Start of the day the usage covers.  Days start at midnight UTC, as
+	// ApiAxle's do, but are given in the monitor's Location.
+	Day time.Time `json:"day"`
+
+	// Calls made so far today, and the key's daily limit.
+	Calls int `json:"calls"`
+	Qpd   int `json:"qpd"`
+	// Percentage of Qpd used, or -1 if the key has no daily limit.
+	QpdPercent float64 `json:"qpdPercent"`
+
+	// Busiest second in the sampled window, and the key's per second limit.
+	PeakQps int `json:"peakQps"`
+	Qps     int `json:"qps"`
+	// Percentage of Qps used at peak, or -1 if the key has no per second
+	// limit or it wasn't sampled.
+	QpsPercent float64 `json:"qpsPercent"`
+}
+
+// QuotaAlert is raised the first time each day a key crosses a threshold.
+type QuotaAlert struct {
+	Usage     QuotaUsage `json:"usage"`
+	Limit     QuotaLimit `json:"limit"`
+	Threshold float64    `json:"threshold"`
+}
+
+// KeyQuotaUsage computes the usage of key for the UTC day containing now,
+// which is the day ApiAxle resets Qpd on.  The day is reported in loc.  If
+// qpsWindow is non-zero, the busiest second over that window before now is
+// used to compute the per second usage.
+func KeyQuotaUsage(axleAddress string, key *Key, now time.Time, loc *time.Location, qpsWindow time.Duration) (usage *QuotaUsage, err error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	utc := now.UTC()
+	dayStart := time.Date(utc.Year(), utc.Month(), utc.Day(), 0, 0, 0, 0, time.UTC)
+
+	usage = &QuotaUsage{
+		Key:        key.Identifier,
+		Day:        dayStart.In(loc),
+		Qpd:        key.Qpd,
+		Qps:        key.Qps,
+		QpdPercent: -1,
+		QpsPercent: -1,
+	}
+
+	daily, err := KeyStats(axleAddress, key.Identifier, dayStart, now, "", GRANULARITY_DAYS)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get daily usage for key %s: %s", key.Identifier, err)
+	}
+	for _, timeGroups := range daily {
+		for timeGroup, counts := range timeGroups {
+			if timeGroup.Before(dayStart) {
+				continue
+			}
+			for _, count := range counts {
+				usage.Calls += count
+			}
+		}
+	}
+	if key.Qpd > 0 {
+		usage.QpdPercent = float64(usage.Calls) * 100 / float64(key.Qpd)
+	}
+
+	if qpsWindow > 0 {
+		perSecond, err := KeyStats(axleAddress, key.Identifier, now.Add(-qpsWindow), now, "", GRANULARITY_SECONDS)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to get per second usage for key %s: %s", key.Identifier, err)
+		}
+		totals := make(map[time.Time]int)
+		for _, timeGroups := range perSecond {
+			for timeGroup, counts := range timeGroups {
+				for _, count := range counts {
+					totals[timeGroup] += count
+				}
+			}
+		}
+		for _, total := range totals {
+			if total > usage.PeakQps {
+				usage.PeakQps = total
+			}
+		}
+		if key.Qps > 0 {
+			usage.QpsPercent = float64(usage.PeakQps) * 100 / float64(key.Qps)
+		}
+	}
+
+	return usage, nil
+}
+
+// QuotaMonitorOptions configures a QuotaMonitor.
+type QuotaMonitorOptions struct {
+	// Address of the ApiAxle server.
+	AxleAddress string
+
+	// Identifiers of the keys to monitor.  Empty means every key.
+	Keys []string
+
+	// Percentages of a limit at which to alert.  Defaults to 80 and 100.
+	Thresholds []float64
+
+	// How far back to look for the busiest second when checking Qps.  Zero
+	// only checks Qpd.
+	QpsWindow time.Duration
+
+	// The time zone QuotaUsage.Day is given in.  Defaults to UTC.  Days
+	// always start at midnight UTC, when ApiAxle resets Qpd.
+	Location *time.Location
+
+	// Called once for every alert.
+	OnAlert func(QuotaAlert)
+
+	// If set, every alert is POSTed here as JSON.  Alerts which couldn't be
+	// delivered are retried on each check until the end of their day.
+	WebhookURL string
+
+	// Timeout for each webhook delivery.  Defaults to 10 seconds.
+	WebhookTimeout time.Duration
+}
+
+// QuotaMonitor compares key usage with their limits and raises each alert
+// at most once per key, limit and threshold per day.
+type QuotaMonitor struct {
+	options QuotaMonitorOptions
+	webhook *http.Client
+
+	mu sync.Mutex
+	// alert identity -> day it last fired
+	fired map[string]time.Time
+	// alerts still to be delivered to the webhook
+	undelivered []QuotaAlert
+}
+
+// NewQuotaMonitor creates a QuotaMonitor with defaults applied.
+func NewQuotaMonitor(options QuotaMonitorOptions) (out *QuotaMonitor) {
+	if len(options.Thresholds) == 0 {
+		options.Thresholds = []float64{80, 100}
+	}
+	options.Thresholds = append([]float64(nil), options.Thresholds...)
+	sort.Float64s(options.Thresholds)
+	if options.Location == nil {
+		options.Location = time.UTC
+	}
+	if options.WebhookTimeout == 0 {
+		options.WebhookTimeout = 10 * time.Second
+	}
+	out = &QuotaMonitor{
+		options: options,
+		webhook: &http.Client{Timeout: options.WebhookTimeout},
+		fired:   make(map[string]time.Time),
+	}
+	return out
+}
+
+// Check computes the usage of every monitored key as of now and raises any
+// new alerts.  Usage is returned for every key that could be checked, along
+// with any errors encountered.
+func (this *QuotaMonitor) Check(now time.Time) (usages []*QuotaUsage, err error) {
+	keys, err := this.keys()
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, key := range keys {
+		usage, err := KeyQuotaUsage(this.options.AxleAddress, key, now, this.options.Location, this.options.QpsWindow)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		usages = append(usages, usage)
+		for _, alert := range this.newAlerts(usage) {
+			this.raise(alert)
+		}
+	}
+	errs = append(errs, this.deliver(now)...)
+
+	return usages, errors.Join(errs...)
+}
+
+// Run calls Check every interval until ctx is done.  Errors from individual
+// checks are passed to onError, which may be nil.
+func (this *QuotaMonitor) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := this.Check(time.Now()); err != nil && onError != nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (this *QuotaMonitor) keys() (keys []*Key, err error) {
+	if len(this.options.Keys) == 0 {
+		keys, err = listAll(func(from int, to int) ([]*Key, error) {
+			return Keys(this.options.AxleAddress, from, to)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Unable to list keys: %s", err)
+		}
+		return keys, nil
+	}
+	for _, identifier := range this.options.Keys {
+		key, err := GetKey(this.options.AxleAddress, identifier)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to get key %s: %s", identifier, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// alertIdentity distinguishes alerts for different keys, limits and
+// thresholds.
+func alertIdentity(alert QuotaAlert) string {
+	return fmt.Sprintf("%s\x00%s\x00%v", alert.Usage.Key, alert.Limit, alert.Threshold)
+}
+
+// newAlerts returns the alerts for usage which haven't already fired today.
+func (this *QuotaMonitor) newAlerts(usage *QuotaUsage) (alerts []QuotaAlert) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	// forget anything from previous days
+	for identity, day := range this.fired {
+		if day.Before(usage.Day) {
+			delete(this.fired, identity)
+		}
+	}
+
+	check := func(limit QuotaLimit, percent float64) {
+		if percent < 0 {
+			return
+		}
+		for _, threshold := range this.options.Thresholds {
+			if percent < threshold {
+				return
+			}
+			alert := QuotaAlert{Usage: *usage, Limit: limit, Threshold: threshold}
+			if day, exists := this.fired[alertIdentity(alert)]; exists && day.Equal(usage.Day) {
+				continue
+			}
+			alerts = append(alerts, alert)
+		}
+	}
+	check(QUOTA_LIMIT_QPD, usage.QpdPercent)
+	check(QUOTA_LIMIT_QPS, usage.QpsPercent)
+
+	return alerts
+}
+
+// raise records that alert has fired for its day, passes it to OnAlert and
+// queues it for the webhook.
+func (this *QuotaMonitor) raise(alert QuotaAlert) {
+	this.mu.Lock()
+	this.fired[alertIdentity(alert)] = alert.Usage.Day
+	if this.options.WebhookURL != "" {
+		this.undelivered = append(this.undelivered, alert)
+	}
+	this.mu.Unlock()
+
+	if this.options.OnAlert != nil {
+		this.options.OnAlert(alert)
+	}
+}
+
+// deliver posts the queued alerts to the webhook, keeping those which fail
+// to try again, unless their day has passed.
+func (this *QuotaMonitor) deliver(now time.Time) (errs []error) {
+	this.mu.Lock()
+	queued := this.undelivered
+	this.undelivered = nil
+	this.mu.Unlock()
+
+	var failed []QuotaAlert
+	for _, alert := range queued {
+		if err := this.post(alert); err != nil {
+			errs = append(errs, err)
+			if now.Sub(alert.Usage.Day) < 24*time.Hour {
+				failed = append(failed, alert)
+			}
+		}
+	}
+
+	this.mu.Lock()
+	this.undelivered = append(failed, this.undelivered...)
+	this.mu.Unlock()
+	return errs
+}
+
+// post sends alert to the webhook.
+func (this *QuotaMonitor) post(alert QuotaAlert) (err error) {
+	marshalled, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("Unable to marshal quota alert: %s", err)
+	}
+	resp, err := this.webhook.Post(this.options.WebhookURL, "application/json", bytes.NewReader(marshalled))
+	if err != nil {
+		return fmt.Errorf("Unable to deliver quota alert to %s: %s", this.options.WebhookURL, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf(
+			"Unable to deliver quota alert to %s, server returned status \"%s\"",
+			this.options.WebhookURL,
+			resp.Status,
+		)
+	}
+	return nil
+}
+
+/* ex: set noexpandtab: */
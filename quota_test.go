@@ -0,0 +1,191 @@
+package goaxle
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func quotaStatsResponse(day time.Time, uncached int, errored int) string {
+	return fmt.Sprintf(
+		`{"meta":{"version":1,"status_code":200},"results":{"uncached":{"%d":{"200":%d}},"error":{"%d":{"429":%d}}}}`,
+		day.Unix(), uncached, day.Unix(), errored,
+	)
+}
+
+func TestQuotaMonitor(t *testing.T) {
+	now := time.Date(2013, 9, 24, 15, 0, 0, 0, time.UTC)
+	today := time.Date(2013, 9, 24, 0, 0, 0, 0, time.UTC)
+
+	axle := newTestAxle(t, map[string]string{
+		"GET /v1/key/alpha":       `{"meta":{"version":1,"status_code":200},"results":{"qps":2,"qpd":1000}}`,
+		"GET /v1/key/alpha/stats": quotaStatsResponse(today, 850, 50),
+	})
+
+	var webhookAlerts []QuotaAlert
+	webhookDown := false
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if webhookDown {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var alert QuotaAlert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Errorf("Bad webhook body: %v", err)
+		}
+		webhookAlerts = append(webhookAlerts, alert)
+	}))
+	defer webhook.Close()
+
+	var alerts []QuotaAlert
+	monitor := NewQuotaMonitor(QuotaMonitorOptions{
+		AxleAddress: axle.address(),
+		Keys:        []string{"alpha"},
+		OnAlert:     func(alert QuotaAlert) { alerts = append(alerts, alert) },
+		WebhookURL:  webhook.URL,
+	})
+
+	usages, err := monitor.Check(now)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if len(usages) != 1 || usages[0].Calls != 900 || usages[0].QpdPercent != 90 {
+		t.Fatalf("Unexpected usage: %+v", usages[0])
+	}
+	if len(alerts) != 1 || alerts[0].Threshold != 80 || alerts[0].Limit != QUOTA_LIMIT_QPD {
+		t.Fatalf("Expected an 80%% alert, got %+v", alerts)
+	}
+	if len(webhookAlerts) != 1 || webhookAlerts[0].Usage.Key != "alpha" {
+		t.Fatalf("Webhook not called correctly: %+v", webhookAlerts)
+	}
+
+	// same usage again shouldn't re-alert
+	monitor.Check(now.Add(time.Minute))
+	if len(alerts) != 1 {
+		t.Fatalf("Alert fired twice in one day: %+v", alerts)
+	}
+
+	// crossing 100% only raises the new threshold, once, retrying just the
+	// webhook until it accepts it
+	axle.set("GET /v1/key/alpha/stats", quotaStatsResponse(today, 1000, 50))
+	webhookDown = true
+	if _, err := monitor.Check(now.Add(2 * time.Minute)); err == nil {
+		t.Fatalf("Expected an error when the webhook fails")
+	}
+	if len(alerts) != 2 || alerts[1].Threshold != 100 {
+		t.Fatalf("Expected a 100%% alert, got %+v", alerts)
+	}
+	webhookDown = false
+	if _, err := monitor.Check(now.Add(3 * time.Minute)); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if len(webhookAlerts) != 2 || webhookAlerts[1].Threshold != 100 {
+		t.Fatalf("Expected the 100%% alert to be redelivered, got %+v", webhookAlerts)
+	}
+	monitor.Check(now.Add(4 * time.Minute))
+	if len(alerts) != 2 || len(webhookAlerts) != 2 {
+		t.Fatalf("Alert raised again after delivery: %+v, %+v", alerts, webhookAlerts)
+	}
+
+	// a new day resets the alerts
+	tomorrow := today.Add(24 * time.Hour)
+	axle.set("GET /v1/key/alpha/stats", quotaStatsResponse(tomorrow, 1000, 0))
+	monitor.Check(tomorrow.Add(time.Hour))
+	if len(alerts) != 4 {
+		t.Fatalf("Expected alerts to fire again the next day, got %+v", alerts)
+	}
+}
+
+func TestQuotaMonitorWebhookTimeout(t *testing.T) {
+	now := time.Date(2013, 9, 24, 15, 0, 0, 0, time.UTC)
+	today := time.Date(2013, 9, 24, 0, 0, 0, 0, time.UTC)
+
+	axle := newTestAxle(t, map[string]string{
+		"GET /v1/key/alpha":       `{"meta":{"version":1,"status_code":200},"results":{"qps":2,"qpd":1000}}`,
+		"GET /v1/key/alpha/stats": quotaStatsResponse(today, 850, 50),
+	})
+
+	release := make(chan struct{})
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer webhook.Close()
+	defer close(release)
+
+	monitor := NewQuotaMonitor(QuotaMonitorOptions{
+		AxleAddress:    axle.address(),
+		Keys:           []string{"alpha"},
+		WebhookURL:     webhook.URL,
+		WebhookTimeout: 50 * time.Millisecond,
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := monitor.Check(now)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatalf("Expected the hung webhook to time out")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Check blocked on the webhook")
+	}
+	if len(monitor.undelivered) != 1 {
+		t.Fatalf("Expected the alert to be kept for redelivery, got %+v", monitor.undelivered)
+	}
+}
+
+func TestKeyQuotaUsageLocation(t *testing.T) {
+	// local midnight falls after UTC midnight to the west, and on another
+	// date to the east
+	today := time.Date(2013, 9, 24, 0, 0, 0, 0, time.UTC)
+	axle := newTestAxle(t, map[string]string{
+		"GET /v1/key/alpha/stats": quotaStatsResponse(today, 850, 50),
+	})
+	key := NewKey(axle.address(), "alpha")
+	key.Qpd = 1000
+
+	for _, test := range []struct {
+		now time.Time
+		loc *time.Location
+	}{
+		{today.Add(15 * time.Hour), time.FixedZone("PDT", -7*60*60)},
+		{today.Add(22 * time.Hour), time.FixedZone("AEST", 10*60*60)},
+	} {
+		usage, err := KeyQuotaUsage(axle.address(), key, test.now, test.loc, 0)
+		if err != nil {
+			t.Fatalf("Unable to get usage: %v", err)
+		}
+		if usage.Calls != 900 || !usage.Day.Equal(today) || usage.Day.Location() != test.loc {
+			t.Fatalf("Expected the UTC day's usage in %s, got %+v", test.loc, usage)
+		}
+	}
+}
+
+func TestKeyQuotaUsageUnlimited(t *testing.T) {
+	now := time.Date(2013, 9, 24, 15, 0, 0, 0, time.UTC)
+	axle := newTestAxle(t, map[string]string{
+		"GET /v1/key/open/stats": quotaStatsResponse(now.Truncate(time.Second), 7, 0),
+	})
+	key := NewKey(axle.address(), "open")
+	key.Qpd = -1
+	key.Qps = -1
+
+	usage, err := KeyQuotaUsage(axle.address(), key, now, nil, time.Minute)
+	if err != nil {
+		t.Fatalf("Unable to get usage: %v", err)
+	}
+	if usage.QpdPercent != -1 || usage.QpsPercent != -1 {
+		t.Fatalf("Unlimited key reported a percentage: %+v", usage)
+	}
+	if usage.PeakQps != 7 {
+		t.Fatalf("Unexpected peak qps: %+v", usage)
+	}
+}
+
+/* ex: set noexpandtab: */
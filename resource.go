@@ -0,0 +1,261 @@
+package goaxle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+)
+
+// Kind identifies the type of a Resource.  It matches the path segment the
+// ApiAxle management API uses for it.
+type Kind string
+
+const (
+	KIND_API     Kind = "api"
+	KIND_KEY     Kind = "key"
+	KIND_KEYRING Kind = "keyring"
+)
+
+// kindLabels are used when describing a kind of resource in errors.
+var kindLabels = map[Kind]string{
+	KIND_API:     "API",
+	KIND_KEY:     "Key",
+	KIND_KEYRING: "KeyRing",
+}
+
+// Resource is implemented by Api, Key and KeyRing, allowing tooling to work
+// over any of them uniformly.
+type Resource interface {
+	// ID returns the identifier of the resource.
+	ID() string
+
+	// Kind returns the type of the resource.
+	Kind() Kind
+
+	// Save creates or updates the resource on the server.
+	Save() error
+
+	// Delete removes the resource from the server.
+	Delete() error
+
+	// Refresh reloads the resource from the server, discarding local changes.
+	Refresh() error
+
+	// Stats returns the hits recorded against the resource.
+	Stats(from time.Time, to time.Time, granularity Granularity) (map[HitType]map[time.Time]map[int]int, error)
+
+	String() string
+}
+
+var (
+	_ Resource = (*Api)(nil)
+	_ Resource = (*Key)(nil)
+	_ Resource = (*KeyRing)(nil)
+)
+
+// GetResource retrieves an existing resource of the given kind.
+func GetResource(axleAddress string, kind Kind, identifier string) (out Resource, err error) {
+	switch kind {
+	case KIND_API:
+		return GetApi(axleAddress, identifier)
+	case KIND_KEY:
+		return GetKey(axleAddress, identifier)
+	case KIND_KEYRING:
+		return GetKeyRing(axleAddress, identifier)
+	}
+	return nil, fmt.Errorf("Unknown resource kind: %s", kind)
+}
+
+// ListResources retrieves every resource of the given kind, paging through
+// the listing as required.
+func ListResources(axleAddress string, kind Kind) (out []Resource, err error) {
+	switch kind {
+	case KIND_API:
+		return listResources(func(from int, to int) ([]*Api, error) {
+			return Apis(axleAddress, from, to)
+		})
+	case KIND_KEY:
+		return listResources(func(from int, to int) ([]*Key, error) {
+			return Keys(axleAddress, from, to)
+		})
+	case KIND_KEYRING:
+		return listResources(func(from int, to int) ([]*KeyRing, error) {
+			return KeyRings(axleAddress, from, to)
+		})
+	}
+	return nil, fmt.Errorf("Unknown resource kind: %s", kind)
+}
+
+func listResources[R Resource](list func(from int, to int) ([]R, error)) (out []Resource, err error) {
+	all, err := listAll(list)
+	if err != nil {
+		return nil, err
+	}
+	out = make([]Resource, len(all))
+	for x, resource := range all {
+		out[x] = resource
+	}
+	return out, nil
+}
+
+// DeleteResources deletes each of the provided resources, carrying on past
+// failures.  The returned error joins every failure encountered.
+func DeleteResources[R Resource](resources []R) error {
+	var errs []error
+	for _, resource := range resources {
+		err := resource.Delete()
+		if err != nil {
+			errs = append(errs, fmt.Errorf(
+				"Unable to delete %s %s: %w",
+				resource.Kind(),
+				resource.ID(),
+				err,
+			))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DiffResources lists the fields which differ between two resources.
+func DiffResources[R Resource](old R, new R) []FieldChange {
+	return diffFields(old, new)
+}
+
+// ExportedResource is the form resources are written in by ExportResources.
+type ExportedResource struct {
+	Kind     Kind            `json:"kind"`
+	ID       string          `json:"id"`
+	Resource json.RawMessage `json:"resource"`
+}
+
+// ExportResources writes each resource to w as a line of JSON in the form of
+// an ExportedResource.  Shared secrets are included.
+func ExportResources[R Resource](w io.Writer, resources []R) (err error) {
+	encoder := json.NewEncoder(w)
+	for _, resource := range resources {
+		marshalled, err := json.Marshal(resource)
+		if err != nil {
+			return fmt.Errorf("Unable to marshal %s %s: %s", resource.Kind(), resource.ID(), err.Error())
+		}
+		err = encoder.Encode(ExportedResource{
+			Kind:     resource.Kind(),
+			ID:       resource.ID(),
+			Resource: marshalled,
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to write %s %s: %s", resource.Kind(), resource.ID(), err.Error())
+		}
+	}
+	return nil
+}
+
+// resourceAddress returns the management address of a resource.
+func resourceAddress(axleAddress string, kind Kind, identifier string) string {
+	return fmt.Sprintf("%s%s%s/%s", axleAddress, VERSION_ENDPOINT, kind, url.QueryEscape(identifier))
+}
+
+// getResource retrieves a resource into object.
+func getResource(axleAddress string, kind Kind, identifier string, object interface{}, requiredFields ...string) (err error) {
+	body, err := doHttpRequest("GET", resourceAddress(axleAddress, kind, identifier), nil)
+	if err != nil {
+		return err
+	}
+	return populateFromResponse(kind, object, body, nil, requiredFields...)
+}
+
+// saveResource creates, or if update is set updates, a resource and
+// repopulates object from the server's response.
+func saveResource(axleAddress string, kind Kind, identifier string, update bool, object interface{}, requiredFields ...string) (err error) {
+	marshalled, err := json.Marshal(object)
+	if err != nil {
+		return fmt.Errorf("Unable to marshal %s: %s", kindLabels[kind], err.Error())
+	}
+
+	httpMethod := "POST"
+	var detailsLocation []string
+	if update {
+		// updates respond with both the old and new versions
+		httpMethod = "PUT"
+		detailsLocation = []string{"new"}
+	}
+
+	body, err := doHttpRequest(httpMethod, resourceAddress(axleAddress, kind, identifier), marshalled)
+	if err != nil {
+		return err
+	}
+
+	return populateFromResponse(kind, object, body, detailsLocation, requiredFields...)
+}
+
+// populateFromResponse updates object with the fields found at
+// detailsLocation within the results of the response body.
+func populateFromResponse(kind Kind, object interface{}, body []byte, detailsLocation []string, requiredFields ...string) (err error) {
+	envelope, err := DecodeEnvelope[json.RawMessage](body)
+	if err != nil {
+		return err
+	}
+
+	// navigate to the correct spot in the response to read from
+	details := envelope.Results
+	for _, key := range detailsLocation {
+		response := make(map[string]json.RawMessage)
+		err = json.Unmarshal(details, &response)
+		if err != nil {
+			return fmt.Errorf("Response did not contain a map holding %s", key)
+		}
+		var exists bool
+		details, exists = response[key]
+		if !exists {
+			return fmt.Errorf(
+				"Response map did not contain expected key: %s",
+				key,
+			)
+		}
+	}
+
+	if len(requiredFields) > 0 {
+		response := make(map[string]json.RawMessage)
+		json.Unmarshal(details, &response)
+		for _, field := range requiredFields {
+			if _, exists := response[field]; !exists {
+				return fmt.Errorf(
+					"Unable to parse response into %s: Missing required field \"%s\"",
+					kindLabels[kind],
+					field,
+				)
+			}
+		}
+	}
+
+	return decodeObject(kind, details, object)
+}
+
+// deleteResource removes the identified resource.
+func deleteResource(axleAddress string, kind Kind, identifier string) (err error) {
+	reqAddress := resourceAddress(axleAddress, kind, identifier)
+
+	succeeded, err := doResultsRequest[bool]("DELETE", reqAddress, nil)
+	if err != nil {
+		return err
+	}
+
+	if !succeeded {
+		return fmt.Errorf("Delete of %s at %s failed", kindLabels[kind], reqAddress)
+	}
+
+	return nil
+}
+
+// formatResource provides the JSON-like representation used by String.
+func formatResource(label string, axleAddress string, kind Kind, identifier string, object interface{}) string {
+	out, err := json.MarshalIndent(object, "", "    ")
+	if err != nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("%s - %s: %s", label, resourceAddress(axleAddress, kind, identifier), string(out))
+}
+
+/* ex: set noexpandtab: */
@@ -0,0 +1,83 @@
+package goaxle
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestResources(t *testing.T) {
+	axle := newTestAxle(t, map[string]string{
+		"GET /v1/apis":              `{"meta":{"version":1,"status_code":200},"results":{"weather":{"endPoint":"weather.example.com","protocol":"http"}}}`,
+		"GET /v1/key/alpha":         `{"meta":{"version":1,"status_code":200},"results":{"qps":2,"qpd":10}}`,
+		"PUT /v1/key/alpha":         `{"meta":{"version":1,"status_code":200},"results":{"new":{"qps":5,"qpd":10},"old":{"qps":2,"qpd":10}}}`,
+		"DELETE /v1/api/weather":    `{"meta":{"version":1,"status_code":200},"results":true}`,
+		"DELETE /v1/keyring/unused": `{"meta":{"version":1,"status_code":200},"results":false}`,
+	})
+
+	apis, err := ListResources(axle.address(), KIND_API)
+	if err != nil {
+		t.Fatalf("Unable to list apis: %v", err)
+	}
+	if len(apis) != 1 || apis[0].ID() != "weather" || apis[0].Kind() != KIND_API {
+		t.Fatalf("Unexpected listing: %v", apis)
+	}
+
+	resource, err := GetResource(axle.address(), KIND_KEY, "alpha")
+	if err != nil {
+		t.Fatalf("Unable to get key: %v", err)
+	}
+	key := resource.(*Key)
+	before := *key
+	key.Qps = 5
+	if err := key.Save(); err != nil {
+		t.Fatalf("Unable to save key: %v", err)
+	}
+	changes := DiffResources(&before, key)
+	if len(changes) != 2 || changes[0].Field != "qps" || changes[1].Field != "updatedAt" {
+		t.Fatalf("Unexpected changes: %+v", changes)
+	}
+
+	key.Qps = 100
+	if err := key.Refresh(); err != nil || key.Qps != 2 {
+		t.Fatalf("Refresh didn't reload the key: %v %+v", err, key)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := ExportResources(buf, []Resource{apis[0], key}); err != nil {
+		t.Fatalf("Unable to export: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected two exported lines, got %q", buf.String())
+	}
+	var exported ExportedResource
+	if err := json.Unmarshal([]byte(lines[1]), &exported); err != nil {
+		t.Fatalf("Bad export line %q: %v", lines[1], err)
+	}
+	if exported.Kind != KIND_KEY || exported.ID != "alpha" || !strings.Contains(string(exported.Resource), `"qps":2`) {
+		t.Fatalf("Unexpected export: %s", lines[1])
+	}
+
+	err = DeleteResources([]Resource{apis[0], NewKeyRing(axle.address(), "unused"), NewKey(axle.address(), "missing")})
+	if err == nil {
+		t.Fatalf("Expected failures deleting resources")
+	}
+	if strings.Contains(err.Error(), "weather") || !strings.Contains(err.Error(), "keyring unused") ||
+		!strings.Contains(err.Error(), "key missing") {
+		t.Fatalf("Unexpected delete error: %v", err)
+	}
+}
+
+func TestGetApiRequiresEndPoint(t *testing.T) {
+	axle := newTestAxle(t, map[string]string{
+		"GET /v1/api/broken": `{"meta":{"version":1,"status_code":200},"results":{"protocol":"http"}}`,
+	})
+	_, err := GetApi(axle.address(), "broken")
+	if err == nil || !strings.Contains(err.Error(), `"endPoint"`) {
+		t.Fatalf("Expected missing endPoint error, got %v", err)
+	}
+}
+
+/* ex: set noexpandtab: */
@@ -0,0 +1,567 @@
+package goaxle
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ScheduledJob changes fields of an api or key at a set time, or repeatedly
+// on a cron schedule, optionally putting them back afterwards.
+type ScheduledJob struct {
+	// Assigned by Add if empty.
+	ID string `json:"id"`
+
+	// KIND_API or KIND_KEY.
+	Kind       Kind   `json:"kind"`
+	Identifier string `json:"identifier"`
+
+	// Fields to set, named as in the ApiAxle JSON representation, such as
+	// {"qps": 50} or {"disabled": true}.
+	Set map[string]interface{} `json:"set"`
+
+	// When to apply a one-off job.  Exactly one of At and Cron is required.
+	At time.Time `json:"at,omitzero"`
+
+	// Cron expression for a repeating job, see ParseCron.  Occurrences are
+	// worked out in the local time zone.
+	Cron string `json:"cron,omitempty"`
+
+	// If set, the changed fields are reverted this long after being applied.
+	RevertAfter time.Duration `json:"revertAfter,omitempty"`
+
+	// When the job is next applied, zero once a one-off job has been.
+	Next time.Time `json:"next,omitzero"`
+
+	// The values of the changed fields before the job was applied, and
+	// when to put them back.  Only set while a revert is pending.  Fields
+	// which were unset are held as nil, and are sent empty to revert them.
+	Prior    map[string]interface{} `json:"prior,omitempty"`
+	RevertAt time.Time              `json:"revertAt,omitzero"`
+
+	// Failed attempts in a row, see MAX_JOB_FAILURES.
+	Failures int `json:"failures,omitempty"`
+}
+
+// Kind of action reported by a JobResult.
+type JobAction string
+
+const (
+	// The job's fields were set.
+	JobApplied JobAction = "applied"
+
+	// The job's fields were put back to their prior values.
+	JobReverted JobAction = "reverted"
+
+	// The scheduler's file couldn't be written, see JobResult.Err.
+	JobSaveFailed JobAction = "save_failed"
+
+	// The job was dropped after failing, see JobResult.Err.
+	JobAbandoned JobAction = "abandoned"
+)
+
+// MAX_JOB_FAILURES is how many times in a row a job may fail before it is
+// abandoned.
+const MAX_JOB_FAILURES = 5
+
+// JobResult reports one attempt to apply or revert a job.
+type JobResult struct {
+	JobID      string
+	Action     JobAction
+	Kind       Kind
+	Identifier string
+
+	// When the attempt was made.
+	Time time.Time
+
+	// The fields changed, Old being the value before the attempt.
+	Changes []FieldChange
+
+	// Fields not reverted because they were changed by something else
+	// after the job was applied.
+	Skipped []string
+
+	// Set if the attempt failed.  Failed attempts are retried on the next
+	// run, unless the job is abandoned.
+	Err error
+}
+
+// readOnlyFields are maintained by the server and can't be scheduled.
+var readOnlyFields = map[string]bool{"createdAt": true, "updatedAt": true}
+
+// Scheduler holds scheduled jobs, persisting them to a local file so that
+// pending jobs and reverts survive restarts.  It is safe for concurrent
+// use.
+type Scheduler struct {
+	axleAddress string
+	path        string
+
+	// Held by RunDue, so only one runs at a time.
+	runMu sync.Mutex
+
+	mu   sync.Mutex
+	jobs map[string]*ScheduledJob
+}
+
+// OpenScheduler loads the jobs saved at path, which need not exist yet.
+func OpenScheduler(axleAddress string, path string) (scheduler *Scheduler, err error) {
+	scheduler = &Scheduler{
+		axleAddress: axleAddress,
+		path:        path,
+		jobs:        make(map[string]*ScheduledJob),
+	}
+	var jobs []*ScheduledJob
+	if err = loadJSONFile(path, "scheduled jobs", &jobs); err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		scheduler.jobs[job.ID] = job
+	}
+	return scheduler, nil
+}
+
+// Add validates and schedules job, saving it before returning.
+func (this *Scheduler) Add(job ScheduledJob) (id string, err error) {
+	if job.Kind != KIND_API && job.Kind != KIND_KEY {
+		return "", fmt.Errorf("Unable to schedule job: only apis and keys can be changed, not %s", job.Kind)
+	}
+	if job.Identifier == "" {
+		return "", fmt.Errorf("Unable to schedule job: identifier is required")
+	}
+	if len(job.Set) == 0 {
+		return "", fmt.Errorf("Unable to schedule job: no fields to set")
+	}
+	for field := range job.Set {
+		if readOnlyFields[field] {
+			return "", fmt.Errorf("Unable to schedule job: %s can't be set", field)
+		}
+	}
+	if job.RevertAfter < 0 {
+		return "", fmt.Errorf("Unable to schedule job: revertAfter can't be negative")
+	}
+	// hold values as they'll be compared with the server's, float64 numbers
+	if job.Set, err = normaliseFields(job.Set); err != nil {
+		return "", fmt.Errorf("Unable to schedule job: %s", err)
+	}
+
+	now := time.Now()
+	switch {
+	case job.At.IsZero() == (job.Cron == ""):
+		return "", fmt.Errorf("Unable to schedule job: exactly one of at and cron is required")
+	case job.Cron != "":
+		schedule, err := ParseCron(job.Cron)
+		if err != nil {
+			return "", fmt.Errorf("Unable to schedule job: %s", err)
+		}
+		job.Next = schedule.Next(now)
+		if job.Next.IsZero() {
+			return "", fmt.Errorf("Unable to schedule job: %s never occurs", job.Cron)
+		}
+	default:
+		job.Next = job.At
+	}
+	job.Prior, job.RevertAt, job.Failures = nil, time.Time{}, 0
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if job.ID == "" {
+		job.ID = newJobID()
+	} else if _, exists := this.jobs[job.ID]; exists {
+		return "", fmt.Errorf("Unable to schedule job: %s already exists", job.ID)
+	}
+	this.jobs[job.ID] = &job
+	if err = this.save(); err != nil {
+		delete(this.jobs, job.ID)
+		return "", err
+	}
+	return job.ID, nil
+}
+
+// Remove unschedules a job.  A pending revert is abandoned.
+func (this *Scheduler) Remove(id string) (err error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	job, exists := this.jobs[id]
+	if !exists {
+		return fmt.Errorf("Unable to remove job %s: it doesn't exist", id)
+	}
+	delete(this.jobs, id)
+	if err = this.save(); err != nil {
+		this.jobs[id] = job
+		return err
+	}
+	return nil
+}
+
+// Jobs returns copies of the scheduled jobs, ordered by ID.
+func (this *Scheduler) Jobs() (jobs []ScheduledJob) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	for _, job := range this.sorted() {
+		jobs = append(jobs, *job)
+	}
+	return jobs
+}
+
+// RunDue applies and reverts every job due at now, saving the changes.
+// Reverts are done before applying, so a job repeating before its revert
+// is due skips that occurrence.  After downtime, each job applies once
+// however many occurrences were missed.  Requests to the server are made
+// without holding up Add, Remove or Jobs.
+//
+// A job is abandoned, reported by a JobAbandoned result, once its api or
+// key no longer exists or after MAX_JOB_FAILURES failed attempts in a row.
+func (this *Scheduler) RunDue(now time.Time) (results []JobResult, err error) {
+	this.runMu.Lock()
+	defer this.runMu.Unlock()
+
+	// run copies of the due jobs, so the lock isn't held during requests
+	this.mu.Lock()
+	var originals, due []*ScheduledJob
+	for _, job := range this.sorted() {
+		if job.due(now) {
+			copied := *job
+			originals = append(originals, job)
+			due = append(due, &copied)
+		}
+	}
+	this.mu.Unlock()
+
+	finished := make([]bool, len(due))
+	for x, job := range due {
+		var jobResults []JobResult
+		jobResults, finished[x] = this.run(job, originals[x], now)
+		results = append(results, jobResults...)
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	changed := false
+	for x, job := range due {
+		// leave jobs removed or replaced while running alone
+		if this.jobs[job.ID] != originals[x] {
+			continue
+		}
+		changed = true
+		if finished[x] {
+			delete(this.jobs, job.ID)
+		} else {
+			this.jobs[job.ID] = job
+		}
+	}
+	if changed {
+		err = this.save()
+	}
+	return results, err
+}
+
+// run applies and reverts a due job, a copy of original, updating it.  It
+// reports whether the job is done with and should be dropped.
+func (this *Scheduler) run(job *ScheduledJob, original *ScheduledJob, now time.Time) (results []JobResult, finished bool) {
+	if !job.RevertAt.IsZero() && !job.RevertAt.After(now) {
+		result := this.revert(job, now)
+		results = append(results, result)
+		if result.Err != nil {
+			return failed(job, results)
+		}
+		job.Failures = 0
+		job.Prior, job.RevertAt = nil, time.Time{}
+		if job.Next.IsZero() {
+			return results, true
+		}
+	}
+
+	if job.Next.IsZero() || job.Next.After(now) {
+		return results, false
+	}
+	if job.RevertAt.IsZero() || job.interrupted() {
+		result := this.apply(job, original, now)
+		results = append(results, result)
+		if result.Err != nil {
+			return failed(job, results)
+		}
+		job.Failures = 0
+	}
+	if job.Cron != "" {
+		// validated by Add
+		schedule, _ := ParseCron(job.Cron)
+		job.Next = schedule.Next(now)
+	} else {
+		job.Next = time.Time{}
+	}
+	return results, job.Next.IsZero() && job.RevertAt.IsZero()
+}
+
+// failed counts the failure of the last of results, adding a JobAbandoned
+// result if the job is given up on.
+func failed(job *ScheduledJob, results []JobResult) (out []JobResult, abandoned bool) {
+	last := results[len(results)-1]
+	job.Failures++
+	if !IsNotFound(last.Err) && job.Failures < MAX_JOB_FAILURES {
+		return results, false
+	}
+	last.Action = JobAbandoned
+	last.Changes, last.Skipped = nil, nil
+	return append(results, last), true
+}
+
+// interrupted reports whether the job's revert was saved but the job was
+// never seen through, as Next is advanced once it has been applied.
+func (this *ScheduledJob) interrupted() bool {
+	return !this.RevertAt.IsZero() && !this.Next.IsZero() && !this.Next.After(this.RevertAt.Add(-this.RevertAfter))
+}
+
+// due reports whether the job has anything to do at now.
+func (this *ScheduledJob) due(now time.Time) bool {
+	return (!this.RevertAt.IsZero() && !this.RevertAt.After(now)) || (!this.Next.IsZero() && !this.Next.After(now))
+}
+
+// Run calls RunDue now and then every interval, sending the results on the
+// returned channel.  If the jobs can't be saved a JobSaveFailed result is
+// sent.  The channel is closed once ctx is done.
+func (this *Scheduler) Run(ctx context.Context, interval time.Duration) <-chan JobResult {
+	return runEvery(ctx, interval, func(now time.Time) []JobResult {
+		results, err := this.RunDue(now)
+		if err != nil {
+			results = append(results, JobResult{Action: JobSaveFailed, Time: now, Err: err})
+		}
+		return results
+	})
+}
+
+// apply sets the job's fields, a copy of original.  If the job is to be
+// reverted, their prior values are saved first, so the revert isn't lost
+// should the scheduler stop before the job is finished.  An interrupted job
+// keeps the prior values saved when it was.
+func (this *Scheduler) apply(job *ScheduledJob, original *ScheduledJob, now time.Time) (result JobResult) {
+	result = JobResult{JobID: job.ID, Action: JobApplied, Kind: job.Kind, Identifier: job.Identifier, Time: now}
+	resource, err := GetResource(this.axleAddress, job.Kind, job.Identifier)
+	if err != nil {
+		result.Err = fmt.Errorf("Unable to apply job %s: %w", job.ID, err)
+		return result
+	}
+	interrupted := job.interrupted()
+	prior := job.Prior
+	if !interrupted {
+		before := jsonFields(resource)
+		prior = make(map[string]interface{}, len(job.Set))
+		for field := range job.Set {
+			prior[field] = before[field]
+		}
+	}
+
+	if err = setFields(resource, job.Set, nil); err != nil {
+		result.Err = fmt.Errorf("Unable to apply job %s: %w", job.ID, err)
+		return result
+	}
+	if job.RevertAfter > 0 && !interrupted {
+		job.Prior, job.RevertAt = prior, now.Add(job.RevertAfter)
+		if err = this.checkpoint(job, original); err != nil {
+			job.Prior, job.RevertAt = nil, time.Time{}
+			result.Err = fmt.Errorf("Unable to apply job %s: %w", job.ID, err)
+			return result
+		}
+	}
+	if err = resource.Save(); err != nil {
+		// an interrupted job keeps its revert, as it may have been applied
+		if !interrupted {
+			job.Prior, job.RevertAt = nil, time.Time{}
+		}
+		result.Err = fmt.Errorf("Unable to apply job %s: %w", job.ID, err)
+		return result
+	}
+	result.Changes = fieldChanges(prior, job.Set)
+	return result
+}
+
+// checkpoint saves job, a copy of original, in its place while it runs.
+func (this *Scheduler) checkpoint(job *ScheduledJob, original *ScheduledJob) (err error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.jobs[job.ID] != original {
+		return fmt.Errorf("it was removed or replaced while running")
+	}
+	previous := *original
+	*original = *job
+	if err = this.save(); err != nil {
+		*original = previous
+		return err
+	}
+	return nil
+}
+
+// revert puts back the job's prior values, except for fields no longer
+// holding the value the job set.
+func (this *Scheduler) revert(job *ScheduledJob, now time.Time) (result JobResult) {
+	result = JobResult{JobID: job.ID, Action: JobReverted, Kind: job.Kind, Identifier: job.Identifier, Time: now}
+	resource, err := GetResource(this.axleAddress, job.Kind, job.Identifier)
+	if err != nil {
+		result.Err = fmt.Errorf("Unable to revert job %s: %w", job.ID, err)
+		return result
+	}
+	current := jsonFields(resource)
+	restore := make(map[string]interface{})
+	before := make(map[string]interface{})
+	var unset []string
+	for _, field := range unionKeys(job.Prior, job.Set) {
+		if !reflect.DeepEqual(current[field], job.Set[field]) {
+			result.Skipped = append(result.Skipped, field)
+			continue
+		}
+		before[field] = current[field]
+		if job.Prior[field] == nil {
+			unset = append(unset, field)
+		} else {
+			restore[field] = job.Prior[field]
+		}
+	}
+	if len(before) == 0 {
+		return result
+	}
+
+	if err = setFields(resource, restore, unset); err != nil {
+		result.Err = fmt.Errorf("Unable to revert job %s: %w", job.ID, err)
+		return result
+	}
+	if err = saveClearing(this.axleAddress, resource, unset); err != nil {
+		result.Err = fmt.Errorf("Unable to revert job %s: %w", job.ID, err)
+		return result
+	}
+	after := make(map[string]interface{}, len(before))
+	for field := range before {
+		after[field] = job.Prior[field]
+	}
+	result.Changes = fieldChanges(before, after)
+	return result
+}
+
+// sorted returns the jobs ordered by ID.  The lock must be held.
+func (this *Scheduler) sorted() (jobs []*ScheduledJob) {
+	for _, job := range this.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs
+}
+
+// save writes the jobs to the scheduler's file.  The lock must be held.
+func (this *Scheduler) save() (err error) {
+	jobs := this.sorted()
+	if jobs == nil {
+		jobs = []*ScheduledJob{}
+	}
+	return saveJSONFile(this.path, "scheduled jobs", jobs)
+}
+
+// setFields overwrites fields of resource from their JSON representation,
+// and clears those in unset.  Unknown fields are an error.
+func setFields(resource Resource, set map[string]interface{}, unset []string) (err error) {
+	fields := jsonFields(resource)
+	for field, value := range set {
+		fields[field] = value
+	}
+	for _, field := range unset {
+		delete(fields, field)
+	}
+	marshalled, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	// clear what's represented in JSON so omitted fields end up empty,
+	// keeping the identifier and where the resource lives
+	object := reflect.ValueOf(resource).Elem()
+	for x := 0; x < object.NumField(); x++ {
+		field := object.Type().Field(x)
+		if field.IsExported() && field.Tag.Get("json") != "-" {
+			object.Field(x).SetZero()
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(marshalled))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(resource)
+}
+
+// saveClearing saves resource, sending each field in unset as its zero
+// value.  Save leaves empty fields out, and an update keeps the old value of
+// any field it leaves out.
+func saveClearing(axleAddress string, resource Resource, unset []string) (err error) {
+	if len(unset) == 0 {
+		return resource.Save()
+	}
+	if validator, canValidate := resource.(interface{ Validate() error }); canValidate && ValidateBeforeSave {
+		if err = validator.Validate(); err != nil {
+			return err
+		}
+	}
+	fields := jsonFields(resource)
+	for _, field := range unset {
+		if fields[field], err = zeroField(resource, field); err != nil {
+			return err
+		}
+	}
+	fields["updatedAt"] = float64(time.Now().UnixNano() / (1000 * 1000))
+	marshalled, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("Unable to marshal %s: %s", kindLabels[resource.Kind()], err)
+	}
+	body, err := doHttpRequest("PUT", resourceAddress(axleAddress, resource.Kind(), resource.ID()), marshalled)
+	if err != nil {
+		return err
+	}
+	return populateFromResponse(resource.Kind(), resource, body, []string{"new"})
+}
+
+// zeroField returns the empty value of the field of resource named field in
+// JSON, with slices empty rather than null.
+func zeroField(resource Resource, field string) (zero interface{}, err error) {
+	object := reflect.TypeOf(resource).Elem()
+	for x := 0; x < object.NumField(); x++ {
+		name, _, _ := strings.Cut(object.Field(x).Tag.Get("json"), ",")
+		if name != field {
+			continue
+		}
+		fieldType := object.Field(x).Type
+		if fieldType.Kind() == reflect.Slice {
+			return reflect.MakeSlice(fieldType, 0, 0).Interface(), nil
+		}
+		return reflect.Zero(fieldType).Interface(), nil
+	}
+	return nil, fmt.Errorf("Unknown field %s of %s", field, kindLabels[resource.Kind()])
+}
+
+// normaliseFields round trips fields through JSON.
+func normaliseFields(fields map[string]interface{}) (out map[string]interface{}, err error) {
+	marshalled, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(marshalled, &out)
+	return out, err
+}
+
+// fieldChanges lists the fields of before and after, in order.
+func fieldChanges(before map[string]interface{}, after map[string]interface{}) (changes []FieldChange) {
+	for _, field := range unionKeys(before, after) {
+		changes = append(changes, FieldChange{Field: field, Old: before[field], New: after[field]})
+	}
+	return changes
+}
+
+// newJobID returns a random identifier for a job.
+func newJobID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+/* ex: set noexpandtab: */
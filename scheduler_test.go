@@ -0,0 +1,324 @@
+package goaxle_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	goaxle "github.com/rjohnsondev/go-axle"
+	"github.com/rjohnsondev/go-axle/server"
+)
+
+func TestScheduler(t *testing.T) {
+	axle := httptest.NewServer(server.New(server.NewMemoryStorage()))
+	defer axle.Close()
+	address := axle.URL + "/"
+	key := goaxle.NewKey(address, "alpha")
+	if err := key.Save(); err != nil {
+		t.Fatalf("Unable to create key: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	scheduler, err := goaxle.OpenScheduler(address, path)
+	if err != nil {
+		t.Fatalf("Unable to open scheduler: %v", err)
+	}
+	start := time.Now()
+	campaign, err := scheduler.Add(goaxle.ScheduledJob{
+		Kind:        goaxle.KIND_KEY,
+		Identifier:  "alpha",
+		Set:         map[string]interface{}{"qps": 50, "sharedSecret": "campaign"},
+		At:          start.Add(time.Hour),
+		RevertAfter: 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Unable to add job: %v", err)
+	}
+
+	if results, err := scheduler.RunDue(start); err != nil || len(results) != 0 {
+		t.Fatalf("Expected nothing due yet, got %+v %v", results, err)
+	}
+	results, err := scheduler.RunDue(start.Add(time.Hour))
+	if err != nil || len(results) != 1 || results[0].Err != nil || results[0].Action != goaxle.JobApplied || len(results[0].Changes) != 2 {
+		t.Fatalf("Expected the job to apply, got %+v %v", results, err)
+	}
+	key, _ = goaxle.GetKey(address, "alpha")
+	if key.Qps != 50 || key.SharedSecret != "campaign" || key.Qpd != 172800 {
+		t.Fatalf("Unexpected key after applying: %+v", key)
+	}
+
+	// the pending revert survives a restart
+	scheduler, err = goaxle.OpenScheduler(address, path)
+	if err != nil {
+		t.Fatalf("Unable to reopen scheduler: %v", err)
+	}
+	jobs := scheduler.Jobs()
+	if len(jobs) != 1 || jobs[0].ID != campaign || jobs[0].Prior["qps"] != 2.0 || !jobs[0].Next.IsZero() {
+		t.Fatalf("Unexpected jobs after reopening: %+v", jobs)
+	}
+
+	// a change made since is left alone
+	key.SharedSecret = "rotated"
+	if err = key.Save(); err != nil {
+		t.Fatalf("Unable to update key: %v", err)
+	}
+	results, err = scheduler.RunDue(start.Add(25 * time.Hour))
+	if err != nil || len(results) != 1 || results[0].Action != goaxle.JobReverted || len(results[0].Skipped) != 1 ||
+		results[0].Skipped[0] != "sharedSecret" || len(results[0].Changes) != 1 {
+		t.Fatalf("Expected the job to revert, got %+v %v", results, err)
+	}
+	key, _ = goaxle.GetKey(address, "alpha")
+	if key.Qps != 2 || key.SharedSecret != "rotated" {
+		t.Fatalf("Unexpected key after reverting: %+v", key)
+	}
+	if jobs := scheduler.Jobs(); len(jobs) != 0 {
+		t.Fatalf("Expected the finished job to be removed, got %+v", jobs)
+	}
+}
+
+func TestSchedulerRevertSavedBeforeApplying(t *testing.T) {
+	handler := server.New(server.NewMemoryStorage())
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	crashed := filepath.Join(t.TempDir(), "jobs.json")
+	axle := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// keep the jobs file as it was when the key was changed, as if the
+		// scheduler stopped then
+		if r.Method == "PUT" {
+			if data, err := os.ReadFile(path); err == nil {
+				os.WriteFile(crashed, data, 0600)
+			}
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer axle.Close()
+	address := axle.URL + "/"
+	if err := goaxle.NewKey(address, "alpha").Save(); err != nil {
+		t.Fatalf("Unable to create key: %v", err)
+	}
+
+	scheduler, err := goaxle.OpenScheduler(address, path)
+	if err != nil {
+		t.Fatalf("Unable to open scheduler: %v", err)
+	}
+	now := time.Now()
+	_, err = scheduler.Add(goaxle.ScheduledJob{Kind: goaxle.KIND_KEY, Identifier: "alpha", Set: map[string]interface{}{"qps": 50}, At: now, RevertAfter: time.Hour})
+	if err != nil {
+		t.Fatalf("Unable to add job: %v", err)
+	}
+	if results, err := scheduler.RunDue(now); err != nil || len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("Expected the job to apply, got %+v %v", results, err)
+	}
+
+	// restarting from then, the job is seen through with the saved prior
+	// values, and still reverted
+	scheduler, err = goaxle.OpenScheduler(address, crashed)
+	if err != nil {
+		t.Fatalf("Unable to open scheduler: %v", err)
+	}
+	jobs := scheduler.Jobs()
+	if len(jobs) != 1 || jobs[0].Prior["qps"] != 2.0 || jobs[0].RevertAt.IsZero() {
+		t.Fatalf("Expected the revert to have been saved, got %+v", jobs)
+	}
+	results, err := scheduler.RunDue(now.Add(time.Minute))
+	if err != nil || len(results) != 1 || results[0].Action != goaxle.JobApplied || results[0].Changes[0].Old != 2.0 {
+		t.Fatalf("Expected the job to apply again, got %+v %v", results, err)
+	}
+	if jobs := scheduler.Jobs(); len(jobs) != 1 || !jobs[0].Next.IsZero() {
+		t.Fatalf("Expected only the revert to be pending, got %+v", jobs)
+	}
+	results, err = scheduler.RunDue(now.Add(time.Hour))
+	if err != nil || len(results) != 1 || results[0].Action != goaxle.JobReverted {
+		t.Fatalf("Expected the job to revert, got %+v %v", results, err)
+	}
+	if key, _ := goaxle.GetKey(address, "alpha"); key.Qps != 2 {
+		t.Fatalf("Expected qps to be reverted, got %+v", key)
+	}
+}
+
+func TestSchedulerRevertUnset(t *testing.T) {
+	axle := httptest.NewServer(server.New(server.NewMemoryStorage()))
+	defer axle.Close()
+	address := axle.URL + "/"
+	if err := goaxle.NewKey(address, "alpha").Save(); err != nil {
+		t.Fatalf("Unable to create key: %v", err)
+	}
+
+	scheduler, err := goaxle.OpenScheduler(address, filepath.Join(t.TempDir(), "jobs.json"))
+	if err != nil {
+		t.Fatalf("Unable to open scheduler: %v", err)
+	}
+	start := time.Now()
+	_, err = scheduler.Add(goaxle.ScheduledJob{
+		Kind:        goaxle.KIND_KEY,
+		Identifier:  "alpha",
+		Set:         map[string]interface{}{"sharedSecret": "campaign"},
+		At:          start,
+		RevertAfter: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Unable to add job: %v", err)
+	}
+	if results, err := scheduler.RunDue(start); err != nil || len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("Expected the job to apply, got %+v %v", results, err)
+	}
+	if key, _ := goaxle.GetKey(address, "alpha"); key.SharedSecret != "campaign" {
+		t.Fatalf("Unexpected key after applying: %+v", key)
+	}
+
+	// the shared secret was unset, so reverting clears it
+	results, err := scheduler.RunDue(start.Add(time.Hour))
+	if err != nil || len(results) != 1 || results[0].Err != nil || len(results[0].Changes) != 1 {
+		t.Fatalf("Expected the job to revert, got %+v %v", results, err)
+	}
+	if key, _ := goaxle.GetKey(address, "alpha"); key.SharedSecret != "" {
+		t.Fatalf("Expected the shared secret to be cleared, got %+v", key)
+	}
+}
+
+func TestSchedulerCron(t *testing.T) {
+	axle := httptest.NewServer(server.New(server.NewMemoryStorage()))
+	defer axle.Close()
+	address := axle.URL + "/"
+	if err := goaxle.NewKey(address, "alpha").Save(); err != nil {
+		t.Fatalf("Unable to create key: %v", err)
+	}
+
+	scheduler, err := goaxle.OpenScheduler(address, filepath.Join(t.TempDir(), "jobs.json"))
+	if err != nil {
+		t.Fatalf("Unable to open scheduler: %v", err)
+	}
+	id, err := scheduler.Add(goaxle.ScheduledJob{
+		Kind:        goaxle.KIND_KEY,
+		Identifier:  "alpha",
+		Set:         map[string]interface{}{"disabled": true},
+		Cron:        "0 6 * * 6",
+		RevertAfter: 4 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Unable to add job: %v", err)
+	}
+	next := scheduler.Jobs()[0].Next
+	if next.Weekday() != time.Saturday || next.Hour() != 6 || next.Minute() != 0 {
+		t.Fatalf("Unexpected next occurrence: %v", next)
+	}
+
+	if results, err := scheduler.RunDue(next); err != nil || len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("Expected the job to apply, got %+v %v", results, err)
+	}
+	if key, _ := goaxle.GetKey(address, "alpha"); !key.Disabled {
+		t.Fatalf("Expected the key to be disabled")
+	}
+	if results, err := scheduler.RunDue(next.Add(4 * time.Hour)); err != nil || len(results) != 1 || results[0].Action != goaxle.JobReverted {
+		t.Fatalf("Expected the job to revert, got %+v %v", results, err)
+	}
+	if key, _ := goaxle.GetKey(address, "alpha"); key.Disabled {
+		t.Fatalf("Expected the key to be enabled")
+	}
+	job := scheduler.Jobs()[0]
+	if job.ID != id || !job.Next.Equal(next.AddDate(0, 0, 7)) || job.Prior != nil {
+		t.Fatalf("Expected the job to repeat next week, got %+v", job)
+	}
+
+	if err = scheduler.Remove(id); err != nil {
+		t.Fatalf("Unable to remove job: %v", err)
+	}
+
+	// a job whose key is gone is abandoned straight away
+	scheduler.Add(goaxle.ScheduledJob{Kind: goaxle.KIND_KEY, Identifier: "missing", Set: map[string]interface{}{"qps": 5}, At: next})
+	results, err := scheduler.RunDue(next)
+	if err != nil || len(results) != 2 || results[0].Err == nil || results[1].Action != goaxle.JobAbandoned {
+		t.Fatalf("Expected a missing key to be abandoned, got %+v %v", results, err)
+	}
+	if jobs := scheduler.Jobs(); len(jobs) != 0 {
+		t.Fatalf("Expected the abandoned job to be removed, got %+v", jobs)
+	}
+
+	// other failures are retried, up to a limit
+	scheduler.Add(goaxle.ScheduledJob{Kind: goaxle.KIND_KEY, Identifier: "alpha", Set: map[string]interface{}{"qps": "lots"}, At: next})
+	for x := 1; x < goaxle.MAX_JOB_FAILURES; x++ {
+		results, _ := scheduler.RunDue(next)
+		if len(results) != 1 || results[0].Err == nil || scheduler.Jobs()[0].Failures != x {
+			t.Fatalf("Expected attempt %d to fail and be retried, got %+v", x, results)
+		}
+	}
+	results, _ = scheduler.RunDue(next)
+	if len(results) != 2 || results[1].Action != goaxle.JobAbandoned || len(scheduler.Jobs()) != 0 {
+		t.Fatalf("Expected the job to be abandoned, got %+v", results)
+	}
+}
+
+func TestSchedulerUnlockedDuringRequests(t *testing.T) {
+	handler := server.New(server.NewMemoryStorage())
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var hold atomic.Bool
+	axle := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hold.Load() && r.Method == "GET" {
+			entered <- struct{}{}
+			<-release
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer axle.Close()
+	address := axle.URL + "/"
+	if err := goaxle.NewKey(address, "alpha").Save(); err != nil {
+		t.Fatalf("Unable to create key: %v", err)
+	}
+
+	scheduler, err := goaxle.OpenScheduler(address, filepath.Join(t.TempDir(), "jobs.json"))
+	if err != nil {
+		t.Fatalf("Unable to open scheduler: %v", err)
+	}
+	now := time.Now()
+	scheduler.Add(goaxle.ScheduledJob{Kind: goaxle.KIND_KEY, Identifier: "alpha", Set: map[string]interface{}{"qps": 5}, At: now})
+
+	hold.Store(true)
+	done := make(chan []goaxle.JobResult)
+	go func() {
+		results, _ := scheduler.RunDue(now)
+		done <- results
+	}()
+	<-entered
+
+	// the scheduler can be used while RunDue waits on the server
+	later, err := scheduler.Add(goaxle.ScheduledJob{Kind: goaxle.KIND_KEY, Identifier: "alpha", Set: map[string]interface{}{"qps": 7}, At: now.Add(time.Hour)})
+	if err != nil || len(scheduler.Jobs()) != 2 {
+		t.Fatalf("Unable to add a job during a run: %v", err)
+	}
+	hold.Store(false)
+	close(release)
+	if results := <-done; len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("Expected the job to apply, got %+v", results)
+	}
+	if jobs := scheduler.Jobs(); len(jobs) != 1 || jobs[0].ID != later {
+		t.Fatalf("Expected only the later job to remain, got %+v", jobs)
+	}
+}
+
+func TestSchedulerInvalidJobs(t *testing.T) {
+	scheduler, err := goaxle.OpenScheduler("http://localhost:1/", filepath.Join(t.TempDir(), "jobs.json"))
+	if err != nil {
+		t.Fatalf("Unable to open scheduler: %v", err)
+	}
+	now := time.Now()
+	set := map[string]interface{}{"qps": 5}
+	for _, job := range []goaxle.ScheduledJob{
+		{Kind: goaxle.KIND_KEYRING, Identifier: "ring", Set: set, At: now},
+		{Kind: goaxle.KIND_KEY, Set: set, At: now},
+		{Kind: goaxle.KIND_KEY, Identifier: "alpha", At: now},
+		{Kind: goaxle.KIND_KEY, Identifier: "alpha", Set: set},
+		{Kind: goaxle.KIND_KEY, Identifier: "alpha", Set: set, At: now, Cron: "@daily"},
+		{Kind: goaxle.KIND_KEY, Identifier: "alpha", Set: set, Cron: "every day"},
+		{Kind: goaxle.KIND_KEY, Identifier: "alpha", Set: map[string]interface{}{"updatedAt": 1}, At: now},
+	} {
+		if _, err := scheduler.Add(job); err == nil {
+			t.Fatalf("Expected job %+v to be refused", job)
+		}
+	}
+}
+
+/* ex: set noexpandtab: */
@@ -0,0 +1,363 @@
+// Package boltstore is a server.Storage kept in a single bbolt file, for
+// deployments which don't want to run Redis.
+package boltstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"time"
+
+	goaxle "github.com/rjohnsondev/go-axle"
+	"github.com/rjohnsondev/go-axle/server"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Top level buckets.  Resources are stored in a bucket named after their
+// kind.
+var (
+	// LINKED_BUCKET holds owner kind / owner / key.
+	LINKED_BUCKET = []byte("linked")
+
+	// LINKED_BY_BUCKET holds owner kind / key / owner, so links can be
+	// found from the key.
+	LINKED_BY_BUCKET = []byte("linkedBy")
+
+	// COUNTERS_BUCKET holds hit counts, see counterKey.
+	COUNTERS_BUCKET = []byte("counters")
+)
+
+var resourceKinds = []goaxle.Kind{goaxle.KIND_API, goaxle.KIND_KEY, goaxle.KIND_KEYRING}
+
+var ownerKinds = []goaxle.Kind{goaxle.KIND_API, goaxle.KIND_KEYRING}
+
+// Store is a server.Storage backed by a bbolt database.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens, creating if needed, the database at path.  Only one process
+// may have it open at a time.
+func Open(path string) (out *Store, err error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open %s: %s", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, kind := range resourceKinds {
+			if _, err := tx.CreateBucketIfNotExists([]byte(kind)); err != nil {
+				return err
+			}
+		}
+		for _, name := range [][]byte{LINKED_BUCKET, LINKED_BY_BUCKET} {
+			links, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+			for _, kind := range ownerKinds {
+				if _, err := links.CreateBucketIfNotExists([]byte(kind)); err != nil {
+					return err
+				}
+			}
+		}
+		_, err := tx.CreateBucketIfNotExists(COUNTERS_BUCKET)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Unable to initialise %s: %s", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database.
+func (this *Store) Close() error {
+	return this.db.Close()
+}
+
+// resources returns the bucket holding resources of kind.
+func resources(tx *bolt.Tx, kind goaxle.Kind) (bucket *bolt.Bucket, err error) {
+	bucket = tx.Bucket([]byte(kind))
+	if bucket == nil {
+		return nil, server.UnknownKind(kind)
+	}
+	return bucket, nil
+}
+
+// exists returns an ErrNotFound error unless the resource exists.
+func exists(tx *bolt.Tx, kind goaxle.Kind, identifier string) error {
+	bucket, err := resources(tx, kind)
+	if err != nil {
+		return err
+	}
+	if bucket.Get([]byte(identifier)) == nil {
+		return server.NotFound(kind, identifier)
+	}
+	return nil
+}
+
+func (this *Store) Get(kind goaxle.Kind, identifier string) (resource goaxle.Resource, err error) {
+	err = this.db.View(func(tx *bolt.Tx) error {
+		bucket, err := resources(tx, kind)
+		if err != nil {
+			return err
+		}
+		data := bucket.Get([]byte(identifier))
+		if data == nil {
+			return server.NotFound(kind, identifier)
+		}
+		resource, err = server.Decode(kind, identifier, data)
+		return err
+	})
+	return resource, err
+}
+
+func (this *Store) Create(resource goaxle.Resource) (err error) {
+	data, err := server.Encode(resource)
+	if err != nil {
+		return err
+	}
+	return this.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := resources(tx, resource.Kind())
+		if err != nil {
+			return err
+		}
+		if bucket.Get([]byte(resource.ID())) != nil {
+			return server.Exists(resource.Kind(), resource.ID())
+		}
+		return bucket.Put([]byte(resource.ID()), data)
+	})
+}
+
+func (this *Store) Update(resource goaxle.Resource) (err error) {
+	data, err := server.Encode(resource)
+	if err != nil {
+		return err
+	}
+	return this.db.Update(func(tx *bolt.Tx) error {
+		if err := exists(tx, resource.Kind(), resource.ID()); err != nil {
+			return err
+		}
+		bucket, _ := resources(tx, resource.Kind())
+		return bucket.Put([]byte(resource.ID()), data)
+	})
+}
+
+func (this *Store) Delete(kind goaxle.Kind, identifier string) (err error) {
+	return this.db.Update(func(tx *bolt.Tx) error {
+		if err := exists(tx, kind, identifier); err != nil {
+			return err
+		}
+		bucket, _ := resources(tx, kind)
+		if err := bucket.Delete([]byte(identifier)); err != nil {
+			return err
+		}
+		if kind == goaxle.KIND_KEY {
+			for _, ownerKind := range ownerKinds {
+				if err := unlinkAll(tx, LINKED_BY_BUCKET, LINKED_BUCKET, ownerKind, identifier); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return unlinkAll(tx, LINKED_BUCKET, LINKED_BY_BUCKET, kind, identifier)
+	})
+}
+
+// unlinkAll removes every link of identifier, found under from, and the
+// matching entries under reverse.
+func unlinkAll(tx *bolt.Tx, from []byte, reverse []byte, ownerKind goaxle.Kind, identifier string) error {
+	links := tx.Bucket(from).Bucket([]byte(ownerKind))
+	linked := links.Bucket([]byte(identifier))
+	if linked == nil {
+		return nil
+	}
+	reverseLinks := tx.Bucket(reverse).Bucket([]byte(ownerKind))
+	err := linked.ForEach(func(other []byte, _ []byte) error {
+		if bucket := reverseLinks.Bucket(other); bucket != nil {
+			return bucket.Delete([]byte(identifier))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return links.DeleteBucket([]byte(identifier))
+}
+
+func (this *Store) List(kind goaxle.Kind) (identifiers []string, err error) {
+	err = this.db.View(func(tx *bolt.Tx) error {
+		bucket, err := resources(tx, kind)
+		if err != nil {
+			return err
+		}
+		identifiers = keys(bucket)
+		return nil
+	})
+	return identifiers, err
+}
+
+func (this *Store) Link(kind goaxle.Kind, owner string, key string) (err error) {
+	if err = server.CheckLinkKind(kind); err != nil {
+		return err
+	}
+	return this.db.Update(func(tx *bolt.Tx) error {
+		if err := exists(tx, kind, owner); err != nil {
+			return err
+		}
+		if err := exists(tx, goaxle.KIND_KEY, key); err != nil {
+			return err
+		}
+		linked, err := tx.Bucket(LINKED_BUCKET).Bucket([]byte(kind)).CreateBucketIfNotExists([]byte(owner))
+		if err != nil {
+			return err
+		}
+		if err := linked.Put([]byte(key), []byte{}); err != nil {
+			return err
+		}
+		linkedBy, err := tx.Bucket(LINKED_BY_BUCKET).Bucket([]byte(kind)).CreateBucketIfNotExists([]byte(key))
+		if err != nil {
+			return err
+		}
+		return linkedBy.Put([]byte(owner), []byte{})
+	})
+}
+
+func (this *Store) Unlink(kind goaxle.Kind, owner string, key string) (err error) {
+	if err = server.CheckLinkKind(kind); err != nil {
+		return err
+	}
+	return this.db.Update(func(tx *bolt.Tx) error {
+		if linked := tx.Bucket(LINKED_BUCKET).Bucket([]byte(kind)).Bucket([]byte(owner)); linked != nil {
+			if err := linked.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		if linkedBy := tx.Bucket(LINKED_BY_BUCKET).Bucket([]byte(kind)).Bucket([]byte(key)); linkedBy != nil {
+			return linkedBy.Delete([]byte(owner))
+		}
+		return nil
+	})
+}
+
+func (this *Store) Linked(kind goaxle.Kind, identifier string) (out []string, err error) {
+	err = this.db.View(func(tx *bolt.Tx) error {
+		if err := exists(tx, kind, identifier); err != nil {
+			return err
+		}
+		var bucket *bolt.Bucket
+		if kind == goaxle.KIND_KEY {
+			bucket = tx.Bucket(LINKED_BY_BUCKET).Bucket([]byte(goaxle.KIND_API)).Bucket([]byte(identifier))
+		} else {
+			bucket = tx.Bucket(LINKED_BUCKET).Bucket([]byte(kind)).Bucket([]byte(identifier))
+		}
+		out = keys(bucket)
+		return nil
+	})
+	return out, err
+}
+
+// keys returns the keys of bucket, which may be nil, in order.
+func keys(bucket *bolt.Bucket) (out []string) {
+	out = []string{}
+	if bucket == nil {
+		return out
+	}
+	bucket.ForEach(func(key []byte, _ []byte) error {
+		out = append(out, string(key))
+		return nil
+	})
+	return out
+}
+
+// counterKey is the granularity, a NUL, the bucket as a big endian uint64
+// with the sign flipped so keys sort by time, then the api, key, hit type
+// and status separated by NULs.
+func counterKey(granularity goaxle.Granularity, bucket int64, api string, key string, hitType goaxle.HitType, status int) []byte {
+	out := counterPrefix(granularity, bucket)
+	for _, part := range []string{api, key, string(hitType)} {
+		out = append(out, part...)
+		out = append(out, 0)
+	}
+	return strconv.AppendInt(out, int64(status), 10)
+}
+
+func counterPrefix(granularity goaxle.Granularity, bucket int64) []byte {
+	out := append([]byte(granularity), 0)
+	return binary.BigEndian.AppendUint64(out, uint64(bucket)^(1<<63))
+}
+
+func (this *Store) RecordHit(hit server.Hit) (err error) {
+	// Batch coalesces concurrent hits into one write
+	return this.db.Batch(func(tx *bolt.Tx) error {
+		counters := tx.Bucket(COUNTERS_BUCKET)
+		for _, granularity := range server.GRANULARITIES {
+			bucket, _ := server.Bucket(granularity, hit.Time)
+			key := counterKey(granularity, bucket, hit.Api, hit.Key, hit.HitType, hit.Status)
+			count := uint64(0)
+			if value := counters.Get(key); value != nil {
+				count = binary.BigEndian.Uint64(value)
+			}
+			if err := counters.Put(key, binary.BigEndian.AppendUint64(nil, count+1)); err != nil {
+				return err
+			}
+			if oldest, limited := server.Oldest(granularity, hit.Time); limited {
+				if err := prune(counters, granularity, oldest); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// prune deletes the counters of granularity in buckets before oldest.
+func prune(counters *bolt.Bucket, granularity goaxle.Granularity, oldest int64) error {
+	start := append([]byte(granularity), 0)
+	end := counterPrefix(granularity, oldest)
+	cursor := counters.Cursor()
+	// seek again after each delete, as the cursor may skip the next key
+	for key, _ := cursor.Seek(start); key != nil && bytes.Compare(key, end) < 0; key, _ = cursor.Seek(start) {
+		if err := cursor.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *Store) Counts(query server.CountQuery) (out server.Counts, err error) {
+	from, err := server.Bucket(query.Granularity, query.From)
+	if err != nil {
+		return nil, err
+	}
+	to, _ := server.Bucket(query.Granularity, query.To)
+	start := counterPrefix(query.Granularity, from)
+	end := counterPrefix(query.Granularity, to+1)
+	out = make(server.Counts)
+	err = this.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(COUNTERS_BUCKET).Cursor()
+		for key, value := cursor.Seek(start); key != nil && bytes.Compare(key, end) < 0; key, value = cursor.Next() {
+			parts := bytes.Split(key[len(end):], []byte{0})
+			if len(parts) != 4 {
+				return fmt.Errorf("Unable to parse counter %q", key)
+			}
+			if (query.Api != "" && string(parts[0]) != query.Api) || (query.Key != "" && string(parts[1]) != query.Key) {
+				continue
+			}
+			status, err := strconv.Atoi(string(parts[3]))
+			if err != nil {
+				return fmt.Errorf("Unable to parse counter %q: %s", key, err)
+			}
+			bucket := int64(binary.BigEndian.Uint64(key[len(end)-8:len(end)]) ^ (1 << 63))
+			out.Add(goaxle.HitType(parts[2]), bucket, status, int(binary.BigEndian.Uint64(value)))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+/* ex: set noexpandtab: */
@@ -0,0 +1,79 @@
+package boltstore
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	goaxle "github.com/rjohnsondev/go-axle"
+	"github.com/rjohnsondev/go-axle/server"
+	"github.com/rjohnsondev/go-axle/server/storagetest"
+)
+
+func TestStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) server.Storage {
+		store, err := Open(filepath.Join(t.TempDir(), "axle.db"))
+		if err != nil {
+			t.Fatalf("Unable to open store: %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
+
+func TestStoreReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "axle.db")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Unable to open store: %v", err)
+	}
+	at := time.Unix(1380000000, 0)
+	if err = store.Create(goaxle.NewApi("", "weather", "weather.example.com")); err != nil {
+		t.Fatalf("Unable to create api: %v", err)
+	}
+	if err = store.Create(goaxle.NewKey("", "alpha")); err != nil {
+		t.Fatalf("Unable to create key: %v", err)
+	}
+	if err = store.Link(goaxle.KIND_API, "weather", "alpha"); err != nil {
+		t.Fatalf("Unable to link key: %v", err)
+	}
+	if err = store.RecordHit(server.Hit{Time: at, Api: "weather", Key: "alpha", HitType: goaxle.HIT_TYPE_CACHED, Status: 200}); err != nil {
+		t.Fatalf("Unable to record hit: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Unable to close store: %v", err)
+	}
+
+	store, err = Open(path)
+	if err != nil {
+		t.Fatalf("Unable to reopen store: %v", err)
+	}
+	defer store.Close()
+	if _, err := store.Get(goaxle.KIND_API, "weather"); err != nil {
+		t.Fatalf("Api lost: %v", err)
+	}
+	linked, err := store.Linked(goaxle.KIND_KEY, "alpha")
+	if err != nil || len(linked) != 1 || linked[0] != "weather" {
+		t.Fatalf("Link lost: %v %v", linked, err)
+	}
+	counts, err := store.Counts(server.CountQuery{Granularity: goaxle.GRANULARITY_HOURS, From: at, To: at})
+	hour, _ := server.Bucket(goaxle.GRANULARITY_HOURS, at)
+	if err != nil || counts[goaxle.HIT_TYPE_CACHED][hour][200] != 1 {
+		t.Fatalf("Counters lost: %v %v", counts, err)
+	}
+
+	// only one process may hold the file
+	if _, err := Open(path); err == nil {
+		t.Fatalf("Expected an error opening a locked store")
+	}
+}
+
+func TestCounterKeysSortByTime(t *testing.T) {
+	before := counterKey(goaxle.GRANULARITY_SECONDS, -5, "b", "b", goaxle.HIT_TYPE_CACHED, 200)
+	after := counterKey(goaxle.GRANULARITY_SECONDS, 5, "a", "a", goaxle.HIT_TYPE_CACHED, 200)
+	if string(before) >= string(after) {
+		t.Fatalf("Counter keys out of order")
+	}
+}
+
+/* ex: set noexpandtab: */
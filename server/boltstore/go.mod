@@ -0,0 +1,13 @@
+module github.com/rjohnsondev/go-axle/server/boltstore
+
+go 1.26.0
+
+require (
+	github.com/rjohnsondev/go-axle v0.0.0-20261018214523-f6f9b7602562
+	go.etcd.io/bbolt v1.5.0
+)
+
+require golang.org/x/sys v0.48.0 // indirect
+
+// Builds against this checkout during development.
+replace github.com/rjohnsondev/go-axle => ../..
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"sort"
+	"sync"
+
+	goaxle "github.com/rjohnsondev/go-axle"
+)
+
+// counter identifies one hit counter within a bucket.
+type counter struct {
+	api     string
+	key     string
+	hitType goaxle.HitType
+	status  int
+}
+
+// MemoryStorage is a Storage which keeps everything in memory.  It is lost
+// when the process exits, so is mostly useful for tests and development.
+type MemoryStorage struct {
+	mu sync.RWMutex
+
+	// Encoded resources, by kind then identifier.
+	resources map[goaxle.Kind]map[string][]byte
+
+	// Linked keys, by owner kind, then owner, then key.
+	links map[goaxle.Kind]map[string]map[string]bool
+
+	// Hit counters, by granularity, then bucket.
+	counters map[goaxle.Granularity]map[int64]map[counter]int
+
+	// The oldest bucket kept of each granularity, so counters are only
+	// pruned once it moves on.
+	oldest map[goaxle.Granularity]int64
+}
+
+// NewMemoryStorage creates an empty MemoryStorage.
+func NewMemoryStorage() (out *MemoryStorage) {
+	return &MemoryStorage{
+		resources: map[goaxle.Kind]map[string][]byte{
+			goaxle.KIND_API:     {},
+			goaxle.KIND_KEY:     {},
+			goaxle.KIND_KEYRING: {},
+		},
+		links: map[goaxle.Kind]map[string]map[string]bool{
+			goaxle.KIND_API:     {},
+			goaxle.KIND_KEYRING: {},
+		},
+		counters: make(map[goaxle.Granularity]map[int64]map[counter]int),
+		oldest:   make(map[goaxle.Granularity]int64),
+	}
+}
+
+func (this *MemoryStorage) Get(kind goaxle.Kind, identifier string) (resource goaxle.Resource, err error) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	data, exists := this.resources[kind][identifier]
+	if !exists {
+		return nil, NotFound(kind, identifier)
+	}
+	return Decode(kind, identifier, data)
+}
+
+func (this *MemoryStorage) Create(resource goaxle.Resource) (err error) {
+	data, err := Encode(resource)
+	if err != nil {
+		return err
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	resources, known := this.resources[resource.Kind()]
+	if !known {
+		return UnknownKind(resource.Kind())
+	}
+	if _, exists := resources[resource.ID()]; exists {
+		return Exists(resource.Kind(), resource.ID())
+	}
+	resources[resource.ID()] = data
+	return nil
+}
+
+func (this *MemoryStorage) Update(resource goaxle.Resource) (err error) {
+	data, err := Encode(resource)
+	if err != nil {
+		return err
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if _, exists := this.resources[resource.Kind()][resource.ID()]; !exists {
+		return NotFound(resource.Kind(), resource.ID())
+	}
+	this.resources[resource.Kind()][resource.ID()] = data
+	return nil
+}
+
+func (this *MemoryStorage) Delete(kind goaxle.Kind, identifier string) (err error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if _, exists := this.resources[kind][identifier]; !exists {
+		return NotFound(kind, identifier)
+	}
+	delete(this.resources[kind], identifier)
+	if kind == goaxle.KIND_KEY {
+		for _, owners := range this.links {
+			for _, keys := range owners {
+				delete(keys, identifier)
+			}
+		}
+	} else {
+		delete(this.links[kind], identifier)
+	}
+	return nil
+}
+
+func (this *MemoryStorage) List(kind goaxle.Kind) (identifiers []string, err error) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	resources, known := this.resources[kind]
+	if !known {
+		return nil, UnknownKind(kind)
+	}
+	identifiers = make([]string, 0, len(resources))
+	for identifier := range resources {
+		identifiers = append(identifiers, identifier)
+	}
+	sort.Strings(identifiers)
+	return identifiers, nil
+}
+
+func (this *MemoryStorage) Link(kind goaxle.Kind, owner string, key string) (err error) {
+	if err = CheckLinkKind(kind); err != nil {
+		return err
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if _, exists := this.resources[kind][owner]; !exists {
+		return NotFound(kind, owner)
+	}
+	if _, exists := this.resources[goaxle.KIND_KEY][key]; !exists {
+		return NotFound(goaxle.KIND_KEY, key)
+	}
+	if _, exists := this.links[kind][owner]; !exists {
+		this.links[kind][owner] = make(map[string]bool)
+	}
+	this.links[kind][owner][key] = true
+	return nil
+}
+
+func (this *MemoryStorage) Unlink(kind goaxle.Kind, owner string, key string) (err error) {
+	if err = CheckLinkKind(kind); err != nil {
+		return err
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	delete(this.links[kind][owner], key)
+	return nil
+}
+
+func (this *MemoryStorage) Linked(kind goaxle.Kind, identifier string) (out []string, err error) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	if _, exists := this.resources[kind][identifier]; !exists {
+		return nil, NotFound(kind, identifier)
+	}
+	out = []string{}
+	if kind == goaxle.KIND_KEY {
+		for api, keys := range this.links[goaxle.KIND_API] {
+			if keys[identifier] {
+				out = append(out, api)
+			}
+		}
+	} else {
+		for key := range this.links[kind][identifier] {
+			out = append(out, key)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func (this *MemoryStorage) RecordHit(hit Hit) (err error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	for _, granularity := range GRANULARITIES {
+		buckets, exists := this.counters[granularity]
+		if !exists {
+			buckets = make(map[int64]map[counter]int)
+			this.counters[granularity] = buckets
+		}
+		bucket, _ := Bucket(granularity, hit.Time)
+		if _, exists := buckets[bucket]; !exists {
+			buckets[bucket] = make(map[counter]int)
+		}
+		buckets[bucket][counter{hit.Api, hit.Key, hit.HitType, hit.Status}]++
+
+		oldest, limited := Oldest(granularity, hit.Time)
+		if last, pruned := this.oldest[granularity]; !limited || (pruned && oldest <= last) {
+			continue
+		}
+		this.oldest[granularity] = oldest
+		for bucket := range buckets {
+			if bucket < oldest {
+				delete(buckets, bucket)
+			}
+		}
+	}
+	return nil
+}
+
+func (this *MemoryStorage) Counts(query CountQuery) (out Counts, err error) {
+	from, err := Bucket(query.Granularity, query.From)
+	if err != nil {
+		return nil, err
+	}
+	to, _ := Bucket(query.Granularity, query.To)
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	out = make(Counts)
+	for bucket, counters := range this.counters[query.Granularity] {
+		if bucket < from || bucket > to {
+			continue
+		}
+		for c, count := range counters {
+			if (query.Api != "" && c.api != query.Api) || (query.Key != "" && c.key != query.Key) {
+				continue
+			}
+			out.Add(c.hitType, bucket, c.status, count)
+		}
+	}
+	return out, nil
+}
+
+/* ex: set noexpandtab: */
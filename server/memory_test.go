@@ -0,0 +1,16 @@
+package server_test
+
+import (
+	"testing"
+
+	"github.com/rjohnsondev/go-axle/server"
+	"github.com/rjohnsondev/go-axle/server/storagetest"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) server.Storage {
+		return server.NewMemoryStorage()
+	})
+}
+
+/* ex: set noexpandtab: */
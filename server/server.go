@@ -0,0 +1,539 @@
+// Package server serves the ApiAxle v1 management api, as consumed by the
+// goaxle client, on top of a pluggable Storage.
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	goaxle "github.com/rjohnsondev/go-axle"
+)
+
+// VERSION is reported by the info endpoint.
+const VERSION = "1.0.0"
+
+// Server is an http.Handler serving the ApiAxle v1 management api.
+type Server struct {
+	storage Storage
+	mux     *http.ServeMux
+
+	// held by handlers which change resources or links, so a read followed
+	// by a write can't interleave with another request's
+	writeMu sync.Mutex
+}
+
+// handler serves one endpoint, returning the results to wrap in an envelope.
+type handler func(r *http.Request) (results interface{}, err error)
+
+// New creates a Server backed by storage.
+func New(storage Storage) (out *Server) {
+	out = &Server{storage: storage, mux: http.NewServeMux()}
+	out.mux.HandleFunc("GET /v1/ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "pong")
+	})
+	out.handle("GET /v1/info", out.info)
+
+	for _, kind := range []goaxle.Kind{goaxle.KIND_API, goaxle.KIND_KEY, goaxle.KIND_KEYRING} {
+		path := "/v1/" + string(kind)
+		out.handle("GET "+path+"/{id}", out.get(kind))
+		out.handle("POST "+path+"/{id}", out.create(kind))
+		out.handle("PUT "+path+"/{id}", out.update(kind))
+		out.handle("DELETE "+path+"/{id}", out.delete(kind))
+		out.handle("GET "+path+"/{id}/stats", out.stats(kind))
+		out.handle("GET "+path+"s", out.list(kind))
+	}
+	for _, kind := range []goaxle.Kind{goaxle.KIND_API, goaxle.KIND_KEYRING} {
+		path := "/v1/" + string(kind)
+		out.handle("PUT "+path+"/{id}/linkkey/{key}", out.link(kind, true))
+		out.handle("PUT "+path+"/{id}/unlinkkey/{key}", out.link(kind, false))
+		out.handle("GET "+path+"/{id}/keys", out.linked(kind, goaxle.KIND_KEY))
+	}
+	out.handle("GET /v1/key/{id}/apis", out.linked(goaxle.KIND_KEY, goaxle.KIND_API))
+
+	out.handle("GET /v1/apis/charts", out.charts(goaxle.KIND_API, ""))
+	out.handle("GET /v1/keys/charts", out.charts(goaxle.KIND_KEY, ""))
+	out.handle("GET /v1/api/{id}/keycharts", out.charts(goaxle.KIND_KEY, goaxle.KIND_API))
+	out.handle("GET /v1/key/{id}/apicharts", out.charts(goaxle.KIND_API, goaxle.KIND_KEY))
+	return out
+}
+
+// ServeHTTP implements http.Handler.
+func (this *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	this.mux.ServeHTTP(w, r)
+}
+
+// handle registers fn, wrapping what it returns in an ApiAxle envelope.
+func (this *Server) handle(pattern string, fn handler) {
+	this.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		results, err := fn(r)
+		status := http.StatusOK
+		if err != nil {
+			var errType string
+			status, errType = classify(err)
+			results = map[string]interface{}{
+				"error": map[string]string{"type": errType, "message": err.Error()},
+			}
+		}
+		body, err := json.Marshal(map[string]interface{}{
+			"meta":    map[string]int{"version": 1, "status_code": status},
+			"results": results,
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Unable to encode response: %s", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(body)
+	})
+}
+
+// badRequest is an error caused by the request rather than the server.
+type badRequest struct {
+	err error
+}
+
+func (this *badRequest) Error() string {
+	return this.err.Error()
+}
+
+func (this *badRequest) Unwrap() error {
+	return this.err
+}
+
+// invalid returns a badRequest error.
+func invalid(format string, args ...interface{}) error {
+	return &badRequest{err: fmt.Errorf(format, args...)}
+}
+
+// classify returns the status and ApiAxle error type reported for err.
+func classify(err error) (status int, errType string) {
+	var validation *goaxle.ValidationError
+	var bad *badRequest
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound, "NotFoundError"
+	case errors.Is(err, ErrExists):
+		return http.StatusBadRequest, "AlreadyExistsError"
+	case errors.As(err, &validation):
+		return http.StatusBadRequest, "InvalidFieldError"
+	case errors.As(err, &bad):
+		return http.StatusBadRequest, "BadRequestError"
+	}
+	return http.StatusInternalServerError, "ServerError"
+}
+
+func (this *Server) info(r *http.Request) (results interface{}, err error) {
+	return map[string]string{"app": "goaxle", "version": VERSION}, nil
+}
+
+func (this *Server) get(kind goaxle.Kind) handler {
+	return func(r *http.Request) (interface{}, error) {
+		return this.storage.Get(kind, r.PathValue("id"))
+	}
+}
+
+func (this *Server) create(kind goaxle.Kind) handler {
+	return func(r *http.Request) (interface{}, error) {
+		resource := defaults(kind, r.PathValue("id"))
+		if err := decodeBody(r, resource); err != nil {
+			return nil, err
+		}
+		if err := validate(resource); err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		stamp(resource, now, now)
+
+		this.writeMu.Lock()
+		defer this.writeMu.Unlock()
+
+		// keys may be linked with apis as they are created.  The links are
+		// what count, so the key itself doesn't keep a copy to go stale
+		var forApis []string
+		if key, isKey := resource.(*goaxle.Key); isKey {
+			forApis, key.ForApis = key.ForApis, nil
+			for _, api := range forApis {
+				if _, err := this.storage.Get(goaxle.KIND_API, api); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if err := this.storage.Create(resource); err != nil {
+			return nil, err
+		}
+		for _, api := range forApis {
+			if err := this.storage.Link(goaxle.KIND_API, api, resource.ID()); err != nil {
+				// don't leave a half linked key behind; deleting it
+				// removes the links already made
+				if deleteErr := this.storage.Delete(kind, resource.ID()); deleteErr != nil {
+					return nil, errors.Join(err, deleteErr)
+				}
+				return nil, err
+			}
+		}
+		return resource, nil
+	}
+}
+
+func (this *Server) update(kind goaxle.Kind) handler {
+	return func(r *http.Request) (interface{}, error) {
+		this.writeMu.Lock()
+		defer this.writeMu.Unlock()
+		old, err := this.storage.Get(kind, r.PathValue("id"))
+		if err != nil {
+			return nil, err
+		}
+		// fields missing from the body keep their current values
+		resource, err := copyResource(old)
+		if err != nil {
+			return nil, err
+		}
+		if err := decodeBody(r, resource); err != nil {
+			return nil, err
+		}
+		if err := validate(resource); err != nil {
+			return nil, err
+		}
+		restoreCreated(resource, old)
+		if key, isKey := resource.(*goaxle.Key); isKey {
+			key.ForApis = nil
+		}
+		stamp(resource, time.Time{}, time.Now())
+		if err := this.storage.Update(resource); err != nil {
+			return nil, err
+		}
+		return map[string]goaxle.Resource{"new": resource, "old": old}, nil
+	}
+}
+
+func (this *Server) delete(kind goaxle.Kind) handler {
+	return func(r *http.Request) (interface{}, error) {
+		this.writeMu.Lock()
+		defer this.writeMu.Unlock()
+		if err := this.storage.Delete(kind, r.PathValue("id")); err != nil {
+			return nil, err
+		}
+		return true, nil
+	}
+}
+
+func (this *Server) list(kind goaxle.Kind) handler {
+	return func(r *http.Request) (interface{}, error) {
+		identifiers, err := this.storage.List(kind)
+		if err != nil {
+			return nil, err
+		}
+		return this.listing(r, kind, identifiers)
+	}
+}
+
+func (this *Server) link(kind goaxle.Kind, link bool) handler {
+	return func(r *http.Request) (interface{}, error) {
+		this.writeMu.Lock()
+		defer this.writeMu.Unlock()
+		owner, key := r.PathValue("id"), r.PathValue("key")
+		var err error
+		if link {
+			err = this.storage.Link(kind, owner, key)
+		} else {
+			if _, err = this.storage.Get(kind, owner); err != nil {
+				return nil, err
+			}
+			err = this.storage.Unlink(kind, owner, key)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return this.storage.Get(goaxle.KIND_KEY, key)
+	}
+}
+
+// linked lists the resources of kind linked with an owner of ownerKind.
+func (this *Server) linked(ownerKind goaxle.Kind, kind goaxle.Kind) handler {
+	return func(r *http.Request) (interface{}, error) {
+		identifiers, err := this.storage.Linked(ownerKind, r.PathValue("id"))
+		if err != nil {
+			return nil, err
+		}
+		return this.listing(r, kind, identifiers)
+	}
+}
+
+// listing applies the from, to and resolve parameters to identifiers, which
+// are of kind.
+func (this *Server) listing(r *http.Request, kind goaxle.Kind, identifiers []string) (results interface{}, err error) {
+	from, err := intParam(r, "from", 0)
+	if err != nil {
+		return nil, err
+	}
+	to, err := intParam(r, "to", 10)
+	if err != nil {
+		return nil, err
+	}
+	// to is inclusive
+	if from < 0 {
+		from = 0
+	}
+	if to >= len(identifiers) {
+		to = len(identifiers) - 1
+	}
+	selected := []string{}
+	if from <= to {
+		selected = identifiers[from : to+1]
+	}
+	if r.URL.Query().Get("resolve") != "true" {
+		return selected, nil
+	}
+	resolved := make(map[string]goaxle.Resource, len(selected))
+	for _, identifier := range selected {
+		resolved[identifier], err = this.storage.Get(kind, identifier)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
+
+func (this *Server) stats(kind goaxle.Kind) handler {
+	return func(r *http.Request) (interface{}, error) {
+		identifier := r.PathValue("id")
+		if _, err := this.storage.Get(kind, identifier); err != nil {
+			return nil, err
+		}
+		granularity, err := granularityParam(r)
+		if err != nil {
+			return nil, err
+		}
+		to, err := intParam(r, "to", int(time.Now().Unix()))
+		if err != nil {
+			return nil, err
+		}
+		from, err := intParam(r, "from", to)
+		if err != nil {
+			return nil, err
+		}
+		query := CountQuery{
+			Granularity: granularity,
+			From:        time.Unix(int64(from), 0),
+			To:          time.Unix(int64(to), 0),
+			Api:         r.URL.Query().Get("forapi"),
+			Key:         r.URL.Query().Get("forkey"),
+		}
+
+		var queries []CountQuery
+		switch kind {
+		case goaxle.KIND_API:
+			query.Api = identifier
+			queries = append(queries, query)
+		case goaxle.KIND_KEY:
+			query.Key = identifier
+			queries = append(queries, query)
+		case goaxle.KIND_KEYRING:
+			// keyrings count the hits of their keys
+			keys, err := this.storage.Linked(kind, identifier)
+			if err != nil {
+				return nil, err
+			}
+			for _, key := range keys {
+				if query.Key == "" || query.Key == key {
+					keyQuery := query
+					keyQuery.Key = key
+					queries = append(queries, keyQuery)
+				}
+			}
+		}
+
+		results := make(map[goaxle.HitType]map[string]map[string]int)
+		for _, hitType := range HIT_TYPES {
+			results[hitType] = make(map[string]map[string]int)
+		}
+		for _, query := range queries {
+			counts, err := this.storage.Counts(query)
+			if err != nil {
+				return nil, err
+			}
+			for hitType, buckets := range counts {
+				if _, exists := results[hitType]; !exists {
+					results[hitType] = make(map[string]map[string]int)
+				}
+				for bucket, statuses := range buckets {
+					at := strconv.FormatInt(bucket, 10)
+					if _, exists := results[hitType][at]; !exists {
+						results[hitType][at] = make(map[string]int)
+					}
+					for status, count := range statuses {
+						results[hitType][at][strconv.Itoa(status)] += count
+					}
+				}
+			}
+		}
+		return results, nil
+	}
+}
+
+// charts ranks resources of kind by their hits in the current period of the
+// requested granularity.  If ownerKind is set, only resources linked with
+// the owner in the path are ranked, counting only hits involving the owner.
+func (this *Server) charts(kind goaxle.Kind, ownerKind goaxle.Kind) handler {
+	return func(r *http.Request) (interface{}, error) {
+		granularity, err := granularityParam(r)
+		if err != nil {
+			return nil, err
+		}
+		var identifiers []string
+		if ownerKind == "" {
+			identifiers, err = this.storage.List(kind)
+		} else {
+			identifiers, err = this.storage.Linked(ownerKind, r.PathValue("id"))
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		charts := make(map[string]int)
+		for _, identifier := range identifiers {
+			query := CountQuery{Granularity: granularity, From: now, To: now}
+			if kind == goaxle.KIND_API {
+				query.Api, query.Key = identifier, r.PathValue("id")
+			} else {
+				query.Key, query.Api = identifier, r.PathValue("id")
+			}
+			counts, err := this.storage.Counts(query)
+			if err != nil {
+				return nil, err
+			}
+			total := 0
+			for _, buckets := range counts {
+				for _, statuses := range buckets {
+					for _, count := range statuses {
+						total += count
+					}
+				}
+			}
+			if total > 0 {
+				charts[identifier] = total
+			}
+		}
+		return goaxle.TopCharts(charts, goaxle.CHARTS_LIMIT), nil
+	}
+}
+
+// defaults returns a new resource with the defaults ApiAxle applies to
+// fields missing when it is created.
+func defaults(kind goaxle.Kind, identifier string) (resource goaxle.Resource) {
+	switch kind {
+	case goaxle.KIND_API:
+		return goaxle.NewApi("", identifier, "")
+	case goaxle.KIND_KEY:
+		return goaxle.NewKey("", identifier)
+	}
+	return goaxle.NewKeyRing("", identifier)
+}
+
+// validate checks resource the way the client does before saving.
+func validate(resource goaxle.Resource) error {
+	if validator, ok := resource.(interface{ Validate() error }); ok {
+		return validator.Validate()
+	}
+	return nil
+}
+
+// stamp sets when resource was created and updated, leaving zero times
+// alone.
+func stamp(resource goaxle.Resource, created time.Time, updated time.Time) {
+	createdAt := float64(created.UnixMilli())
+	updatedAt := float64(updated.UnixMilli())
+	switch object := resource.(type) {
+	case *goaxle.Api:
+		if !created.IsZero() {
+			object.CreatedAt = createdAt
+		}
+		object.UpdatedAt = updatedAt
+	case *goaxle.Key:
+		if !created.IsZero() {
+			object.CreatedAt = createdAt
+		}
+		object.UpdatedAt = updatedAt
+	case *goaxle.KeyRing:
+		if !created.IsZero() {
+			object.CreatedAt = createdAt
+		}
+		object.UpdatedAt = updatedAt
+	}
+}
+
+// copyResource returns a copy of resource which can be changed without
+// affecting it.
+func copyResource(resource goaxle.Resource) (out goaxle.Resource, err error) {
+	data, err := Encode(resource)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(resource.Kind(), resource.ID(), data)
+}
+
+// restoreCreated puts back when resource was created, from old, as clients
+// can't change it.
+func restoreCreated(resource goaxle.Resource, old goaxle.Resource) {
+	switch object := resource.(type) {
+	case *goaxle.Api:
+		object.CreatedAt = old.(*goaxle.Api).CreatedAt
+	case *goaxle.Key:
+		object.CreatedAt = old.(*goaxle.Key).CreatedAt
+	case *goaxle.KeyRing:
+		object.CreatedAt = old.(*goaxle.KeyRing).CreatedAt
+	}
+}
+
+// decodeBody decodes the JSON request body, if any, over resource.
+func decodeBody(r *http.Request, resource goaxle.Resource) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("Unable to read request: %s", err)
+	}
+	if len(body) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(body, resource); err != nil {
+		return invalid("Unable to parse %s: %s", resource.Kind(), err)
+	}
+	return nil
+}
+
+// intParam returns the named query parameter as an int, or fallback if it
+// is missing.
+func intParam(r *http.Request, name string, fallback int) (value int, err error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return fallback, nil
+	}
+	value, err = strconv.Atoi(raw)
+	if err != nil {
+		return 0, invalid("Invalid %s \"%s\": must be an integer", name, raw)
+	}
+	return value, nil
+}
+
+// granularityParam returns the granularity parameter, which defaults to
+// minutes.
+func granularityParam(r *http.Request) (granularity goaxle.Granularity, err error) {
+	granularity = goaxle.Granularity(r.URL.Query().Get("granularity"))
+	if granularity == "" {
+		return goaxle.GRANULARITY_MINUTES, nil
+	}
+	if _, known := granularitySeconds[granularity]; !known {
+		return "", invalid("Invalid granularity \"%s\"", granularity)
+	}
+	return granularity, nil
+}
+
+/* ex: set noexpandtab: */
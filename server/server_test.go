@@ -0,0 +1,255 @@
+package server_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	goaxle "github.com/rjohnsondev/go-axle"
+	"github.com/rjohnsondev/go-axle/server"
+)
+
+// newTestServer serves storage, returning the address for the client.
+func newTestServer(t *testing.T, storage server.Storage) string {
+	httpServer := httptest.NewServer(server.New(storage))
+	t.Cleanup(httpServer.Close)
+	return httpServer.URL + "/"
+}
+
+func TestServerResources(t *testing.T) {
+	address := newTestServer(t, server.NewMemoryStorage())
+
+	if err := goaxle.Ping(address); err != nil {
+		t.Fatalf("Unable to ping: %v", err)
+	}
+
+	api := goaxle.NewApi(address, "weather", "weather.example.com")
+	if err := api.Save(); err != nil {
+		t.Fatalf("Unable to create api: %v", err)
+	}
+	if err := goaxle.NewApi(address, "weather", "weather.example.com").Save(); err == nil {
+		t.Fatalf("Expected an error creating a duplicate api")
+	}
+	goaxle.ValidateBeforeSave = false
+	err := goaxle.NewApi(address, "broken", "").Save()
+	goaxle.ValidateBeforeSave = true
+	if err == nil || !strings.Contains(err.Error(), "endPoint") {
+		t.Fatalf("Expected the server to reject a missing endPoint, got %v", err)
+	}
+
+	key := goaxle.NewKey(address, "alpha")
+	key.ForApis = []string{"weather"}
+	if err := key.Save(); err != nil {
+		t.Fatalf("Unable to create key: %v", err)
+	}
+	apis, err := goaxle.KeyApis(address, "alpha")
+	if err != nil || len(apis) != 1 || apis[0].Identifier != "weather" {
+		t.Fatalf("Key not linked on creation: %v %v", apis, err)
+	}
+
+	fetched, err := goaxle.GetApi(address, "weather")
+	if err != nil {
+		t.Fatalf("Unable to get api: %v", err)
+	}
+	if fetched.ParseCreatedAt().IsZero() || fetched.EndPointTimeout != 2 {
+		t.Fatalf("Defaults not applied: %+v", fetched)
+	}
+	fetched.EndPoint = "weather2.example.com"
+	if err := fetched.Save(); err != nil {
+		t.Fatalf("Unable to update api: %v", err)
+	}
+	if err := fetched.Refresh(); err != nil || fetched.EndPoint != "weather2.example.com" {
+		t.Fatalf("Update not stored: %+v %v", fetched, err)
+	}
+
+	if err := goaxle.DeleteApi(address, "weather"); err != nil {
+		t.Fatalf("Unable to delete api: %v", err)
+	}
+	if _, err := goaxle.GetApi(address, "weather"); err == nil {
+		t.Fatalf("Expected an error getting a deleted api")
+	}
+	apis, err = goaxle.KeyApis(address, "alpha")
+	if err != nil || len(apis) != 0 {
+		t.Fatalf("Links survived deleting the api: %v %v", apis, err)
+	}
+	fetchedKey, err := goaxle.GetKey(address, "alpha")
+	if err != nil || len(fetchedKey.ForApis) != 0 {
+		t.Fatalf("Key kept stale forApis: %+v %v", fetchedKey, err)
+	}
+}
+
+func TestServerUpdate(t *testing.T) {
+	address := newTestServer(t, server.NewMemoryStorage())
+	key := goaxle.NewKey(address, "alpha")
+	if err := key.Save(); err != nil {
+		t.Fatalf("Unable to create key: %v", err)
+	}
+	created := key.CreatedAt
+
+	put := func(body string) {
+		request, _ := http.NewRequest("PUT", address+"v1/key/alpha", strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Errorf("Unable to update key: %v", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Unable to update key, got status %d", resp.StatusCode)
+		}
+	}
+
+	put(`{"createdAt":1,"sharedSecret":"s3cret"}`)
+	if err := key.Refresh(); err != nil || key.CreatedAt != created || key.SharedSecret != "s3cret" {
+		t.Fatalf("Expected createdAt to be kept, got %+v %v", key, err)
+	}
+
+	// concurrent updates of different fields all land
+	var wg sync.WaitGroup
+	for x := 0; x < 20; x++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if x%2 == 0 {
+				put(`{"qps":7}`)
+			} else {
+				put(`{"qpd":700}`)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := key.Refresh(); err != nil || key.Qps != 7 || key.Qpd != 700 || key.SharedSecret != "s3cret" {
+		t.Fatalf("Updates were lost: %+v %v", key, err)
+	}
+}
+
+// failingLinks is a Storage whose Link fails for one api.
+type failingLinks struct {
+	server.Storage
+	api string
+}
+
+func (this *failingLinks) Link(kind goaxle.Kind, owner string, key string) error {
+	if owner == this.api {
+		return errors.New("link failed")
+	}
+	return this.Storage.Link(kind, owner, key)
+}
+
+func TestServerCreateRollsBack(t *testing.T) {
+	storage := &failingLinks{Storage: server.NewMemoryStorage(), api: "maps"}
+	address := newTestServer(t, storage)
+	for _, name := range []string{"weather", "maps"} {
+		if err := goaxle.NewApi(address, name, name+".example.com").Save(); err != nil {
+			t.Fatalf("Unable to create api: %v", err)
+		}
+	}
+
+	key := goaxle.NewKey(address, "alpha")
+	key.ForApis = []string{"weather", "maps"}
+	if err := key.Save(); err == nil {
+		t.Fatalf("Expected creating the key to fail")
+	}
+	if _, err := goaxle.GetKey(address, "alpha"); err == nil {
+		t.Fatalf("Key was left behind after linking failed")
+	}
+	if linked, err := storage.Linked(goaxle.KIND_API, "weather"); err != nil || len(linked) != 0 {
+		t.Fatalf("Links were left behind after linking failed: %v %v", linked, err)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	address := newTestServer(t, server.NewMemoryStorage())
+	for path, status := range map[string]int{
+		"v1/api/missing":                 http.StatusNotFound,
+		"v1/key/missing/stats":           http.StatusNotFound,
+		"v1/apis?from=x":                 http.StatusBadRequest,
+		"v1/apis/charts?granularity=eon": http.StatusBadRequest,
+	} {
+		resp, err := http.Get(address + path)
+		if err != nil {
+			t.Fatalf("Unable to get %s: %v", path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Fatalf("Expected %d from %s, got %d", status, path, resp.StatusCode)
+		}
+		if _, err := goaxle.DecodeEnvelope[map[string]interface{}](body); err == nil {
+			t.Fatalf("Expected an error envelope from %s, got %s", path, body)
+		}
+	}
+}
+
+func TestServerListings(t *testing.T) {
+	address := newTestServer(t, server.NewMemoryStorage())
+	for _, identifier := range []string{"a", "b", "c", "d"} {
+		if err := goaxle.NewKey(address, identifier).Save(); err != nil {
+			t.Fatalf("Unable to create key: %v", err)
+		}
+	}
+	keys, err := goaxle.Keys(address, 1, 2)
+	if err != nil {
+		t.Fatalf("Unable to list keys: %v", err)
+	}
+	if len(keys) != 2 || keys[0].Identifier != "b" || keys[1].Identifier != "c" {
+		t.Fatalf("Expected keys b and c, got %v", keys)
+	}
+	keys, err = goaxle.Keys(address, 3, 100)
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("Expected one key past the end, got %v %v", keys, err)
+	}
+}
+
+func TestServerStats(t *testing.T) {
+	storage := server.NewMemoryStorage()
+	address := newTestServer(t, storage)
+	goaxle.NewApi(address, "weather", "weather.example.com").Save()
+	goaxle.NewKey(address, "alpha").Save()
+	goaxle.NewKey(address, "beta").Save()
+	goaxle.NewKeyRing(address, "partners").Save()
+	goaxle.ApiLinkKey(address, "weather", "alpha")
+	goaxle.ApiLinkKey(address, "weather", "beta")
+	goaxle.KeyRingLinkKey(address, "partners", "alpha")
+
+	now := time.Now().Truncate(time.Minute)
+	for _, hit := range []server.Hit{
+		{Time: now, Api: "weather", Key: "alpha", HitType: goaxle.HIT_TYPE_UNCACHED, Status: 200},
+		{Time: now, Api: "weather", Key: "alpha", HitType: goaxle.HIT_TYPE_UNCACHED, Status: 200},
+		{Time: now, Api: "weather", Key: "beta", HitType: goaxle.HIT_TYPE_ERROR, Status: 502},
+	} {
+		storage.RecordHit(hit)
+	}
+
+	stats, err := goaxle.ApiStats(address, "weather", now, now, "", goaxle.GRANULARITY_MINUTES)
+	if err != nil {
+		t.Fatalf("Unable to get stats: %v", err)
+	}
+	if stats[goaxle.HIT_TYPE_UNCACHED][now][200] != 2 || stats[goaxle.HIT_TYPE_ERROR][now][502] != 1 {
+		t.Fatalf("Unexpected api stats: %v", stats)
+	}
+	stats, err = goaxle.ApiStats(address, "weather", now, now, "beta", goaxle.GRANULARITY_MINUTES)
+	if err != nil || len(stats[goaxle.HIT_TYPE_UNCACHED]) != 0 || stats[goaxle.HIT_TYPE_ERROR][now][502] != 1 {
+		t.Fatalf("Unexpected stats for beta: %v %v", stats, err)
+	}
+	stats, err = goaxle.KeyRingStats(address, "partners", now, now, "", "", goaxle.GRANULARITY_MINUTES)
+	if err != nil || stats[goaxle.HIT_TYPE_UNCACHED][now][200] != 2 || len(stats[goaxle.HIT_TYPE_ERROR]) != 0 {
+		t.Fatalf("Unexpected keyring stats: %v %v", stats, err)
+	}
+
+	charts, err := goaxle.ApiKeyCharts(address, "weather", goaxle.GRANULARITY_DAYS)
+	if err != nil || charts["alpha"] != 2 || charts["beta"] != 1 {
+		t.Fatalf("Unexpected key charts: %v %v", charts, err)
+	}
+	charts, err = goaxle.ApisCharts(address, goaxle.GRANULARITY_DAYS)
+	if err != nil || charts["weather"] != 3 {
+		t.Fatalf("Unexpected api charts: %v %v", charts, err)
+	}
+}
+
+/* ex: set noexpandtab: */
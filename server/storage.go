@@ -0,0 +1,229 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	goaxle "github.com/rjohnsondev/go-axle"
+)
+
+var (
+	// ErrNotFound is returned, possibly wrapped, when a resource doesn't
+	// exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrExists is returned, possibly wrapped, when creating a resource
+	// which already exists.
+	ErrExists = errors.New("already exists")
+)
+
+// Storage holds the apis, keys and keyrings served by a Server, the links
+// between them and their hit counters.  Implementations must be safe for
+// concurrent use.
+type Storage interface {
+	// Get returns the identified resource, or an ErrNotFound error.
+	Get(kind goaxle.Kind, identifier string) (goaxle.Resource, error)
+
+	// Create stores a new resource, or returns an ErrExists error.
+	Create(resource goaxle.Resource) error
+
+	// Update replaces an existing resource, or returns an ErrNotFound
+	// error.
+	Update(resource goaxle.Resource) error
+
+	// Delete removes a resource along with all of its links, or returns an
+	// ErrNotFound error.
+	Delete(kind goaxle.Kind, identifier string) error
+
+	// List returns the identifiers of every resource of a kind, sorted.
+	List(kind goaxle.Kind) ([]string, error)
+
+	// Link associates a key with an api or keyring, depending on kind.
+	// Both must exist.  Linking twice has no further effect.
+	Link(kind goaxle.Kind, owner string, key string) error
+
+	// Unlink removes the association made by Link.  Unlinking something
+	// which isn't linked has no effect.
+	Unlink(kind goaxle.Kind, owner string, key string) error
+
+	// Linked returns the sorted identifiers of the keys linked with an api
+	// or keyring, or for KIND_KEY, the apis the key is linked with.
+	Linked(kind goaxle.Kind, identifier string) ([]string, error)
+
+	// RecordHit counts a hit at every granularity, dropping counters which
+	// are older than RETENTION by the time of the hit.
+	RecordHit(hit Hit) error
+
+	// Counts returns the hits matching query.
+	Counts(query CountQuery) (Counts, error)
+}
+
+// Hit is a single call made through the proxy.
+type Hit struct {
+	Time    time.Time
+	Api     string
+	Key     string
+	HitType goaxle.HitType
+	Status  int
+}
+
+// CountQuery selects hit counters.
+type CountQuery struct {
+	Granularity goaxle.Granularity
+
+	// Buckets starting from From up to and including To are counted.
+	From time.Time
+	To   time.Time
+
+	// Only count hits against this api, if set.
+	Api string
+
+	// Only count hits by this key, if set.
+	Key string
+}
+
+// Counts are hit counts keyed by hit type, the unix time of the start of the
+// bucket and response status.
+type Counts map[goaxle.HitType]map[int64]map[int]int
+
+// Add adds count to a bucket.
+func (this Counts) Add(hitType goaxle.HitType, bucket int64, status int, count int) {
+	if _, exists := this[hitType]; !exists {
+		this[hitType] = make(map[int64]map[int]int)
+	}
+	if _, exists := this[hitType][bucket]; !exists {
+		this[hitType][bucket] = make(map[int]int)
+	}
+	this[hitType][bucket][status] += count
+}
+
+// GRANULARITIES lists every granularity hits are counted at.
+var GRANULARITIES = []goaxle.Granularity{
+	goaxle.GRANULARITY_SECONDS,
+	goaxle.GRANULARITY_MINUTES,
+	goaxle.GRANULARITY_HOURS,
+	goaxle.GRANULARITY_DAYS,
+}
+
+// HIT_TYPES lists every type of hit.
+var HIT_TYPES = []goaxle.HitType{
+	goaxle.HIT_TYPE_CACHED,
+	goaxle.HIT_TYPE_UNCACHED,
+	goaxle.HIT_TYPE_ERROR,
+}
+
+var granularitySeconds = map[goaxle.Granularity]int64{
+	goaxle.GRANULARITY_SECONDS: 1,
+	goaxle.GRANULARITY_MINUTES: 60,
+	goaxle.GRANULARITY_HOURS:   60 * 60,
+	goaxle.GRANULARITY_DAYS:    24 * 60 * 60,
+}
+
+// RETENTION is how long the hit counters of each granularity are kept, as
+// ApiAxle does by default.  A granularity without an entry is kept forever.
+var RETENTION = map[goaxle.Granularity]time.Duration{
+	goaxle.GRANULARITY_SECONDS: time.Hour,
+	goaxle.GRANULARITY_MINUTES: 24 * time.Hour,
+	goaxle.GRANULARITY_HOURS:   7 * 24 * time.Hour,
+	goaxle.GRANULARITY_DAYS:    365 * 24 * time.Hour,
+}
+
+// Step returns the length of a bucket at granularity in seconds.
+func Step(granularity goaxle.Granularity) (seconds int64, err error) {
+	seconds, exists := granularitySeconds[granularity]
+	if !exists {
+		return 0, fmt.Errorf("Unknown granularity: %s", granularity)
+	}
+	return seconds, nil
+}
+
+// Bucket returns the unix time of the start of the bucket holding t.
+func Bucket(granularity goaxle.Granularity, t time.Time) (bucket int64, err error) {
+	step, err := Step(granularity)
+	if err != nil {
+		return 0, err
+	}
+	seconds := t.Unix()
+	bucket = seconds - seconds%step
+	if seconds < 0 && seconds%step != 0 {
+		bucket -= step
+	}
+	return bucket, nil
+}
+
+// Oldest returns the first bucket at granularity still kept at now, or
+// false if the granularity is kept forever.
+func Oldest(granularity goaxle.Granularity, now time.Time) (bucket int64, limited bool) {
+	retention, exists := RETENTION[granularity]
+	if !exists {
+		return 0, false
+	}
+	bucket, err := Bucket(granularity, now.Add(-retention))
+	if err != nil {
+		return 0, false
+	}
+	return bucket, true
+}
+
+// NewResource returns an empty resource of kind, for decoding into.
+func NewResource(kind goaxle.Kind, identifier string) (resource goaxle.Resource, err error) {
+	switch kind {
+	case goaxle.KIND_API:
+		return &goaxle.Api{Identifier: identifier}, nil
+	case goaxle.KIND_KEY:
+		return &goaxle.Key{Identifier: identifier}, nil
+	case goaxle.KIND_KEYRING:
+		return &goaxle.KeyRing{Identifier: identifier}, nil
+	}
+	return nil, UnknownKind(kind)
+}
+
+// Encode serialises a resource for storage.  The identifier is not
+// included.
+func Encode(resource goaxle.Resource) (data []byte, err error) {
+	data, err = json.Marshal(resource)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to encode %s %s: %s", resource.Kind(), resource.ID(), err)
+	}
+	return data, nil
+}
+
+// Decode reverses Encode.
+func Decode(kind goaxle.Kind, identifier string, data []byte) (resource goaxle.Resource, err error) {
+	resource, err = NewResource(kind, identifier)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, resource)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decode %s %s: %s", kind, identifier, err)
+	}
+	return resource, nil
+}
+
+// NotFound returns an ErrNotFound error describing a missing resource.
+func NotFound(kind goaxle.Kind, identifier string) error {
+	return fmt.Errorf("%s %s %w", kind, identifier, ErrNotFound)
+}
+
+// Exists returns an ErrExists error describing a duplicate resource.
+func Exists(kind goaxle.Kind, identifier string) error {
+	return fmt.Errorf("%s %s %w", kind, identifier, ErrExists)
+}
+
+// UnknownKind returns an error for a kind which isn't a resource.
+func UnknownKind(kind goaxle.Kind) error {
+	return fmt.Errorf("Unknown resource kind: %s", kind)
+}
+
+// CheckLinkKind returns an error unless kind can own links.
+func CheckLinkKind(kind goaxle.Kind) error {
+	if kind != goaxle.KIND_API && kind != goaxle.KIND_KEYRING {
+		return fmt.Errorf("Unable to link keys with a %s", kind)
+	}
+	return nil
+}
+
+/* ex: set noexpandtab: */
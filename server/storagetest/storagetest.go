@@ -0,0 +1,277 @@
+// Package storagetest checks implementations of server.Storage behave the
+// same way.
+package storagetest
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	goaxle "github.com/rjohnsondev/go-axle"
+	"github.com/rjohnsondev/go-axle/server"
+)
+
+// Run checks the Storage returned by open, which must be empty and is
+// called once per subtest.
+func Run(t *testing.T, open func(t *testing.T) server.Storage) {
+	t.Run("Resources", func(t *testing.T) { testResources(t, open(t)) })
+	t.Run("Links", func(t *testing.T) { testLinks(t, open(t)) })
+	t.Run("Counts", func(t *testing.T) { testCounts(t, open(t)) })
+	t.Run("Retention", func(t *testing.T) { testRetention(t, open(t)) })
+	t.Run("Concurrent", func(t *testing.T) { testConcurrent(t, open(t)) })
+}
+
+func testResources(t *testing.T, storage server.Storage) {
+	api := goaxle.NewApi("", "weather", "weather.example.com")
+	api.CreatedAt = 1380000000000
+	if err := storage.Create(api); err != nil {
+		t.Fatalf("Unable to create api: %v", err)
+	}
+	if err := storage.Create(api); !errors.Is(err, server.ErrExists) {
+		t.Fatalf("Expected ErrExists creating twice, got %v", err)
+	}
+	if err := storage.Create(goaxle.NewKey("", "alpha")); err != nil {
+		t.Fatalf("Unable to create key: %v", err)
+	}
+	if err := storage.Create(goaxle.NewKey("", "beta")); err != nil {
+		t.Fatalf("Unable to create key: %v", err)
+	}
+
+	resource, err := storage.Get(goaxle.KIND_API, "weather")
+	if err != nil {
+		t.Fatalf("Unable to get api: %v", err)
+	}
+	got := resource.(*goaxle.Api)
+	if got.Identifier != "weather" || got.EndPoint != "weather.example.com" || got.CreatedAt != 1380000000000 || !got.StrictSSL {
+		t.Fatalf("Api didn't round trip: %+v", got)
+	}
+
+	// changing what was returned mustn't change what is stored
+	got.EndPoint = "changed.example.com"
+	resource, _ = storage.Get(goaxle.KIND_API, "weather")
+	if resource.(*goaxle.Api).EndPoint != "weather.example.com" {
+		t.Fatalf("Storage shares objects with callers")
+	}
+
+	if err := storage.Update(got); err != nil {
+		t.Fatalf("Unable to update api: %v", err)
+	}
+	resource, _ = storage.Get(goaxle.KIND_API, "weather")
+	if resource.(*goaxle.Api).EndPoint != "changed.example.com" {
+		t.Fatalf("Update not stored")
+	}
+	if err := storage.Update(goaxle.NewApi("", "missing", "x.example.com")); !errors.Is(err, server.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound updating missing api, got %v", err)
+	}
+
+	keys, err := storage.List(goaxle.KIND_KEY)
+	if err != nil || len(keys) != 2 || keys[0] != "alpha" || keys[1] != "beta" {
+		t.Fatalf("Unexpected keys %v: %v", keys, err)
+	}
+	keyRings, err := storage.List(goaxle.KIND_KEYRING)
+	if err != nil || len(keyRings) != 0 {
+		t.Fatalf("Unexpected keyrings %v: %v", keyRings, err)
+	}
+
+	if err := storage.Delete(goaxle.KIND_KEY, "alpha"); err != nil {
+		t.Fatalf("Unable to delete key: %v", err)
+	}
+	if err := storage.Delete(goaxle.KIND_KEY, "alpha"); !errors.Is(err, server.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound deleting twice, got %v", err)
+	}
+	if _, err := storage.Get(goaxle.KIND_KEY, "alpha"); !errors.Is(err, server.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound after delete, got %v", err)
+	}
+}
+
+func testLinks(t *testing.T, storage server.Storage) {
+	for _, resource := range []goaxle.Resource{
+		goaxle.NewApi("", "weather", "weather.example.com"),
+		goaxle.NewApi("", "maps", "maps.example.com"),
+		goaxle.NewKey("", "alpha"),
+		goaxle.NewKey("", "beta"),
+		goaxle.NewKeyRing("", "partners"),
+	} {
+		if err := storage.Create(resource); err != nil {
+			t.Fatalf("Unable to create %s: %v", resource, err)
+		}
+	}
+
+	for _, link := range []struct {
+		kind  goaxle.Kind
+		owner string
+		key   string
+	}{
+		{goaxle.KIND_API, "weather", "alpha"},
+		{goaxle.KIND_API, "weather", "beta"},
+		{goaxle.KIND_API, "weather", "beta"},
+		{goaxle.KIND_API, "maps", "alpha"},
+		{goaxle.KIND_KEYRING, "partners", "beta"},
+	} {
+		if err := storage.Link(link.kind, link.owner, link.key); err != nil {
+			t.Fatalf("Unable to link %v: %v", link, err)
+		}
+	}
+	if err := storage.Link(goaxle.KIND_API, "weather", "missing"); !errors.Is(err, server.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound linking a missing key, got %v", err)
+	}
+	if err := storage.Link(goaxle.KIND_API, "missing", "alpha"); !errors.Is(err, server.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound linking to a missing api, got %v", err)
+	}
+
+	expectLinked(t, storage, goaxle.KIND_API, "weather", "alpha", "beta")
+	expectLinked(t, storage, goaxle.KIND_KEY, "alpha", "maps", "weather")
+	expectLinked(t, storage, goaxle.KIND_KEYRING, "partners", "beta")
+
+	if err := storage.Unlink(goaxle.KIND_API, "weather", "alpha"); err != nil {
+		t.Fatalf("Unable to unlink: %v", err)
+	}
+	expectLinked(t, storage, goaxle.KIND_API, "weather", "beta")
+	expectLinked(t, storage, goaxle.KIND_KEY, "alpha", "maps")
+
+	// deleting either end removes links
+	if err := storage.Delete(goaxle.KIND_KEY, "beta"); err != nil {
+		t.Fatalf("Unable to delete key: %v", err)
+	}
+	expectLinked(t, storage, goaxle.KIND_API, "weather")
+	expectLinked(t, storage, goaxle.KIND_KEYRING, "partners")
+	if err := storage.Delete(goaxle.KIND_API, "maps"); err != nil {
+		t.Fatalf("Unable to delete api: %v", err)
+	}
+	expectLinked(t, storage, goaxle.KIND_KEY, "alpha")
+
+	// a recreated api starts without links
+	storage.Link(goaxle.KIND_API, "weather", "alpha")
+	storage.Delete(goaxle.KIND_API, "weather")
+	storage.Create(goaxle.NewApi("", "weather", "weather.example.com"))
+	expectLinked(t, storage, goaxle.KIND_API, "weather")
+
+	if _, err := storage.Linked(goaxle.KIND_API, "missing"); !errors.Is(err, server.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound listing links of a missing api, got %v", err)
+	}
+}
+
+func expectLinked(t *testing.T, storage server.Storage, kind goaxle.Kind, identifier string, expected ...string) {
+	t.Helper()
+	linked, err := storage.Linked(kind, identifier)
+	if err != nil {
+		t.Fatalf("Unable to list links of %s %s: %v", kind, identifier, err)
+	}
+	if len(linked) != len(expected) {
+		t.Fatalf("Expected %s %s linked with %v, got %v", kind, identifier, expected, linked)
+	}
+	for x := range expected {
+		if linked[x] != expected[x] {
+			t.Fatalf("Expected %s %s linked with %v, got %v", kind, identifier, expected, linked)
+		}
+	}
+}
+
+func testCounts(t *testing.T, storage server.Storage) {
+	at := time.Unix(1380000000, 0)
+	hits := []server.Hit{
+		{Time: at, Api: "weather", Key: "alpha", HitType: goaxle.HIT_TYPE_UNCACHED, Status: 200},
+		{Time: at.Add(10 * time.Second), Api: "weather", Key: "alpha", HitType: goaxle.HIT_TYPE_UNCACHED, Status: 200},
+		{Time: at.Add(20 * time.Second), Api: "weather", Key: "beta", HitType: goaxle.HIT_TYPE_CACHED, Status: 200},
+		{Time: at.Add(30 * time.Second), Api: "maps", Key: "alpha", HitType: goaxle.HIT_TYPE_ERROR, Status: 500},
+		{Time: at.Add(2 * time.Hour), Api: "weather", Key: "alpha", HitType: goaxle.HIT_TYPE_UNCACHED, Status: 404},
+	}
+	for _, hit := range hits {
+		if err := storage.RecordHit(hit); err != nil {
+			t.Fatalf("Unable to record hit: %v", err)
+		}
+	}
+
+	counts, err := storage.Counts(server.CountQuery{
+		Granularity: goaxle.GRANULARITY_MINUTES,
+		From:        at,
+		To:          at.Add(time.Hour),
+		Api:         "weather",
+	})
+	if err != nil {
+		t.Fatalf("Unable to count: %v", err)
+	}
+	minute, _ := server.Bucket(goaxle.GRANULARITY_MINUTES, at)
+	if counts[goaxle.HIT_TYPE_UNCACHED][minute][200] != 2 || counts[goaxle.HIT_TYPE_CACHED][minute][200] != 1 {
+		t.Fatalf("Unexpected counts: %v", counts)
+	}
+	if len(counts[goaxle.HIT_TYPE_ERROR]) != 0 || len(counts[goaxle.HIT_TYPE_UNCACHED]) != 1 {
+		t.Fatalf("Counted hits outside the query: %v", counts)
+	}
+
+	counts, err = storage.Counts(server.CountQuery{
+		Granularity: goaxle.GRANULARITY_DAYS,
+		From:        at,
+		To:          at,
+		Key:         "alpha",
+	})
+	if err != nil {
+		t.Fatalf("Unable to count: %v", err)
+	}
+	day, _ := server.Bucket(goaxle.GRANULARITY_DAYS, at)
+	if counts[goaxle.HIT_TYPE_UNCACHED][day][200] != 2 || counts[goaxle.HIT_TYPE_UNCACHED][day][404] != 1 ||
+		counts[goaxle.HIT_TYPE_ERROR][day][500] != 1 {
+		t.Fatalf("Unexpected daily counts: %v", counts)
+	}
+
+	if _, err := storage.Counts(server.CountQuery{Granularity: "fortnight", From: at, To: at}); err == nil {
+		t.Fatalf("Expected an error counting an unknown granularity")
+	}
+}
+
+func testRetention(t *testing.T, storage server.Storage) {
+	at := time.Unix(1380000000, 0)
+	later := at.Add(server.RETENTION[goaxle.GRANULARITY_SECONDS] + time.Minute)
+	for _, hitAt := range []time.Time{at, at.Add(time.Second), later} {
+		hit := server.Hit{Time: hitAt, Api: "weather", Key: "alpha", HitType: goaxle.HIT_TYPE_UNCACHED, Status: 200}
+		if err := storage.RecordHit(hit); err != nil {
+			t.Fatalf("Unable to record hit: %v", err)
+		}
+	}
+
+	counts, err := storage.Counts(server.CountQuery{Granularity: goaxle.GRANULARITY_SECONDS, From: at, To: later})
+	if err != nil {
+		t.Fatalf("Unable to count: %v", err)
+	}
+	if len(counts[goaxle.HIT_TYPE_UNCACHED]) != 1 || counts[goaxle.HIT_TYPE_UNCACHED][later.Unix()][200] != 1 {
+		t.Fatalf("Expected only the latest second to be kept, got %v", counts)
+	}
+
+	counts, err = storage.Counts(server.CountQuery{Granularity: goaxle.GRANULARITY_MINUTES, From: at, To: at})
+	if err != nil {
+		t.Fatalf("Unable to count: %v", err)
+	}
+	minute, _ := server.Bucket(goaxle.GRANULARITY_MINUTES, at)
+	if counts[goaxle.HIT_TYPE_UNCACHED][minute][200] != 2 {
+		t.Fatalf("Expected minutes to still be kept, got %v", counts)
+	}
+}
+
+func testConcurrent(t *testing.T, storage server.Storage) {
+	if err := storage.Create(goaxle.NewApi("", "weather", "weather.example.com")); err != nil {
+		t.Fatalf("Unable to create api: %v", err)
+	}
+	at := time.Unix(1380000000, 0)
+	var wg sync.WaitGroup
+	for x := 0; x < 8; x++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for y := 0; y < 25; y++ {
+				storage.RecordHit(server.Hit{Time: at, Api: "weather", Key: "alpha", HitType: goaxle.HIT_TYPE_UNCACHED, Status: 200})
+				storage.Get(goaxle.KIND_API, "weather")
+			}
+		}()
+	}
+	wg.Wait()
+	counts, err := storage.Counts(server.CountQuery{Granularity: goaxle.GRANULARITY_SECONDS, From: at, To: at})
+	if err != nil {
+		t.Fatalf("Unable to count: %v", err)
+	}
+	if counts[goaxle.HIT_TYPE_UNCACHED][at.Unix()][200] != 200 {
+		t.Fatalf("Lost hits: %v", counts)
+	}
+}
+
+/* ex: set noexpandtab: */
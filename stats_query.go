@@ -0,0 +1,190 @@
+package goaxle
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// StatusRange is an inclusive range of HTTP status codes.
+type StatusRange struct {
+	Min int
+	Max int
+}
+
+var (
+	STATUS_2XX = StatusRange{200, 299}
+	STATUS_3XX = StatusRange{300, 399}
+	STATUS_4XX = StatusRange{400, 499}
+	STATUS_5XX = StatusRange{500, 599}
+)
+
+// Contains reports whether status falls within the range.
+func (this StatusRange) Contains(status int) bool {
+	return status >= this.Min && status <= this.Max
+}
+
+// StatsQuery describes a stats request spanning several apis or keys.
+type StatsQuery struct {
+	From        time.Time
+	To          time.Time
+	Granularity Granularity
+
+	// Hit types to include.  Empty includes every hit type.
+	HitTypes []HitType
+
+	// Status codes to include.  Empty includes every status.
+	StatusRanges []StatusRange
+
+	// Apis to fetch stats for.  If Keys is also set, only the hits of those
+	// keys against these apis are counted.
+	Apis []string
+
+	// Keys to fetch stats for.
+	Keys []string
+
+	// Maximum number of requests in flight at once.  Defaults to 4.
+	Concurrency int
+}
+
+// QueryStats fetches the stats described by query and merges them into a
+// single result, summing counts which fall in the same hit type, time and
+// status.  Requests are made concurrently; if any fail, the errors are
+// joined and no stats are returned.
+func QueryStats(axleAddress string, query StatsQuery) (stats map[HitType]map[time.Time]map[int]int, err error) {
+	type request func() (map[HitType]map[time.Time]map[int]int, error)
+	var requests []request
+
+	switch {
+	case len(query.Apis) > 0 && len(query.Keys) > 0:
+		for _, api := range query.Apis {
+			for _, key := range query.Keys {
+				requests = append(requests, func() (map[HitType]map[time.Time]map[int]int, error) {
+					return ApiStats(axleAddress, api, query.From, query.To, key, query.Granularity)
+				})
+			}
+		}
+	case len(query.Apis) > 0:
+		for _, api := range query.Apis {
+			requests = append(requests, func() (map[HitType]map[time.Time]map[int]int, error) {
+				return ApiStats(axleAddress, api, query.From, query.To, "", query.Granularity)
+			})
+		}
+	case len(query.Keys) > 0:
+		for _, key := range query.Keys {
+			requests = append(requests, func() (map[HitType]map[time.Time]map[int]int, error) {
+				return KeyStats(axleAddress, key, query.From, query.To, "", query.Granularity)
+			})
+		}
+	default:
+		return nil, fmt.Errorf("Unable to query stats: no apis or keys given")
+	}
+
+	var mu sync.Mutex
+	stats = make(map[HitType]map[time.Time]map[int]int)
+	errs := fanOut(len(requests), query.Concurrency, func(x int) error {
+		result, err := requests[x]()
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		mergeStats(stats, FilterStats(result, query.HitTypes, query.StatusRanges))
+		return nil
+	})
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return stats, nil
+}
+
+// fanOut calls do for each of count requests, with at most concurrency in
+// flight at once, defaulting to 4.  It returns the errors of the requests
+// which failed, in order.
+func fanOut(count int, concurrency int, do func(x int) error) (errs []error) {
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+	slots := make(chan struct{}, concurrency)
+	results := make([]error, count)
+	var wg sync.WaitGroup
+	for x := 0; x < count; x++ {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[x] = do(x)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range results {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// FilterStats returns the subset of stats matching the given hit types and
+// status ranges.  Empty filters match everything.
+func FilterStats(stats map[HitType]map[time.Time]map[int]int, hitTypes []HitType, statusRanges []StatusRange) (out map[HitType]map[time.Time]map[int]int) {
+	out = make(map[HitType]map[time.Time]map[int]int)
+	for hitType, timeGroups := range stats {
+		if len(hitTypes) > 0 && !containsHitType(hitTypes, hitType) {
+			continue
+		}
+		out[hitType] = make(map[time.Time]map[int]int)
+		for timeGroup, statuses := range timeGroups {
+			for status, count := range statuses {
+				if len(statusRanges) > 0 && !statusInRanges(statusRanges, status) {
+					continue
+				}
+				if _, exists := out[hitType][timeGroup]; !exists {
+					out[hitType][timeGroup] = make(map[int]int)
+				}
+				out[hitType][timeGroup][status] = count
+			}
+		}
+	}
+	return out
+}
+
+// mergeStats adds the counts in from into into.
+func mergeStats(into map[HitType]map[time.Time]map[int]int, from map[HitType]map[time.Time]map[int]int) {
+	for hitType, timeGroups := range from {
+		if _, exists := into[hitType]; !exists {
+			into[hitType] = make(map[time.Time]map[int]int)
+		}
+		for timeGroup, statuses := range timeGroups {
+			if _, exists := into[hitType][timeGroup]; !exists {
+				into[hitType][timeGroup] = make(map[int]int)
+			}
+			for status, count := range statuses {
+				into[hitType][timeGroup][status] += count
+			}
+		}
+	}
+}
+
+func containsHitType(hitTypes []HitType, hitType HitType) bool {
+	for _, candidate := range hitTypes {
+		if candidate == hitType {
+			return true
+		}
+	}
+	return false
+}
+
+func statusInRanges(statusRanges []StatusRange, status int) bool {
+	for _, statusRange := range statusRanges {
+		if statusRange.Contains(status) {
+			return true
+		}
+	}
+	return false
+}
+
+/* ex: set noexpandtab: */
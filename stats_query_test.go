@@ -0,0 +1,78 @@
+package goaxle
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func statsResponse(at time.Time, uncached map[int]int, errored map[int]int) string {
+	format := func(statuses map[int]int) string {
+		out := ""
+		for status, count := range statuses {
+			if out != "" {
+				out += ","
+			}
+			out += fmt.Sprintf(`"%d":%d`, status, count)
+		}
+		return fmt.Sprintf(`{"%d":{%s}}`, at.Unix(), out)
+	}
+	return fmt.Sprintf(
+		`{"meta":{"version":1,"status_code":200},"results":{"cached":{},"uncached":%s,"error":%s}}`,
+		format(uncached),
+		format(errored),
+	)
+}
+
+func TestQueryStats(t *testing.T) {
+	at := time.Unix(1380000000, 0)
+	axle := newTestAxle(t, map[string]string{
+		"GET /v1/api/weather/stats": statsResponse(at, map[int]int{200: 10, 502: 2}, map[int]int{500: 1, 404: 3}),
+		"GET /v1/api/maps/stats":    statsResponse(at, map[int]int{200: 5, 502: 4}, map[int]int{503: 1}),
+	})
+
+	stats, err := QueryStats(axle.address(), StatsQuery{
+		From:         at.Add(-time.Hour),
+		To:           at,
+		Granularity:  GRANULARITY_MINUTES,
+		Apis:         []string{"weather", "maps"},
+		StatusRanges: []StatusRange{STATUS_5XX},
+	})
+	if err != nil {
+		t.Fatalf("Unable to query stats: %v", err)
+	}
+	if stats[HIT_TYPE_UNCACHED][at][502] != 6 || stats[HIT_TYPE_UNCACHED][at][200] != 0 {
+		t.Fatalf("Uncached stats not merged and filtered: %v", stats[HIT_TYPE_UNCACHED])
+	}
+	if stats[HIT_TYPE_ERROR][at][500] != 1 || stats[HIT_TYPE_ERROR][at][503] != 1 || stats[HIT_TYPE_ERROR][at][404] != 0 {
+		t.Fatalf("Error stats not merged and filtered: %v", stats[HIT_TYPE_ERROR])
+	}
+
+	stats, err = QueryStats(axle.address(), StatsQuery{
+		Granularity: GRANULARITY_MINUTES,
+		Apis:        []string{"weather"},
+		Keys:        []string{"alpha", "beta"},
+		HitTypes:    []HitType{HIT_TYPE_ERROR},
+	})
+	if err != nil {
+		t.Fatalf("Unable to query stats: %v", err)
+	}
+	if len(stats) != 1 || stats[HIT_TYPE_ERROR][at][404] != 6 {
+		t.Fatalf("Unexpected per key stats: %v", stats)
+	}
+	forKeys := make(map[string]bool)
+	axle.mu.Lock()
+	for _, req := range axle.requests[2:] {
+		forKeys[req.URL.Query().Get("forkey")] = true
+	}
+	axle.mu.Unlock()
+	if len(forKeys) != 2 || !forKeys["alpha"] || !forKeys["beta"] {
+		t.Fatalf("Keys not passed through: %v", forKeys)
+	}
+
+	if _, err := QueryStats(axle.address(), StatsQuery{Apis: []string{"weather", "missing"}}); err == nil {
+		t.Fatalf("Expected an error for a missing api")
+	}
+}
+
+/* ex: set noexpandtab: */
@@ -0,0 +1,339 @@
+package goaxle
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// listPageSize is the number of entries requested per page when walking a
+// full listing from the server.
+const listPageSize = 100
+
+// Snapshot is a point-in-time copy of the configuration held by an ApiAxle
+// server.  Snapshots are never modified once loaded.
+type Snapshot struct {
+	// All apis keyed by identifier.
+	Apis map[string]*Api
+	// All keys keyed by identifier.
+	Keys map[string]*Key
+	// All keyrings keyed by identifier.
+	KeyRings map[string]*KeyRing
+
+	// ApiKeys maps an api identifier to the identifiers of its linked keys.
+	ApiKeys map[string][]string
+	// KeyApis maps a key identifier to the identifiers of its linked apis.
+	KeyApis map[string][]string
+	// KeyRingKeys maps a keyring identifier to the identifiers of its keys.
+	KeyRingKeys map[string][]string
+
+	// The time this snapshot finished loading.
+	LoadedAt time.Time
+}
+
+// LoadSnapshot reads every api, key and keyring from the server at
+// axleAddress along with the links between them.
+func LoadSnapshot(axleAddress string) (snapshot *Snapshot, err error) {
+	apis, err := listAll(func(from int, to int) ([]*Api, error) {
+		return Apis(axleAddress, from, to)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load apis: %s", err)
+	}
+	keys, err := listAll(func(from int, to int) ([]*Key, error) {
+		return Keys(axleAddress, from, to)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load keys: %s", err)
+	}
+	keyRings, err := listAll(func(from int, to int) ([]*KeyRing, error) {
+		return KeyRings(axleAddress, from, to)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load keyrings: %s", err)
+	}
+
+	snapshot = &Snapshot{
+		Apis:        make(map[string]*Api, len(apis)),
+		Keys:        make(map[string]*Key, len(keys)),
+		KeyRings:    make(map[string]*KeyRing, len(keyRings)),
+		ApiKeys:     make(map[string][]string, len(apis)),
+		KeyApis:     make(map[string][]string, len(keys)),
+		KeyRingKeys: make(map[string][]string, len(keyRings)),
+	}
+	for _, api := range apis {
+		snapshot.Apis[api.Identifier] = api
+	}
+	for _, key := range keys {
+		snapshot.Keys[key.Identifier] = key
+	}
+	for _, keyRing := range keyRings {
+		snapshot.KeyRings[keyRing.Identifier] = keyRing
+	}
+
+	for identifier := range snapshot.Apis {
+		linked, err := listAll(func(from int, to int) ([]*Key, error) {
+			return ApiKeys(axleAddress, identifier, from, to)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Unable to load keys for api %s: %s", identifier, err)
+		}
+		for _, key := range linked {
+			snapshot.ApiKeys[identifier] = append(snapshot.ApiKeys[identifier], key.Identifier)
+			snapshot.KeyApis[key.Identifier] = append(snapshot.KeyApis[key.Identifier], identifier)
+		}
+	}
+	for identifier := range snapshot.KeyRings {
+		linked, err := listAll(func(from int, to int) ([]*Key, error) {
+			return KeyRingKeys(axleAddress, identifier, from, to)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Unable to load keys for keyring %s: %s", identifier, err)
+		}
+		for _, key := range linked {
+			snapshot.KeyRingKeys[identifier] = append(snapshot.KeyRingKeys[identifier], key.Identifier)
+		}
+	}
+
+	snapshot.LoadedAt = time.Now()
+	return snapshot, nil
+}
+
+// listAll pages through a from / to style listing until the server runs out
+// of results.
+func listAll[T any](list func(from int, to int) ([]T, error)) (out []T, err error) {
+	for from := 0; ; from += listPageSize {
+		page, err := list(from, from+listPageSize-1)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, page...)
+		if len(page) < listPageSize {
+			return out, nil
+		}
+	}
+}
+
+// StoreOptions configures a Store.
+type StoreOptions struct {
+	// How often the store reloads from the server once started.
+	// Zero disables background refreshing; use Refresh instead.
+	RefreshInterval time.Duration
+}
+
+// Store is a read-through cache of the configuration held by an ApiAxle
+// server.  Lookups are served from the most recently loaded Snapshot and
+// never wait on the management API.
+type Store struct {
+	axleAddress string
+	options     StoreOptions
+	createdAt   time.Time
+
+	snapshot atomic.Pointer[Snapshot]
+	lastErr  atomic.Pointer[error]
+
+	// serialises refreshes, readers never take it
+	refreshMu sync.Mutex
+
+	stopMu sync.Mutex
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewStore creates a Store for the server at axleAddress.  Nothing is loaded
+// until Start or Refresh is called.
+func NewStore(axleAddress string, options StoreOptions) (out *Store) {
+	out = &Store{
+		axleAddress: axleAddress,
+		options:     options,
+		createdAt:   time.Now(),
+	}
+	return out
+}
+
+// Start loads the initial snapshot and, if a RefreshInterval was given,
+// begins refreshing in the background until Stop is called.  The error from
+// the initial load is returned, but background refreshing continues
+// regardless so the store can recover once the server is reachable.
+func (this *Store) Start() (err error) {
+	err = this.Refresh()
+
+	this.stopMu.Lock()
+	defer this.stopMu.Unlock()
+	if this.options.RefreshInterval <= 0 || this.stop != nil {
+		return err
+	}
+	this.stop = make(chan struct{})
+	this.done = make(chan struct{})
+	go this.refreshLoop(this.stop, this.done)
+
+	return err
+}
+
+// Stop halts background refreshing and waits for any in-flight refresh to
+// finish.  The last loaded snapshot remains available.
+func (this *Store) Stop() {
+	this.stopMu.Lock()
+	defer this.stopMu.Unlock()
+	if this.stop == nil {
+		return
+	}
+	close(this.stop)
+	<-this.done
+	this.stop = nil
+	this.done = nil
+}
+
+func (this *Store) refreshLoop(stop chan struct{}, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(this.options.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			// failures are recorded and exposed through LastError
+			this.Refresh()
+		}
+	}
+}
+
+// Refresh reloads the snapshot from the server immediately.  On failure the
+// previous snapshot is kept and the error is recorded for LastError.
+func (this *Store) Refresh() (err error) {
+	this.refreshMu.Lock()
+	defer this.refreshMu.Unlock()
+
+	snapshot, err := LoadSnapshot(this.axleAddress)
+	if err != nil {
+		err = fmt.Errorf("Unable to refresh store from %s: %s", this.axleAddress, err)
+		this.lastErr.Store(&err)
+		return err
+	}
+	this.snapshot.Store(snapshot)
+	this.lastErr.Store(nil)
+	return nil
+}
+
+// Snapshot returns the most recently loaded snapshot, or nil if nothing has
+// been loaded yet.  The returned snapshot is shared and must not be modified.
+func (this *Store) Snapshot() *Snapshot {
+	return this.snapshot.Load()
+}
+
+// LastError returns the error from the most recent refresh, or nil if it
+// succeeded.
+func (this *Store) LastError() error {
+	if err := this.lastErr.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+// LastRefresh returns the time the current snapshot was loaded.  It is the
+// zero time if nothing has been loaded yet.
+func (this *Store) LastRefresh() time.Time {
+	if snapshot := this.snapshot.Load(); snapshot != nil {
+		return snapshot.LoadedAt
+	}
+	return time.Time{}
+}
+
+// Staleness returns the age of the current snapshot.  If nothing has been
+// loaded yet it is the time since the Store was created.
+func (this *Store) Staleness() time.Duration {
+	if snapshot := this.snapshot.Load(); snapshot != nil {
+		return time.Since(snapshot.LoadedAt)
+	}
+	return time.Since(this.createdAt)
+}
+
+// Api returns a copy of the cached api with the given identifier.
+func (this *Store) Api(identifier string) (api *Api, found bool) {
+	snapshot := this.snapshot.Load()
+	if snapshot == nil {
+		return nil, false
+	}
+	cached, found := snapshot.Apis[identifier]
+	if !found {
+		return nil, false
+	}
+	api = new(Api)
+	*api = *cached
+	return api, true
+}
+
+// Key returns a copy of the cached key with the given identifier.
+func (this *Store) Key(identifier string) (key *Key, found bool) {
+	snapshot := this.snapshot.Load()
+	if snapshot == nil {
+		return nil, false
+	}
+	cached, found := snapshot.Keys[identifier]
+	if !found {
+		return nil, false
+	}
+	key = new(Key)
+	*key = *cached
+	key.ForApis = append([]string(nil), cached.ForApis...)
+	return key, true
+}
+
+// KeyRing returns a copy of the cached keyring with the given identifier.
+func (this *Store) KeyRing(identifier string) (keyRing *KeyRing, found bool) {
+	snapshot := this.snapshot.Load()
+	if snapshot == nil {
+		return nil, false
+	}
+	cached, found := snapshot.KeyRings[identifier]
+	if !found {
+		return nil, false
+	}
+	keyRing = new(KeyRing)
+	*keyRing = *cached
+	return keyRing, true
+}
+
+// ApiKeys returns the identifiers of the keys linked with the api.
+func (this *Store) ApiKeys(apiIdentifier string) []string {
+	return this.links(func(snapshot *Snapshot) []string {
+		return snapshot.ApiKeys[apiIdentifier]
+	})
+}
+
+// KeyApis returns the identifiers of the apis the key is linked with.
+func (this *Store) KeyApis(keyIdentifier string) []string {
+	return this.links(func(snapshot *Snapshot) []string {
+		return snapshot.KeyApis[keyIdentifier]
+	})
+}
+
+// KeyRingKeys returns the identifiers of the keys linked with the keyring.
+func (this *Store) KeyRingKeys(keyRingIdentifier string) []string {
+	return this.links(func(snapshot *Snapshot) []string {
+		return snapshot.KeyRingKeys[keyRingIdentifier]
+	})
+}
+
+// KeyLinked reports whether the key may be used against the api according to
+// the cached configuration.
+func (this *Store) KeyLinked(apiIdentifier string, keyIdentifier string) bool {
+	for _, identifier := range this.ApiKeys(apiIdentifier) {
+		if identifier == keyIdentifier {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *Store) links(lookup func(*Snapshot) []string) []string {
+	snapshot := this.snapshot.Load()
+	if snapshot == nil {
+		return nil
+	}
+	return append([]string(nil), lookup(snapshot)...)
+}
+
+/* ex: set noexpandtab: */
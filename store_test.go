@@ -0,0 +1,119 @@
+package goaxle
+
+import (
+	"testing"
+	"time"
+)
+
+// snapshotResponses describes a small server with one api, two keys (one
+// linked to the api) and a keyring holding the linked key.
+func snapshotResponses() map[string]string {
+	return map[string]string{
+		"GET /v1/apis": `{"meta":{"version":1,"status_code":200},"results":{
+			"weather":{"createdAt":1380000000000,"updatedAt":1380000000000,"endPoint":"weather.example.com","protocol":"http","apiFormat":"json","endPointTimeout":2}}}`,
+		"GET /v1/keys": `{"meta":{"version":1,"status_code":200},"results":{
+			"alpha":{"createdAt":1380000000000,"updatedAt":1380000000000,"qps":2,"qpd":1000},
+			"beta":{"createdAt":1380000000000,"updatedAt":1380000000000,"qps":5,"qpd":5000}}}`,
+		"GET /v1/keyrings": `{"meta":{"version":1,"status_code":200},"results":{
+			"partners":{"createdAt":1380000000000,"updatedAt":1380000000000}}}`,
+		"GET /v1/api/weather/keys": `{"meta":{"version":1,"status_code":200},"results":{
+			"alpha":{"qps":2,"qpd":1000}}}`,
+		"GET /v1/keyring/partners/keys": `{"meta":{"version":1,"status_code":200},"results":{
+			"alpha":{"qps":2,"qpd":1000}}}`,
+	}
+}
+
+func TestStoreRefresh(t *testing.T) {
+	axle := newTestAxle(t, snapshotResponses())
+	store := NewStore(axle.address(), StoreOptions{})
+
+	if _, found := store.Key("alpha"); found {
+		t.Fatalf("Found key before the store was loaded")
+	}
+
+	err := store.Refresh()
+	if err != nil {
+		t.Fatalf("Unable to refresh store: %v", err)
+	}
+
+	api, found := store.Api("weather")
+	if !found || api.EndPoint != "weather.example.com" {
+		t.Fatalf("Api not loaded correctly: %v", api)
+	}
+	key, found := store.Key("beta")
+	if !found || key.Qpd != 5000 {
+		t.Fatalf("Key not loaded correctly: %v", key)
+	}
+	if _, found := store.KeyRing("partners"); !found {
+		t.Fatalf("KeyRing not loaded")
+	}
+	if !store.KeyLinked("weather", "alpha") || store.KeyLinked("weather", "beta") {
+		t.Fatalf("Incorrect links: %v", store.ApiKeys("weather"))
+	}
+	if apis := store.KeyApis("alpha"); len(apis) != 1 || apis[0] != "weather" {
+		t.Fatalf("Incorrect apis for key: %v", apis)
+	}
+	if keys := store.KeyRingKeys("partners"); len(keys) != 1 || keys[0] != "alpha" {
+		t.Fatalf("Incorrect keys for keyring: %v", keys)
+	}
+
+	// modifying a returned copy must not change the cache
+	key.Qpd = 1
+	if cached, _ := store.Key("beta"); cached.Qpd != 5000 {
+		t.Fatalf("Cached key was modified through returned copy")
+	}
+}
+
+func TestStoreKeepsSnapshotOnError(t *testing.T) {
+	axle := newTestAxle(t, snapshotResponses())
+	store := NewStore(axle.address(), StoreOptions{})
+	if err := store.Refresh(); err != nil {
+		t.Fatalf("Unable to refresh store: %v", err)
+	}
+	loadedAt := store.LastRefresh()
+
+	axle.remove("GET /v1/keys")
+	if err := store.Refresh(); err == nil {
+		t.Fatalf("Refresh succeeded with a broken server")
+	}
+	if store.LastError() == nil {
+		t.Fatalf("LastError not recorded")
+	}
+	if _, found := store.Key("alpha"); !found {
+		t.Fatalf("Previous snapshot was discarded")
+	}
+	if !store.LastRefresh().Equal(loadedAt) {
+		t.Fatalf("LastRefresh moved on a failed refresh")
+	}
+	if store.Staleness() <= 0 {
+		t.Fatalf("Staleness not reported")
+	}
+
+	axle.set("GET /v1/keys", snapshotResponses()["GET /v1/keys"])
+	if err := store.Refresh(); err != nil || store.LastError() != nil {
+		t.Fatalf("Store did not recover: %v", err)
+	}
+}
+
+func TestStoreBackgroundRefresh(t *testing.T) {
+	axle := newTestAxle(t, snapshotResponses())
+	store := NewStore(axle.address(), StoreOptions{RefreshInterval: 10 * time.Millisecond})
+	if err := store.Start(); err != nil {
+		t.Fatalf("Unable to start store: %v", err)
+	}
+	defer store.Stop()
+
+	axle.set("GET /v1/keys", `{"meta":{"version":1,"status_code":200},"results":{"gamma":{"qps":1,"qpd":10}}}`)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, found := store.Key("gamma"); found {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Store never picked up the new key")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+/* ex: set noexpandtab: */
@@ -0,0 +1,324 @@
+package goaxle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+)
+
+// SyncAction is what a Syncer did, or would do, to the target server.
+type SyncAction string
+
+const (
+	SYNC_CREATED  SyncAction = "created"
+	SYNC_UPDATED  SyncAction = "updated"
+	SYNC_DELETED  SyncAction = "deleted"
+	SYNC_LINKED   SyncAction = "linked"
+	SYNC_UNLINKED SyncAction = "unlinked"
+	// The target was modified more recently than the source, so it was
+	// left alone.
+	SYNC_CONFLICT SyncAction = "conflict"
+)
+
+// SyncChange is a single difference found by a Syncer.
+type SyncChange struct {
+	Action     SyncAction
+	Kind       Kind
+	Identifier string
+
+	// For link changes, the api or keyring the key was linked with or
+	// unlinked from.  Kind is then that of the api or keyring.
+	Target string
+
+	// The fields that differ, for updates and conflicts.
+	Changes []FieldChange
+
+	// Set if applying the change failed.
+	Err error
+}
+
+// SyncReport describes the outcome of one sync.
+type SyncReport struct {
+	Started  time.Time
+	Finished time.Time
+	DryRun   bool
+	Changes  []SyncChange
+}
+
+// Conflicts returns the changes skipped because the target was newer.
+func (this *SyncReport) Conflicts() (out []SyncChange) {
+	for _, change := range this.Changes {
+		if change.Action == SYNC_CONFLICT {
+			out = append(out, change)
+		}
+	}
+	return out
+}
+
+// Err joins the errors of every change which failed to apply.
+func (this *SyncReport) Err() error {
+	var errs []error
+	for _, change := range this.Changes {
+		if change.Err != nil {
+			errs = append(errs, change.Err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SyncOptions configures a Syncer.
+type SyncOptions struct {
+	// Server to read from.
+	Source string
+
+	// Server to mirror to.
+	Target string
+
+	// Patterns, as understood by path.Match, an identifier must match one
+	// of to be synced.  Empty includes everything.
+	Include []string
+
+	// Patterns excluding identifiers from the sync, even if included.
+	Exclude []string
+
+	// Delete apis, keys and keyrings on the target which aren't on the
+	// source, and remove links the source doesn't have.
+	Prune bool
+
+	// Overwrite the target even where it was updated more recently than
+	// the source.  By default such objects are reported as conflicts.
+	SourceWins bool
+
+	// Report what would change without changing anything.
+	DryRun bool
+}
+
+// Syncer mirrors the apis, keys, keyrings and links of one ApiAxle server
+// onto another.
+type Syncer struct {
+	options SyncOptions
+}
+
+// NewSyncer creates a Syncer.
+func NewSyncer(options SyncOptions) (out *Syncer) {
+	return &Syncer{options: options}
+}
+
+// Run syncs every interval until ctx is done, handing each report, or the
+// error if the servers couldn't be read, to onReport.
+func (this *Syncer) Run(ctx context.Context, interval time.Duration, onReport func(*SyncReport, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		report, err := this.Sync()
+		if onReport != nil {
+			onReport(report, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync brings the target in line with the source once.  An error is
+// returned if either server couldn't be read; failures applying individual
+// changes are recorded in the report, see SyncReport.Err.
+func (this *Syncer) Sync() (report *SyncReport, err error) {
+	report = &SyncReport{Started: time.Now(), DryRun: this.options.DryRun}
+	source, err := LoadSnapshot(this.options.Source)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read sync source: %s", err)
+	}
+	target, err := LoadSnapshot(this.options.Target)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read sync target: %s", err)
+	}
+
+	// objects first, so links have something to point at
+	mirrorAll(this, report, source.Apis, target.Apis)
+	mirrorAll(this, report, source.Keys, target.Keys)
+	mirrorAll(this, report, source.KeyRings, target.KeyRings)
+
+	this.links(report, KIND_API, source.ApiKeys, target.ApiKeys, ApiLinkKey, ApiUnlinkKey)
+	this.links(report, KIND_KEYRING, source.KeyRingKeys, target.KeyRingKeys, KeyRingLinkKey, KeyRingUnlinkKey)
+
+	if this.options.Prune {
+		for _, identifier := range syncIdentifiers(this, target.Keys) {
+			if _, exists := source.Keys[identifier]; !exists {
+				this.apply(report, SyncChange{Action: SYNC_DELETED, Kind: KIND_KEY, Identifier: identifier}, target.Keys[identifier].Delete)
+			}
+		}
+		for _, identifier := range syncIdentifiers(this, target.KeyRings) {
+			if _, exists := source.KeyRings[identifier]; !exists {
+				this.apply(report, SyncChange{Action: SYNC_DELETED, Kind: KIND_KEYRING, Identifier: identifier}, target.KeyRings[identifier].Delete)
+			}
+		}
+		for _, identifier := range syncIdentifiers(this, target.Apis) {
+			if _, exists := source.Apis[identifier]; !exists {
+				this.apply(report, SyncChange{Action: SYNC_DELETED, Kind: KIND_API, Identifier: identifier}, target.Apis[identifier].Delete)
+			}
+		}
+	}
+
+	report.Finished = time.Now()
+	return report, nil
+}
+
+// syncable is implemented by the objects a Syncer copies.
+type syncable interface {
+	Resource
+	ParseUpdatedAt() time.Time
+	moveTo(axleAddress string, create bool)
+}
+
+func (this *Api) moveTo(axleAddress string, create bool) {
+	this.axleAddress = axleAddress
+	this.createOnSave = create
+}
+
+func (this *Key) moveTo(axleAddress string, create bool) {
+	this.axleAddress = axleAddress
+	this.createOnSave = create
+}
+
+func (this *KeyRing) moveTo(axleAddress string, create bool) {
+	this.axleAddress = axleAddress
+	this.createOnSave = create
+}
+
+// mirrorAll mirrors each selected source object onto the target.
+func mirrorAll[T any, P interface {
+	*T
+	syncable
+}](this *Syncer, report *SyncReport, source map[string]P, target map[string]P) {
+	for _, identifier := range syncIdentifiers(this, source) {
+		// work on a copy so the snapshot is left untouched
+		object := *source[identifier]
+		if existing, exists := target[identifier]; exists {
+			this.mirror(report, P(&object), existing)
+		} else {
+			this.mirror(report, P(&object), nil)
+		}
+	}
+}
+
+// mirror copies a source object, which must be a copy owned by the Syncer,
+// over its counterpart on the target, which is nil if there is none.
+func (this *Syncer) mirror(report *SyncReport, object syncable, existing syncable) {
+	if existing == nil {
+		object.moveTo(this.options.Target, true)
+		this.apply(report, SyncChange{Action: SYNC_CREATED, Kind: object.Kind(), Identifier: object.ID()}, object.Save)
+		return
+	}
+
+	changes := contentChanges(existing, object)
+	if len(changes) == 0 {
+		return
+	}
+	change := SyncChange{Action: SYNC_UPDATED, Kind: object.Kind(), Identifier: object.ID(), Changes: changes}
+	if !this.options.SourceWins && existing.ParseUpdatedAt().After(object.ParseUpdatedAt()) {
+		change.Action = SYNC_CONFLICT
+		report.Changes = append(report.Changes, change)
+		return
+	}
+	object.moveTo(this.options.Target, false)
+	this.apply(report, change, object.Save)
+}
+
+// contentChanges lists the differing fields of two objects, ignoring when
+// they were created and updated.
+func contentChanges(old interface{}, new interface{}) (changes []FieldChange) {
+	for _, change := range diffFields(old, new) {
+		if change.Field != "createdAt" && change.Field != "updatedAt" {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// links brings the keys linked with each api or keyring on the target in
+// line with the source.
+func (this *Syncer) links(report *SyncReport, kind Kind, source map[string][]string, target map[string][]string, link func(string, string, string) (*Key, error), unlink func(string, string, string) (*Key, error)) {
+	owners := unionKeys(source, target)
+	for _, owner := range owners {
+		if !this.included(owner) {
+			continue
+		}
+		wanted := make(map[string]bool)
+		for _, key := range source[owner] {
+			wanted[key] = true
+		}
+		existing := make(map[string]bool)
+		for _, key := range target[owner] {
+			existing[key] = true
+		}
+		for _, key := range unionKeys(wanted, existing) {
+			if !this.included(key) {
+				continue
+			}
+			change := SyncChange{Kind: kind, Identifier: key, Target: owner}
+			switch {
+			case wanted[key] && !existing[key]:
+				change.Action = SYNC_LINKED
+				this.apply(report, change, func() error {
+					_, err := link(this.options.Target, owner, key)
+					return err
+				})
+			case !wanted[key] && existing[key] && this.options.Prune:
+				change.Action = SYNC_UNLINKED
+				this.apply(report, change, func() error {
+					_, err := unlink(this.options.Target, owner, key)
+					return err
+				})
+			}
+		}
+	}
+}
+
+// apply records change, making it with do unless this is a dry run.
+func (this *Syncer) apply(report *SyncReport, change SyncChange, do func() error) {
+	if !this.options.DryRun {
+		if err := do(); err != nil {
+			change.Err = fmt.Errorf("Unable to sync %s %s: %s", change.Kind, change.Identifier, err)
+		}
+	}
+	report.Changes = append(report.Changes, change)
+}
+
+// syncIdentifiers returns the sorted identifiers in objects selected by the
+// include and exclude patterns of a Syncer.
+func syncIdentifiers[V any](this *Syncer, objects map[string]V) (out []string) {
+	for identifier := range objects {
+		if this.included(identifier) {
+			out = append(out, identifier)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// included reports whether identifier passes the include and exclude
+// patterns.
+func (this *Syncer) included(identifier string) bool {
+	for _, pattern := range this.options.Exclude {
+		if matched, _ := path.Match(pattern, identifier); matched {
+			return false
+		}
+	}
+	if len(this.options.Include) == 0 {
+		return true
+	}
+	for _, pattern := range this.options.Include {
+		if matched, _ := path.Match(pattern, identifier); matched {
+			return true
+		}
+	}
+	return false
+}
+
+/* ex: set noexpandtab: */
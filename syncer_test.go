@@ -0,0 +1,113 @@
+package goaxle
+
+import (
+	"testing"
+)
+
+func syncTarget(t *testing.T) *testAxle {
+	return newTestAxle(t, map[string]string{
+		"GET /v1/apis": `{"meta":{"version":1,"status_code":200},"results":{
+			"weather":{"createdAt":1370000000000,"updatedAt":1370000000000,"endPoint":"old.example.com","protocol":"http","apiFormat":"json","endPointTimeout":2},
+			"legacy":{"createdAt":1370000000000,"updatedAt":1370000000000,"endPoint":"legacy.example.com"}}}`,
+		"GET /v1/keys": `{"meta":{"version":1,"status_code":200},"results":{
+			"alpha":{"createdAt":1380000000000,"updatedAt":1380000000000,"qps":2,"qpd":1000},
+			"beta":{"createdAt":1380000000000,"updatedAt":1390000000000,"qps":9,"qpd":5000}}}`,
+		"GET /v1/keyrings":         `{"meta":{"version":1,"status_code":200},"results":{}}`,
+		"GET /v1/api/weather/keys": `{"meta":{"version":1,"status_code":200},"results":{}}`,
+		"GET /v1/api/legacy/keys":  `{"meta":{"version":1,"status_code":200},"results":{"beta":{}}}`,
+
+		"PUT /v1/api/weather":                    `{"meta":{"version":1,"status_code":200},"results":{"new":{"endPoint":"weather.example.com"},"old":{}}}`,
+		"POST /v1/keyring/partners":              `{"meta":{"version":1,"status_code":200},"results":{"createdAt":1380000000000}}`,
+		"PUT /v1/api/weather/linkkey/alpha":      `{"meta":{"version":1,"status_code":200},"results":{"qps":2,"qpd":1000}}`,
+		"PUT /v1/keyring/partners/linkkey/alpha": `{"meta":{"version":1,"status_code":200},"results":{"qps":2,"qpd":1000}}`,
+		"PUT /v1/api/legacy/unlinkkey/beta":      `{"meta":{"version":1,"status_code":200},"results":{"qps":9,"qpd":5000}}`,
+		"DELETE /v1/api/legacy":                  `{"meta":{"version":1,"status_code":200},"results":true}`,
+	})
+}
+
+// writes lists the non-GET requests received by axle.
+func writes(axle *testAxle) (out []string) {
+	axle.mu.Lock()
+	defer axle.mu.Unlock()
+	for _, req := range axle.requests {
+		if req.Method != "GET" {
+			out = append(out, req.Method+" "+req.URL.Path)
+		}
+	}
+	return out
+}
+
+func TestSyncer(t *testing.T) {
+	source := newTestAxle(t, snapshotResponses())
+	target := syncTarget(t)
+
+	report, err := NewSyncer(SyncOptions{
+		Source: source.address(),
+		Target: target.address(),
+		Prune:  true,
+	}).Sync()
+	if err != nil {
+		t.Fatalf("Unable to sync: %v", err)
+	}
+	if err := report.Err(); err != nil {
+		t.Fatalf("Changes failed: %v", err)
+	}
+
+	expected := []string{
+		"PUT /v1/api/weather",
+		"POST /v1/keyring/partners",
+		"PUT /v1/api/legacy/unlinkkey/beta",
+		"PUT /v1/api/weather/linkkey/alpha",
+		"PUT /v1/keyring/partners/linkkey/alpha",
+		"DELETE /v1/api/legacy",
+	}
+	got := writes(target)
+	if len(got) != len(expected) {
+		t.Fatalf("Expected writes %v, got %v", expected, got)
+	}
+	for x := range expected {
+		if got[x] != expected[x] {
+			t.Fatalf("Expected writes %v, got %v", expected, got)
+		}
+	}
+	if len(writes(source)) != 0 {
+		t.Fatalf("Source was modified: %v", writes(source))
+	}
+
+	conflicts := report.Conflicts()
+	if len(conflicts) != 1 || conflicts[0].Identifier != "beta" || conflicts[0].Changes[0].Field != "qps" {
+		t.Fatalf("Expected a conflict on beta, got %+v", conflicts)
+	}
+	if report.Changes[0].Action != SYNC_UPDATED || report.Changes[0].Changes[0].Field != "endPoint" {
+		t.Fatalf("Unexpected first change: %+v", report.Changes[0])
+	}
+}
+
+func TestSyncerFilters(t *testing.T) {
+	source := newTestAxle(t, snapshotResponses())
+	target := syncTarget(t)
+
+	report, err := NewSyncer(SyncOptions{
+		Source:  source.address(),
+		Target:  target.address(),
+		Exclude: []string{"leg*", "partners"},
+		Prune:   true,
+		DryRun:  true,
+	}).Sync()
+	if err != nil {
+		t.Fatalf("Unable to sync: %v", err)
+	}
+	if len(writes(target)) != 0 {
+		t.Fatalf("Dry run made changes: %v", writes(target))
+	}
+	for _, change := range report.Changes {
+		if change.Identifier == "legacy" || change.Identifier == "partners" || change.Target == "partners" || change.Target == "legacy" {
+			t.Fatalf("Excluded object synced: %+v", change)
+		}
+	}
+	if len(report.Changes) != 3 {
+		t.Fatalf("Expected weather update, link and beta conflict, got %+v", report.Changes)
+	}
+}
+
+/* ex: set noexpandtab: */
@@ -0,0 +1,17 @@
+package goaxle
+
+import (
+	"time"
+)
+
+// durationToSeconds rounds duration up to whole seconds, so small positive
+// durations don't become 0.
+func durationToSeconds(duration time.Duration) int {
+	seconds := duration / time.Second
+	if duration%time.Second > 0 {
+		seconds++
+	}
+	return int(seconds)
+}
+
+/* ex: set noexpandtab: */
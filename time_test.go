@@ -0,0 +1,34 @@
+package goaxle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseFloatToTime(t *testing.T) {
+	expected := time.Date(2013, 9, 24, 15, 4, 5, 123456000, time.UTC)
+	parsed := parseFloatToTime(1380035045123.456)
+	if !parsed.Equal(expected) {
+		t.Fatalf("Expected %v, got %v", expected, parsed.UTC())
+	}
+	if before := parseFloatToTime(-1.5); !before.Equal(time.Unix(0, -1500000)) {
+		t.Fatalf("Negative timestamps parsed incorrectly: %v", before)
+	}
+}
+
+func TestApiDurations(t *testing.T) {
+	api := NewApi(TEST_API_AXLE_SERVER, TEST_API_NAME, TEST_API_ENDPOINT)
+	if api.Timeout() != 2*time.Second {
+		t.Fatalf("Unexpected default timeout: %v", api.Timeout())
+	}
+	api.SetTimeout(250 * time.Millisecond)
+	if api.EndPointTimeout != 1 {
+		t.Fatalf("Sub-second timeout not rounded up: %d", api.EndPointTimeout)
+	}
+	api.SetCacheDuration(time.Minute)
+	if api.GlobalCache != 60 || api.CacheDuration() != time.Minute {
+		t.Fatalf("Unexpected cache: %d", api.GlobalCache)
+	}
+}
+
+/* ex: set noexpandtab: */
@@ -0,0 +1,302 @@
+package goaxle
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Trial records when a key created by a TrialStore expires.
+type Trial struct {
+	Key       string    `json:"key"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	// When the sweeper disabled the key, zero until it has.
+	DisabledAt time.Time `json:"disabledAt,omitzero"`
+
+	// Whether the key was enabled until the sweeper disabled it.  Extend
+	// only enables keys again if so, leaving keys disabled by someone else
+	// alone.
+	SweeperDisabled bool `json:"sweeperDisabled,omitempty"`
+}
+
+// Expired reports whether the trial has ended by now.
+func (this *Trial) Expired(now time.Time) bool {
+	return !now.Before(this.ExpiresAt)
+}
+
+// Kind of action reported by a TrialSweep.
+type TrialAction string
+
+const (
+	// The expired key was disabled.
+	TrialDisabled TrialAction = "disabled"
+
+	// The key was deleted, or found to be gone already, and is no longer
+	// tracked.
+	TrialDeleted TrialAction = "deleted"
+
+	// The trial store couldn't be written, see TrialSweep.Err.
+	TrialSaveFailed TrialAction = "save_failed"
+)
+
+// TrialSweep reports one action taken on an expired trial.
+type TrialSweep struct {
+	Key    string
+	Action TrialAction
+	Time   time.Time
+
+	// Set if the action failed.  It is retried on the next sweep.
+	Err error
+}
+
+// TrialStore creates keys which expire, tracking them in a local file as
+// ApiAxle keys have no expiry of their own.  It is safe for concurrent use.
+type TrialStore struct {
+	axleAddress string
+	path        string
+
+	// Held by Sweep and Extend, so they never change keys at once.
+	runMu sync.Mutex
+
+	mu     sync.Mutex
+	trials map[string]*Trial
+}
+
+// OpenTrialStore loads the trials saved at path, which need not exist yet.
+func OpenTrialStore(axleAddress string, path string) (store *TrialStore, err error) {
+	store = &TrialStore{
+		axleAddress: axleAddress,
+		path:        path,
+		trials:      make(map[string]*Trial),
+	}
+	var trials []*Trial
+	if err = loadJSONFile(path, "trials", &trials); err != nil {
+		return nil, err
+	}
+	for _, trial := range trials {
+		store.trials[trial.Key] = trial
+	}
+	return store, nil
+}
+
+// CreateTrialKey creates key, which should come from NewKey, and tracks it
+// so that it expires after ttl.
+func (this *TrialStore) CreateTrialKey(key *Key, ttl time.Duration) (trial Trial, err error) {
+	if ttl <= 0 {
+		return trial, fmt.Errorf("Unable to create trial key %s: ttl must be positive", key.Identifier)
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if _, exists := this.trials[key.Identifier]; exists {
+		return trial, fmt.Errorf("Unable to create trial key %s: it is already a trial", key.Identifier)
+	}
+	if err = key.Save(); err != nil {
+		return trial, fmt.Errorf("Unable to create trial key %s: %s", key.Identifier, err)
+	}
+
+	now := time.Now()
+	trial = Trial{Key: key.Identifier, CreatedAt: now, ExpiresAt: now.Add(ttl)}
+	this.trials[key.Identifier] = &trial
+	if err = this.save(); err != nil {
+		delete(this.trials, key.Identifier)
+		return Trial{}, fmt.Errorf("Key %s was created but won't expire: %s", key.Identifier, err)
+	}
+	return trial, nil
+}
+
+// Trials returns the tracked trials, soonest to expire first.
+func (this *TrialStore) Trials() (trials []Trial) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	for _, trial := range this.sorted() {
+		trials = append(trials, *trial)
+	}
+	return trials
+}
+
+// Extend pushes back the expiry of a trial by by.  If the sweeper had
+// disabled the key and the trial no longer has expired, the key is enabled
+// again, unless it was already disabled when the sweeper came to it.
+func (this *TrialStore) Extend(keyIdentifier string, by time.Duration) (trial Trial, err error) {
+	this.runMu.Lock()
+	defer this.runMu.Unlock()
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	existing, exists := this.trials[keyIdentifier]
+	if !exists {
+		return trial, fmt.Errorf("Unable to extend trial of key %s: it isn't a trial", keyIdentifier)
+	}
+	updated := *existing
+	updated.ExpiresAt = updated.ExpiresAt.Add(by)
+
+	if !updated.DisabledAt.IsZero() && !updated.Expired(time.Now()) {
+		key, err := GetKey(this.axleAddress, keyIdentifier)
+		if err != nil {
+			return trial, fmt.Errorf("Unable to extend trial of key %s: %s", keyIdentifier, err)
+		}
+		if updated.SweeperDisabled {
+			key.Disabled = false
+			if err = key.Save(); err != nil {
+				return trial, fmt.Errorf("Unable to enable key %s: %s", keyIdentifier, err)
+			}
+		}
+		updated.DisabledAt, updated.SweeperDisabled = time.Time{}, false
+	}
+
+	this.trials[keyIdentifier] = &updated
+	if err = this.save(); err != nil {
+		this.trials[keyIdentifier] = existing
+		return trial, err
+	}
+	return updated, nil
+}
+
+// Remove stops tracking a trial, leaving the key as it is.
+func (this *TrialStore) Remove(keyIdentifier string) (err error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	trial, exists := this.trials[keyIdentifier]
+	if !exists {
+		return fmt.Errorf("Unable to remove trial of key %s: it isn't a trial", keyIdentifier)
+	}
+	delete(this.trials, keyIdentifier)
+	if err = this.save(); err != nil {
+		this.trials[keyIdentifier] = trial
+		return err
+	}
+	return nil
+}
+
+// Sweep disables the keys of trials expired by now.  If deleteAfter is
+// positive, keys disabled at least that long ago are deleted and no longer
+// tracked.  Trials of keys which no longer exist are dropped.
+func (this *TrialStore) Sweep(now time.Time, deleteAfter time.Duration) (results []TrialSweep, err error) {
+	this.runMu.Lock()
+	defer this.runMu.Unlock()
+
+	// sweep copies of the expired trials, so the lock isn't held during
+	// requests
+	this.mu.Lock()
+	var originals, expired []*Trial
+	for _, trial := range this.sorted() {
+		if !trial.Expired(now) {
+			break
+		}
+		copied := *trial
+		originals = append(originals, trial)
+		expired = append(expired, &copied)
+	}
+	this.mu.Unlock()
+
+	updated := make([]bool, len(expired))
+	dropped := make([]bool, len(expired))
+	for x, trial := range expired {
+		if trial.DisabledAt.IsZero() {
+			result := TrialSweep{Key: trial.Key, Action: TrialDisabled, Time: now}
+			flipped, err := this.disable(trial.Key)
+			switch {
+			case IsNotFound(err):
+				result.Action = TrialDeleted
+				dropped[x] = true
+			case err != nil:
+				result.Err = err
+			default:
+				trial.DisabledAt, trial.SweeperDisabled = now, flipped
+				updated[x] = true
+			}
+			results = append(results, result)
+			continue
+		}
+		if deleteAfter > 0 && !now.Before(trial.DisabledAt.Add(deleteAfter)) {
+			result := TrialSweep{Key: trial.Key, Action: TrialDeleted, Time: now}
+			if err := deleteResource(this.axleAddress, KIND_KEY, trial.Key); err != nil && !IsNotFound(err) {
+				result.Err = fmt.Errorf("Unable to delete expired key %s: %s", trial.Key, err)
+			} else {
+				dropped[x] = true
+			}
+			results = append(results, result)
+		}
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	changed := false
+	for x, trial := range expired {
+		// leave trials removed or replaced while sweeping alone
+		if this.trials[trial.Key] != originals[x] {
+			continue
+		}
+		switch {
+		case dropped[x]:
+			delete(this.trials, trial.Key)
+			changed = true
+		case updated[x]:
+			this.trials[trial.Key] = trial
+			changed = true
+		}
+	}
+
+	if changed {
+		err = this.save()
+	}
+	return results, err
+}
+
+// RunSweeper calls Sweep now and then every interval, sending the results
+// on the returned channel.  If the trials can't be saved a TrialSaveFailed
+// result is sent.  The channel is closed once ctx is done.
+func (this *TrialStore) RunSweeper(ctx context.Context, interval time.Duration, deleteAfter time.Duration) <-chan TrialSweep {
+	return runEvery(ctx, interval, func(now time.Time) []TrialSweep {
+		results, err := this.Sweep(now, deleteAfter)
+		if err != nil {
+			results = append(results, TrialSweep{Action: TrialSaveFailed, Time: now, Err: err})
+		}
+		return results
+	})
+}
+
+// disable sets Disabled on a key, reporting whether it was enabled before.
+func (this *TrialStore) disable(keyIdentifier string) (flipped bool, err error) {
+	key, err := GetKey(this.axleAddress, keyIdentifier)
+	if err != nil {
+		return false, fmt.Errorf("Unable to disable expired key %s: %w", keyIdentifier, err)
+	}
+	if key.Disabled {
+		return false, nil
+	}
+	key.Disabled = true
+	if err = key.Save(); err != nil {
+		return false, fmt.Errorf("Unable to disable expired key %s: %w", keyIdentifier, err)
+	}
+	return true, nil
+}
+
+// sorted returns the trials ordered by expiry, then key.  The lock must be
+// held.
+func (this *TrialStore) sorted() (trials []*Trial) {
+	for _, trial := range this.trials {
+		trials = append(trials, trial)
+	}
+	sort.Slice(trials, func(i, j int) bool {
+		if !trials[i].ExpiresAt.Equal(trials[j].ExpiresAt) {
+			return trials[i].ExpiresAt.Before(trials[j].ExpiresAt)
+		}
+		return trials[i].Key < trials[j].Key
+	})
+	return trials
+}
+
+// save writes the trials to the store's file.  The lock must be held.
+func (this *TrialStore) save() (err error) {
+	trials := this.sorted()
+	if trials == nil {
+		trials = []*Trial{}
+	}
+	return saveJSONFile(this.path, "trials", trials)
+}
+
+/* ex: set noexpandtab: */
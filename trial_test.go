@@ -0,0 +1,205 @@
+package goaxle_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	goaxle "github.com/rjohnsondev/go-axle"
+	"github.com/rjohnsondev/go-axle/server"
+)
+
+func TestTrialStore(t *testing.T) {
+	axle := httptest.NewServer(server.New(server.NewMemoryStorage()))
+	defer axle.Close()
+	address := axle.URL + "/"
+
+	path := filepath.Join(t.TempDir(), "trials.json")
+	store, err := goaxle.OpenTrialStore(address, path)
+	if err != nil {
+		t.Fatalf("Unable to open trial store: %v", err)
+	}
+	alpha, err := store.CreateTrialKey(goaxle.NewKey(address, "alpha"), time.Hour)
+	if err != nil {
+		t.Fatalf("Unable to create trial key: %v", err)
+	}
+	if _, err = store.CreateTrialKey(goaxle.NewKey(address, "beta"), 48*time.Hour); err != nil {
+		t.Fatalf("Unable to create trial key: %v", err)
+	}
+	if _, err = store.CreateTrialKey(goaxle.NewKey(address, "alpha"), time.Hour); err == nil {
+		t.Fatalf("Expected a duplicate trial to be refused")
+	}
+
+	results, err := store.Sweep(alpha.ExpiresAt, 24*time.Hour)
+	if err != nil || len(results) != 1 || results[0].Key != "alpha" || results[0].Action != goaxle.TrialDisabled || results[0].Err != nil {
+		t.Fatalf("Expected alpha to be disabled, got %+v %v", results, err)
+	}
+	if key, _ := goaxle.GetKey(address, "alpha"); !key.Disabled {
+		t.Fatalf("Expected alpha to be disabled")
+	}
+	if key, _ := goaxle.GetKey(address, "beta"); key.Disabled {
+		t.Fatalf("Expected beta to be enabled")
+	}
+
+	// trials survive a restart
+	store, err = goaxle.OpenTrialStore(address, path)
+	if err != nil {
+		t.Fatalf("Unable to reopen trial store: %v", err)
+	}
+	trials := store.Trials()
+	if len(trials) != 2 || trials[0].Key != "alpha" || trials[0].DisabledAt.IsZero() || trials[1].Key != "beta" {
+		t.Fatalf("Unexpected trials after reopening: %+v", trials)
+	}
+
+	if results, _ := store.Sweep(alpha.ExpiresAt.Add(time.Hour), 24*time.Hour); len(results) != 0 {
+		t.Fatalf("Expected nothing to do before the grace period ends, got %+v", results)
+	}
+	results, err = store.Sweep(alpha.ExpiresAt.Add(24*time.Hour), 24*time.Hour)
+	if err != nil || len(results) != 1 || results[0].Action != goaxle.TrialDeleted || results[0].Err != nil {
+		t.Fatalf("Expected alpha to be deleted, got %+v %v", results, err)
+	}
+	if _, err = goaxle.GetKey(address, "alpha"); err == nil {
+		t.Fatalf("Expected alpha to be gone")
+	}
+	if trials := store.Trials(); len(trials) != 1 {
+		t.Fatalf("Expected alpha to no longer be tracked, got %+v", trials)
+	}
+}
+
+func TestTrialStoreUnlockedDuringSweep(t *testing.T) {
+	handler := server.New(server.NewMemoryStorage())
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var hold atomic.Bool
+	axle := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hold.Load() && r.Method == "GET" {
+			entered <- struct{}{}
+			<-release
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer axle.Close()
+	address := axle.URL + "/"
+
+	store, err := goaxle.OpenTrialStore(address, filepath.Join(t.TempDir(), "trials.json"))
+	if err != nil {
+		t.Fatalf("Unable to open trial store: %v", err)
+	}
+	alpha, err := store.CreateTrialKey(goaxle.NewKey(address, "alpha"), time.Hour)
+	if err != nil {
+		t.Fatalf("Unable to create trial key: %v", err)
+	}
+
+	hold.Store(true)
+	done := make(chan []goaxle.TrialSweep)
+	go func() {
+		results, _ := store.Sweep(alpha.ExpiresAt, 0)
+		done <- results
+	}()
+	<-entered
+
+	// the store can be used while Sweep waits on the server
+	if trials := store.Trials(); len(trials) != 1 {
+		t.Fatalf("Unable to list trials during a sweep: %+v", trials)
+	}
+	hold.Store(false)
+	if _, err := store.CreateTrialKey(goaxle.NewKey(address, "beta"), time.Hour); err != nil {
+		t.Fatalf("Unable to create a trial during a sweep: %v", err)
+	}
+	close(release)
+	if results := <-done; len(results) != 1 || results[0].Action != goaxle.TrialDisabled || results[0].Err != nil {
+		t.Fatalf("Expected alpha to be disabled, got %+v", results)
+	}
+	trials := store.Trials()
+	if len(trials) != 2 || trials[0].Key != "alpha" || trials[0].DisabledAt.IsZero() {
+		t.Fatalf("Expected the sweep to be recorded beside the new trial, got %+v", trials)
+	}
+}
+
+func TestTrialStoreExtend(t *testing.T) {
+	axle := httptest.NewServer(server.New(server.NewMemoryStorage()))
+	defer axle.Close()
+	address := axle.URL + "/"
+
+	store, err := goaxle.OpenTrialStore(address, filepath.Join(t.TempDir(), "trials.json"))
+	if err != nil {
+		t.Fatalf("Unable to open trial store: %v", err)
+	}
+	// already expired by the time it's swept
+	if _, err = store.CreateTrialKey(goaxle.NewKey(address, "alpha"), time.Millisecond); err != nil {
+		t.Fatalf("Unable to create trial key: %v", err)
+	}
+	if results, err := store.Sweep(time.Now().Add(time.Second), 0); err != nil || len(results) != 1 {
+		t.Fatalf("Expected alpha to be disabled, got %+v %v", results, err)
+	}
+
+	if trials := store.Trials(); !trials[0].SweeperDisabled {
+		t.Fatalf("Expected the sweeper to have disabled alpha, got %+v", trials)
+	}
+	trial, err := store.Extend("alpha", 7*24*time.Hour)
+	if err != nil || !trial.DisabledAt.IsZero() || trial.SweeperDisabled {
+		t.Fatalf("Unable to extend trial: %+v %v", trial, err)
+	}
+	if key, _ := goaxle.GetKey(address, "alpha"); key.Disabled {
+		t.Fatalf("Expected extending the trial to enable alpha")
+	}
+	if results, _ := store.Sweep(time.Now().Add(time.Hour), 0); len(results) != 0 {
+		t.Fatalf("Expected the extended trial to be left alone, got %+v", results)
+	}
+
+	if _, err = store.Extend("missing", time.Hour); err == nil {
+		t.Fatalf("Expected extending an unknown trial to fail")
+	}
+	if err = store.Remove("alpha"); err != nil || len(store.Trials()) != 0 {
+		t.Fatalf("Unable to remove trial: %v", err)
+	}
+}
+
+func TestTrialStoreLeavesOthersAlone(t *testing.T) {
+	axle := httptest.NewServer(server.New(server.NewMemoryStorage()))
+	defer axle.Close()
+	address := axle.URL + "/"
+
+	store, err := goaxle.OpenTrialStore(address, filepath.Join(t.TempDir(), "trials.json"))
+	if err != nil {
+		t.Fatalf("Unable to open trial store: %v", err)
+	}
+	banned := goaxle.NewKey(address, "banned")
+	banned.Disabled = true
+	for _, key := range []*goaxle.Key{banned, goaxle.NewKey(address, "gone")} {
+		if _, err = store.CreateTrialKey(key, time.Millisecond); err != nil {
+			t.Fatalf("Unable to create trial key: %v", err)
+		}
+	}
+	gone, _ := goaxle.GetKey(address, "gone")
+	if err = gone.Delete(); err != nil {
+		t.Fatalf("Unable to delete key: %v", err)
+	}
+
+	results, err := store.Sweep(time.Now().Add(time.Second), 0)
+	if err != nil || len(results) != 2 {
+		t.Fatalf("Expected both trials to be swept, got %+v %v", results, err)
+	}
+	for _, result := range results {
+		expected := map[string]goaxle.TrialAction{"banned": goaxle.TrialDisabled, "gone": goaxle.TrialDeleted}[result.Key]
+		if result.Action != expected || result.Err != nil {
+			t.Fatalf("Unexpected sweep of %s: %+v", result.Key, result)
+		}
+	}
+	if trials := store.Trials(); len(trials) != 1 || trials[0].Key != "banned" {
+		t.Fatalf("Expected the trial of the missing key to be dropped, got %+v", trials)
+	}
+
+	// the key was disabled by someone else, so stays disabled
+	if _, err = store.Extend("banned", 7*24*time.Hour); err != nil {
+		t.Fatalf("Unable to extend trial: %v", err)
+	}
+	if key, _ := goaxle.GetKey(address, "banned"); !key.Disabled {
+		t.Fatalf("Expected extending the trial to leave banned disabled")
+	}
+}
+
+/* ex: set noexpandtab: */
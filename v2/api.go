@@ -0,0 +1,252 @@
+package goaxle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// API is an api proxied by ApiAxle.
+type API struct {
+	// Identifier of the api.  It can't be changed once created.
+	ID string
+
+	// Maintained by the server.
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	// Host, and optionally port, calls are proxied to, e.g.
+	// "graph.facebook.com".
+	EndPoint string
+	Protocol Protocol
+	Format   Format
+
+	// How long to wait for the endpoint before timing out.  Rounded up to
+	// whole seconds.
+	Timeout time.Duration
+	// Redirects followed when calling the endpoint.
+	MaxRedirects int
+
+	// How long every call should be cached.  Rounded up to whole seconds.
+	Cache time.Duration
+
+	// Regular expression whose first group extracts the key from the url.
+	ExtractKeyRegex string
+	// Path always prefixed to calls.
+	DefaultPath string
+
+	// Reject calls to this api.
+	Disabled bool
+	// Require valid certificates from the endpoint.
+	StrictSSL bool
+
+	client *Client
+	exists bool
+}
+
+// APIOptions configures a new API.  Zero fields take ApiAxle's defaults.
+type APIOptions struct {
+	EndPoint string
+	// Defaults to ProtocolHTTP.
+	Protocol Protocol
+	// Defaults to FormatJSON.
+	Format Format
+	// Defaults to 2 seconds.
+	Timeout time.Duration
+	// Defaults to 2, negative for none.
+	MaxRedirects int
+	Cache        time.Duration
+
+	ExtractKeyRegex string
+	DefaultPath     string
+	Disabled        bool
+	// Accept invalid certificates from the endpoint.
+	InsecureSSL bool
+}
+
+// NewAPI prepares a new api.  Nothing is sent to the server until Save.
+func (c *Client) NewAPI(id string, options APIOptions) *API {
+	api := &API{
+		ID:              id,
+		EndPoint:        options.EndPoint,
+		Protocol:        options.Protocol,
+		Format:          options.Format,
+		Timeout:         options.Timeout,
+		MaxRedirects:    options.MaxRedirects,
+		Cache:           options.Cache,
+		ExtractKeyRegex: options.ExtractKeyRegex,
+		DefaultPath:     options.DefaultPath,
+		Disabled:        options.Disabled,
+		StrictSSL:       !options.InsecureSSL,
+		client:          c,
+	}
+	if api.Protocol == "" {
+		api.Protocol = ProtocolHTTP
+	}
+	if api.Format == "" {
+		api.Format = FormatJSON
+	}
+	if api.Timeout == 0 {
+		api.Timeout = 2 * time.Second
+	}
+	switch {
+	case api.MaxRedirects == 0:
+		api.MaxRedirects = 2
+	case api.MaxRedirects < 0:
+		api.MaxRedirects = 0
+	}
+	return api
+}
+
+// API fetches an existing api.
+func (c *Client) API(ctx context.Context, id string) (*API, error) {
+	api := &API{ID: id, client: c}
+	if err := api.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return api, nil
+}
+
+type apiWire struct {
+	CreatedAt            float64  `json:"createdAt,omitempty"`
+	UpdatedAt            float64  `json:"updatedAt,omitempty"`
+	GlobalCache          int      `json:"globalCache"`
+	Protocol             Protocol `json:"protocol"`
+	APIFormat            Format   `json:"apiFormat"`
+	EndPoint             string   `json:"endPoint,omitempty"`
+	EndPointTimeout      int      `json:"endPointTimeout"`
+	EndPointMaxRedirects int      `json:"endPointMaxRedirects"`
+	ExtractKeyRegex      string   `json:"extractKeyRegex,omitempty"`
+	DefaultPath          string   `json:"defaultPath,omitempty"`
+	Disabled             bool     `json:"disabled"`
+	StrictSSL            bool     `json:"strictSSL"`
+}
+
+func (a *API) wire() apiWire {
+	return apiWire{
+		CreatedAt:            toMillis(a.CreatedAt),
+		UpdatedAt:            toMillis(a.UpdatedAt),
+		GlobalCache:          toSeconds(a.Cache),
+		Protocol:             a.Protocol,
+		APIFormat:            a.Format,
+		EndPoint:             a.EndPoint,
+		EndPointTimeout:      toSeconds(a.Timeout),
+		EndPointMaxRedirects: a.MaxRedirects,
+		ExtractKeyRegex:      a.ExtractKeyRegex,
+		DefaultPath:          a.DefaultPath,
+		Disabled:             a.Disabled,
+		StrictSSL:            a.StrictSSL,
+	}
+}
+
+// MarshalJSON encodes the api in ApiAxle's wire format.
+func (a *API) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.wire())
+}
+
+// UnmarshalJSON decodes the api from ApiAxle's wire format.  Fields missing
+// from data are left unchanged.
+func (a *API) UnmarshalJSON(data []byte) error {
+	wire := a.wire()
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	a.CreatedAt = fromMillis(wire.CreatedAt)
+	a.UpdatedAt = fromMillis(wire.UpdatedAt)
+	a.Cache = fromSeconds(wire.GlobalCache)
+	a.Protocol = wire.Protocol
+	a.Format = wire.APIFormat
+	a.EndPoint = wire.EndPoint
+	a.Timeout = fromSeconds(wire.EndPointTimeout)
+	a.MaxRedirects = wire.EndPointMaxRedirects
+	a.ExtractKeyRegex = wire.ExtractKeyRegex
+	a.DefaultPath = wire.DefaultPath
+	a.Disabled = wire.Disabled
+	a.StrictSSL = wire.StrictSSL
+	return nil
+}
+
+// Save creates the api, or updates it if it was fetched from the server or
+// saved before.
+func (a *API) Save(ctx context.Context) error {
+	a.UpdatedAt = time.Now()
+	address := a.client.endpoint(nil, "api", a.ID)
+	var raw json.RawMessage
+	if !a.exists {
+		created, _, err := call[json.RawMessage](ctx, a.client, http.MethodPost, address, a)
+		if err != nil {
+			return err
+		}
+		raw = created
+	} else {
+		updated, _, err := call[struct {
+			New json.RawMessage `json:"new"`
+		}](ctx, a.client, http.MethodPut, address, a)
+		if err != nil {
+			return err
+		}
+		raw = updated.New
+	}
+	if err := json.Unmarshal(raw, a); err != nil {
+		return fmt.Errorf("goaxle: decode api %q: %w", a.ID, err)
+	}
+	a.exists = true
+	return nil
+}
+
+// Delete removes the api from the server.
+func (a *API) Delete(ctx context.Context) error {
+	if err := a.client.deleteResource(ctx, "api", a.ID); err != nil {
+		return err
+	}
+	a.exists = false
+	return nil
+}
+
+// Refresh reloads the api from the server.
+func (a *API) Refresh(ctx context.Context) error {
+	raw, _, err := call[json.RawMessage](ctx, a.client, http.MethodGet, a.client.endpoint(nil, "api", a.ID), nil)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, a); err != nil {
+		return fmt.Errorf("goaxle: decode api %q: %w", a.ID, err)
+	}
+	a.exists = true
+	return nil
+}
+
+// Stats returns hit counts for the api.
+func (a *API) Stats(ctx context.Context, options StatsOptions) (Stats, error) {
+	stats, _, err := call[Stats](ctx, a.client, http.MethodGet, a.client.endpoint(options.query(), "api", a.ID, "stats"), nil)
+	return stats, err
+}
+
+// Keys lists the keys linked with the api.
+func (a *API) Keys(ctx context.Context, options ListOptions) ([]*Key, error) {
+	return a.client.listKeys(ctx, a.client.endpoint(options.query(), "api", a.ID, "keys"))
+}
+
+// LinkKey allows the key to be used with the api.
+func (a *API) LinkKey(ctx context.Context, keyID string) (*Key, error) {
+	return a.client.linkKey(ctx, "api", a.ID, "linkkey", keyID)
+}
+
+// UnlinkKey stops the key being used with the api.
+func (a *API) UnlinkKey(ctx context.Context, keyID string) (*Key, error) {
+	return a.client.linkKey(ctx, "api", a.ID, "unlinkkey", keyID)
+}
+
+// KeyCharts returns the top 100 keys of the api by hits over the
+// granularity period.
+func (a *API) KeyCharts(ctx context.Context, granularity Granularity) (Charts, error) {
+	charts, _, err := call[Charts](ctx, a.client, http.MethodGet, a.client.endpoint(granularity.query(), "api", a.ID, "keycharts"), nil)
+	return charts, err
+}
+
+// String describes the api.
+func (a *API) String() string {
+	return fmt.Sprintf("API %q -> %s://%s", a.ID, a.Protocol, a.EndPoint)
+}
@@ -0,0 +1,134 @@
+package goaxle
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// resource is the method set shared by API, Key and KeyRing.
+type resource interface {
+	Save(ctx context.Context) error
+	Delete(ctx context.Context) error
+	Refresh(ctx context.Context) error
+	Stats(ctx context.Context, options StatsOptions) (Stats, error)
+	String() string
+}
+
+var (
+	_ resource = (*API)(nil)
+	_ resource = (*Key)(nil)
+	_ resource = (*KeyRing)(nil)
+)
+
+func TestAPILifecycle(t *testing.T) {
+	fake, client := newFakeAxle(t)
+	ctx := context.Background()
+
+	api := client.NewAPI("weather", APIOptions{EndPoint: "api.example.com", Timeout: 1500 * time.Millisecond})
+	if api.Protocol != ProtocolHTTP || api.Format != FormatJSON || api.MaxRedirects != 2 || !api.StrictSSL {
+		t.Fatalf("defaults not applied: %+v", api)
+	}
+	if err := api.Save(ctx); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if api.CreatedAt.IsZero() {
+		t.Fatal("created time not read back")
+	}
+	if timeout := fake.resources["api"]["weather"]["endPointTimeout"]; timeout != 2.0 {
+		t.Fatalf("timeout not sent in whole seconds: %v", timeout)
+	}
+
+	fetched, err := client.API(ctx, "weather")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if fetched.Timeout != 2*time.Second || fetched.EndPoint != "api.example.com" {
+		t.Fatalf("unexpected api: %+v", fetched)
+	}
+	fetched.Cache = time.Minute
+	if err := fetched.Save(ctx); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := api.Refresh(ctx); err != nil || api.Cache != time.Minute {
+		t.Fatalf("refresh: %v %v", api.Cache, err)
+	}
+
+	apis, err := client.APIs(ctx, ListOptions{})
+	if err != nil || len(apis) != 1 || apis[0].ID != "weather" {
+		t.Fatalf("list: %v %v", apis, err)
+	}
+	if q := fake.requests[len(fake.requests)-1].URL.Query(); q.Get("from") != "0" || q.Get("to") != "99" {
+		t.Fatalf("unexpected paging: %v", q)
+	}
+
+	stats, err := api.Stats(ctx, StatsOptions{From: time.Unix(0, 0), To: time.Now(), Granularity: GranularityDay, ForKey: "alpha"})
+	if err != nil || stats[HitUncached][time.Unix(1380000000, 0)][200] != 3 {
+		t.Fatalf("stats: %v %v", stats, err)
+	}
+
+	if err := api.Delete(ctx); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := api.Delete(ctx); !IsNotFound(err) {
+		t.Fatalf("double delete: %v", err)
+	}
+}
+
+func TestAPILinks(t *testing.T) {
+	_, client := newFakeAxle(t)
+	ctx := context.Background()
+
+	api := client.NewAPI("weather", APIOptions{EndPoint: "api.example.com"})
+	key := client.NewKey("alpha", KeyOptions{})
+	if err := api.Save(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := key.Save(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	linked, err := api.LinkKey(ctx, "alpha")
+	if err != nil || linked.ID != "alpha" || linked.QPS != 2 {
+		t.Fatalf("link: %v %v", linked, err)
+	}
+	keys, err := api.Keys(ctx, ListOptions{})
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("keys: %v %v", keys, err)
+	}
+	apis, err := key.LinkedAPIs(ctx)
+	if err != nil || len(apis) != 1 || apis[0].ID != "weather" {
+		t.Fatalf("key apis: %v %v", apis, err)
+	}
+	if _, err := api.UnlinkKey(ctx, "alpha"); err != nil {
+		t.Fatalf("unlink: %v", err)
+	}
+	if keys, _ := api.Keys(ctx, ListOptions{}); len(keys) != 0 {
+		t.Fatalf("key still linked: %v", keys)
+	}
+}
+
+func TestAPIJSON(t *testing.T) {
+	api := &API{ID: "weather", Timeout: 3 * time.Second, Cache: 10 * time.Second, Protocol: ProtocolHTTPS}
+	marshalled, err := json.Marshal(api)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wire map[string]any
+	json.Unmarshal(marshalled, &wire)
+	if wire["endPointTimeout"] != 3.0 || wire["globalCache"] != 10.0 || wire["protocol"] != "https" {
+		t.Fatalf("unexpected wire format: %s", marshalled)
+	}
+	if _, exists := wire["createdAt"]; exists {
+		t.Fatalf("zero createdAt sent: %s", marshalled)
+	}
+
+	// fields missing from the response are kept
+	if err := json.Unmarshal([]byte(`{"disabled":true}`), api); err != nil {
+		t.Fatal(err)
+	}
+	if !api.Disabled || api.Timeout != 3*time.Second {
+		t.Fatalf("unexpected api after partial decode: %+v", api)
+	}
+}
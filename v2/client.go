@@ -0,0 +1,398 @@
+// Package goaxle provides bindings to the ApiAxle management API.
+//
+// This is the second major version of the package.  Every call is made
+// through a Client and takes a context, timestamps and durations use the
+// time package, and apis, keys and keyrings share the same method set.
+//
+//	client, err := goaxle.NewClient("http://localhost:28902/", goaxle.Options{})
+//	if err != nil {
+//		return err
+//	}
+//	api := client.NewAPI("weather", goaxle.APIOptions{EndPoint: "api.example.com"})
+//	err = api.Save(ctx)
+package goaxle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Version of the management API this package speaks.
+const APIVersion = "v1"
+
+// Authenticator adds credentials to requests made to the management API.
+// The authenticators from the first version of this package satisfy it.
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// Limiter throttles requests made to the management API.  Wait blocks until
+// a request may start, returning a function to call once it completes.  The
+// *Limiter from the first version of this package satisfies it.
+type Limiter interface {
+	Wait(ctx context.Context) (release func(), err error)
+}
+
+// Options configures a Client.
+type Options struct {
+	// HTTPClient performs the requests.  Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+
+	// Auth, if set, adds credentials to every request.
+	Auth Authenticator
+
+	// Limiter, if set, throttles every request.
+	Limiter Limiter
+
+	// Logger, if set, records every request at debug level and every
+	// failure at warn level.
+	Logger *slog.Logger
+}
+
+// Client talks to a single ApiAxle server.  It is safe for concurrent use.
+type Client struct {
+	base    *url.URL
+	options Options
+}
+
+// NewClient creates a Client for the ApiAxle server at address, e.g.
+// "http://localhost:28902/".
+func NewClient(address string, options Options) (*Client, error) {
+	base, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("goaxle: invalid address %q: %w", address, err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("goaxle: invalid address %q: scheme must be http or https", address)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	if options.HTTPClient == nil {
+		options.HTTPClient = http.DefaultClient
+	}
+	return &Client{base: base, options: options}, nil
+}
+
+// Address returns the server address the Client was created with, always
+// ending in a slash.
+func (c *Client) Address() string {
+	return c.base.String()
+}
+
+// Error is returned when the server responds with anything other than
+// success.
+type Error struct {
+	// HTTP status code of the response.
+	StatusCode int
+	// Error type and message reported by ApiAxle, if any.
+	Type    string
+	Message string
+
+	Method string
+	Path   string
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("goaxle: %s %s: %d %s: %s", e.Method, e.Path, e.StatusCode, e.Type, e.Message)
+	}
+	return fmt.Sprintf("goaxle: %s %s: %d %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// IsNotFound reports whether err is a 404 from the server.
+func IsNotFound(err error) bool {
+	var axleErr *Error
+	return errors.As(err, &axleErr) && axleErr.StatusCode == http.StatusNotFound
+}
+
+// Meta is the meta section of every ApiAxle response.
+type Meta struct {
+	Version    int `json:"version"`
+	StatusCode int `json:"status_code"`
+}
+
+// envelope is the wrapper around every ApiAxle JSON response.
+type envelope[T any] struct {
+	Meta    Meta `json:"meta"`
+	Results T    `json:"results"`
+}
+
+type errorResults struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// endpoint builds the address for a path below the version prefix.  Each
+// segment is escaped.
+func (c *Client) endpoint(query url.Values, segments ...string) string {
+	escaped := make([]string, len(segments))
+	for i, segment := range segments {
+		escaped[i] = url.PathEscape(segment)
+	}
+	address := c.base.String() + APIVersion + "/" + strings.Join(escaped, "/")
+	if len(query) > 0 {
+		address += "?" + query.Encode()
+	}
+	return address
+}
+
+// do performs a request and returns the raw response body.
+func (c *Client) do(ctx context.Context, method string, address string, body any) (raw []byte, err error) {
+	start := time.Now()
+	status := 0
+	defer func() {
+		c.log(ctx, method, address, status, time.Since(start), err)
+	}()
+
+	var reader io.Reader
+	if body != nil {
+		marshalled, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("goaxle: marshal request: %w", err)
+		}
+		reader = bytes.NewReader(marshalled)
+	}
+
+	if c.options.Limiter != nil {
+		release, err := c.options.Limiter.Wait(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("goaxle: %s %s: %w", method, address, err)
+		}
+		defer release()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, address, reader)
+	if err != nil {
+		return nil, fmt.Errorf("goaxle: %s %s: %w", method, address, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.options.Auth != nil {
+		if err := c.options.Auth.Authenticate(req); err != nil {
+			return nil, fmt.Errorf("goaxle: authenticate: %w", err)
+		}
+	}
+
+	resp, err := c.options.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("goaxle: %s %s: %w", method, address, err)
+	}
+	defer resp.Body.Close()
+	status = resp.StatusCode
+
+	raw, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("goaxle: read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		axleErr := &Error{StatusCode: resp.StatusCode, Method: method, Path: req.URL.Path}
+		var failed envelope[errorResults]
+		if json.Unmarshal(raw, &failed) == nil {
+			axleErr.Type = failed.Results.Error.Type
+			axleErr.Message = failed.Results.Error.Message
+		}
+		return nil, axleErr
+	}
+	return raw, nil
+}
+
+// call performs a request and decodes the results of the response into out.
+func call[T any](ctx context.Context, c *Client, method string, address string, body any) (out T, meta Meta, err error) {
+	raw, err := c.do(ctx, method, address, body)
+	if err != nil {
+		return out, meta, err
+	}
+	var decoded envelope[T]
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return out, meta, fmt.Errorf("goaxle: decode %s response: %w", method, err)
+	}
+	return decoded.Results, decoded.Meta, nil
+}
+
+func (c *Client) log(ctx context.Context, method string, address string, status int, duration time.Duration, err error) {
+	if c.options.Logger == nil {
+		return
+	}
+	path := address
+	if parsed, parseErr := url.Parse(address); parseErr == nil {
+		path = parsed.Path
+	}
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.String("path", redact(path)),
+		slog.Int("status", status),
+		slog.Duration("duration", duration),
+	}
+	if err != nil {
+		c.options.Logger.LogAttrs(ctx, slog.LevelWarn, "ApiAxle request failed", append(attrs, slog.String("error", redact(err.Error())))...)
+		return
+	}
+	c.options.Logger.LogAttrs(ctx, slog.LevelDebug, "ApiAxle request", attrs...)
+}
+
+var redactions = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// key identifiers in paths, e.g. /key/<id>, /linkkey/<id>
+	{regexp.MustCompile(`(/(?:key|linkkey|unlinkkey)/)[^/?&"\s]+`), "${1}[REDACTED]"},
+	// key identifiers in query strings
+	{regexp.MustCompile(`((?:\?|&)forkey=)[^&"\s]+`), "${1}[REDACTED]"},
+	// shared secrets in bodies
+	{regexp.MustCompile(`("sharedSecret"\s*:\s*")(?:[^"\\]|\\.)*"`), `${1}[REDACTED]"`},
+}
+
+// redact removes key identifiers and shared secrets from s so it is safe to
+// log.
+func redact(s string) string {
+	for _, redaction := range redactions {
+		s = redaction.pattern.ReplaceAllString(s, redaction.replacement)
+	}
+	return s
+}
+
+// Ping checks the server is up.
+func (c *Client) Ping(ctx context.Context) error {
+	raw, err := c.do(ctx, http.MethodGet, c.endpoint(nil, "ping"), nil)
+	if err != nil {
+		return err
+	}
+	if string(raw) != "pong" {
+		return fmt.Errorf("goaxle: ping: server responded %q rather than pong", raw)
+	}
+	return nil
+}
+
+// Info returns the server's version information.
+func (c *Client) Info(ctx context.Context) (map[string]any, error) {
+	info, _, err := call[map[string]any](ctx, c, http.MethodGet, c.endpoint(nil, "info"), nil)
+	return info, err
+}
+
+// ListOptions selects a page of a listing.
+type ListOptions struct {
+	// Index of the first entry.
+	Offset int
+	// Maximum number of entries.  Defaults to 100.
+	Limit int
+}
+
+func (o ListOptions) query() url.Values {
+	limit := o.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	return url.Values{
+		"resolve": {"true"},
+		"from":    {fmt.Sprint(o.Offset)},
+		"to":      {fmt.Sprint(o.Offset + limit - 1)},
+	}
+}
+
+// APIs lists the apis on the server.
+func (c *Client) APIs(ctx context.Context, options ListOptions) ([]*API, error) {
+	return c.listAPIs(ctx, c.endpoint(options.query(), "apis"))
+}
+
+// Keys lists the keys on the server.
+func (c *Client) Keys(ctx context.Context, options ListOptions) ([]*Key, error) {
+	return c.listKeys(ctx, c.endpoint(options.query(), "keys"))
+}
+
+// KeyRings lists the keyrings on the server.
+func (c *Client) KeyRings(ctx context.Context, options ListOptions) ([]*KeyRing, error) {
+	results, _, err := call[map[string]*KeyRing](ctx, c, http.MethodGet, c.endpoint(options.query(), "keyrings"), nil)
+	if err != nil {
+		return nil, err
+	}
+	return collect(results, func(id string, keyRing *KeyRing) *KeyRing {
+		if keyRing == nil {
+			keyRing = new(KeyRing)
+		}
+		keyRing.ID, keyRing.client, keyRing.exists = id, c, true
+		return keyRing
+	}), nil
+}
+
+func (c *Client) listAPIs(ctx context.Context, address string) ([]*API, error) {
+	results, _, err := call[map[string]*API](ctx, c, http.MethodGet, address, nil)
+	if err != nil {
+		return nil, err
+	}
+	return collect(results, func(id string, api *API) *API {
+		if api == nil {
+			api = new(API)
+		}
+		api.ID, api.client, api.exists = id, c, true
+		return api
+	}), nil
+}
+
+func (c *Client) listKeys(ctx context.Context, address string) ([]*Key, error) {
+	results, _, err := call[map[string]*Key](ctx, c, http.MethodGet, address, nil)
+	if err != nil {
+		return nil, err
+	}
+	return collect(results, func(id string, key *Key) *Key {
+		if key == nil {
+			key = new(Key)
+		}
+		key.ID, key.client, key.exists = id, c, true
+		return key
+	}), nil
+}
+
+// collect turns a listing keyed by identifier into a slice ordered by
+// identifier.
+func collect[T any](results map[string]T, bind func(id string, value T) T) []T {
+	ids := make([]string, 0, len(results))
+	for id := range results {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	out := make([]T, len(ids))
+	for i, id := range ids {
+		out[i] = bind(id, results[id])
+	}
+	return out
+}
+
+// Charts maps identifiers to hit counts for the busiest apis or keys.
+type Charts map[string]int
+
+// APICharts returns the top 100 apis by hits over the granularity period.
+func (c *Client) APICharts(ctx context.Context, granularity Granularity) (Charts, error) {
+	charts, _, err := call[Charts](ctx, c, http.MethodGet, c.endpoint(granularity.query(), "apis", "charts"), nil)
+	return charts, err
+}
+
+// KeyCharts returns the top 100 keys by hits over the granularity period.
+func (c *Client) KeyCharts(ctx context.Context, granularity Granularity) (Charts, error) {
+	charts, _, err := call[Charts](ctx, c, http.MethodGet, c.endpoint(granularity.query(), "keys", "charts"), nil)
+	return charts, err
+}
+
+// deleteResource removes a resource, checking the server confirmed it.
+func (c *Client) deleteResource(ctx context.Context, kind string, id string) error {
+	deleted, _, err := call[bool](ctx, c, http.MethodDelete, c.endpoint(nil, kind, id), nil)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("goaxle: delete %s %q: server did not confirm", kind, id)
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package goaxle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAxle is a minimal in-memory stand-in for the ApiAxle management api.
+type fakeAxle struct {
+	mu        sync.Mutex
+	resources map[string]map[string]map[string]any // kind -> id -> fields
+	links     map[string]map[string]bool           // "kind/id" -> key ids
+	requests  []*http.Request
+}
+
+func newFakeAxle(t *testing.T) (*fakeAxle, *Client) {
+	t.Helper()
+	fake := &fakeAxle{
+		resources: map[string]map[string]map[string]any{"api": {}, "key": {}, "keyring": {}},
+		links:     map[string]map[string]bool{},
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	client, err := NewClient(server.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, client
+}
+
+func (f *fakeAxle) reply(w http.ResponseWriter, status int, results any) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"meta":    map[string]any{"version": 1, "status_code": status},
+		"results": results,
+	})
+}
+
+func (f *fakeAxle) fail(w http.ResponseWriter, status int, message string) {
+	f.reply(w, status, map[string]any{"error": map[string]any{"type": "TestError", "message": message}})
+}
+
+func (f *fakeAxle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r)
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/"), "/")
+	switch {
+	case parts[0] == "ping":
+		fmt.Fprint(w, "pong")
+	case parts[0] == "info":
+		f.reply(w, 200, map[string]any{"apiaxle": "1.12", "goaxle": "fake"})
+	case len(parts) == 1 && strings.HasSuffix(parts[0], "s"):
+		kind := strings.TrimSuffix(parts[0], "s")
+		f.reply(w, 200, f.resources[kind])
+	case len(parts) == 2 && parts[1] == "charts", len(parts) == 3 && strings.HasSuffix(parts[2], "charts"):
+		f.reply(w, 200, map[string]int{"weather": 12})
+	case len(parts) == 2:
+		f.serveResource(w, r, parts[0], parts[1])
+	case len(parts) == 3 && parts[2] == "stats":
+		f.reply(w, 200, map[string]any{"uncached": map[string]any{"1380000000": map[string]int{"200": 3}}})
+	case len(parts) == 3 && parts[2] == "keys":
+		keys := map[string]any{}
+		for id := range f.links[parts[0]+"/"+parts[1]] {
+			keys[id] = f.resources["key"][id]
+		}
+		f.reply(w, 200, keys)
+	case len(parts) == 3 && parts[2] == "apis":
+		apis := map[string]any{}
+		for id, fields := range f.resources["api"] {
+			if f.links["api/"+id][parts[1]] {
+				apis[id] = fields
+			}
+		}
+		f.reply(w, 200, apis)
+	case len(parts) == 4 && (parts[2] == "linkkey" || parts[2] == "unlinkkey"):
+		key, exists := f.resources["key"][parts[3]]
+		if !exists {
+			f.fail(w, 404, "no such key")
+			return
+		}
+		target := parts[0] + "/" + parts[1]
+		if f.links[target] == nil {
+			f.links[target] = map[string]bool{}
+		}
+		if parts[2] == "linkkey" {
+			f.links[target][parts[3]] = true
+		} else {
+			delete(f.links[target], parts[3])
+		}
+		f.reply(w, 200, key)
+	default:
+		f.fail(w, 404, "unknown path "+r.URL.Path)
+	}
+}
+
+func (f *fakeAxle) serveResource(w http.ResponseWriter, r *http.Request, kind string, id string) {
+	existing, exists := f.resources[kind][id]
+	switch r.Method {
+	case http.MethodGet:
+		if !exists {
+			f.fail(w, 404, kind+" not found")
+			return
+		}
+		f.reply(w, 200, existing)
+	case http.MethodDelete:
+		if !exists {
+			f.fail(w, 404, kind+" not found")
+			return
+		}
+		delete(f.resources[kind], id)
+		f.reply(w, 200, true)
+	case http.MethodPost, http.MethodPut:
+		if exists == (r.Method == http.MethodPost) {
+			f.fail(w, 400, kind+" already exists or is missing")
+			return
+		}
+		fields := map[string]any{}
+		if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+			f.fail(w, 400, err.Error())
+			return
+		}
+		if r.Method == http.MethodPost {
+			fields["createdAt"] = 1380000000000.0
+		} else {
+			fields["createdAt"] = existing["createdAt"]
+		}
+		f.resources[kind][id] = fields
+		if r.Method == http.MethodPut {
+			f.reply(w, 200, map[string]any{"new": fields, "old": existing})
+			return
+		}
+		f.reply(w, 200, fields)
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	client, err := NewClient("http://localhost:28902", Options{})
+	if err != nil || client.Address() != "http://localhost:28902/" {
+		t.Fatalf("unexpected client %v: %v", client, err)
+	}
+	if _, err := NewClient("localhost:28902", Options{}); err == nil {
+		t.Fatal("accepted an address without a scheme")
+	}
+}
+
+func TestClientPingInfo(t *testing.T) {
+	_, client := newFakeAxle(t)
+	ctx := context.Background()
+	if err := client.Ping(ctx); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	info, err := client.Info(ctx)
+	if err != nil || len(info) != 2 {
+		t.Fatalf("info: %v %v", info, err)
+	}
+}
+
+type headerAuth string
+
+func (h headerAuth) Authenticate(req *http.Request) error {
+	req.Header.Set("Authorization", string(h))
+	return nil
+}
+
+type countingLimiter struct{ waits, releases int }
+
+func (l *countingLimiter) Wait(ctx context.Context) (func(), error) {
+	l.waits++
+	return func() { l.releases++ }, ctx.Err()
+}
+
+func TestClientOptions(t *testing.T) {
+	fake, client := newFakeAxle(t)
+	limiter := new(countingLimiter)
+	logs := new(strings.Builder)
+	client, _ = NewClient(client.Address(), Options{
+		Auth:    headerAuth("Bearer abc"),
+		Limiter: limiter,
+		Logger:  slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	})
+
+	if err := client.Ping(context.Background()); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	if got := fake.requests[0].Header.Get("Authorization"); got != "Bearer abc" {
+		t.Errorf("auth header not set: %q", got)
+	}
+	if limiter.waits != 1 || limiter.releases != 1 {
+		t.Errorf("limiter not used: %+v", limiter)
+	}
+	if !strings.Contains(logs.String(), "path=/v1/ping") {
+		t.Errorf("request not logged: %s", logs)
+	}
+
+	if _, err := client.Key(context.Background(), "secret-key"); err == nil {
+		t.Fatalf("expected an error for a missing key")
+	}
+	if strings.Contains(logs.String(), "secret-key") || !strings.Contains(logs.String(), "/v1/key/[REDACTED]") {
+		t.Errorf("key identifier not redacted: %s", logs)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := client.Ping(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancellation, got %v", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	_, client := newFakeAxle(t)
+	_, err := client.API(context.Background(), "missing")
+	if !IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	var axleErr *Error
+	if !errors.As(err, &axleErr) || axleErr.Type != "TestError" || axleErr.Message != "api not found" {
+		t.Fatalf("error details not decoded: %#v", err)
+	}
+}
+
+func TestCharts(t *testing.T) {
+	_, client := newFakeAxle(t)
+	charts, err := client.APICharts(context.Background(), GranularityMinute)
+	if err != nil || charts["weather"] != 12 {
+		t.Fatalf("unexpected charts %v: %v", charts, err)
+	}
+}
+
+func TestMillis(t *testing.T) {
+	when := time.Date(2013, 9, 24, 15, 4, 5, 123456000, time.UTC)
+	if got := fromMillis(toMillis(when)); !got.Equal(when) {
+		t.Fatalf("round trip lost precision: %v", got)
+	}
+	if !fromMillis(0).IsZero() || toMillis(time.Time{}) != 0 {
+		t.Fatal("zero time not preserved")
+	}
+}
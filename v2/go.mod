@@ -0,0 +1,3 @@
+module github.com/rjohnsondev/go-axle/v2
+
+go 1.26.0
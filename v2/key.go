@@ -0,0 +1,208 @@
+package goaxle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Unlimited disables a key's QPS or QPD limit.
+const Unlimited = -1
+
+// Key grants access to the apis it is linked with.
+type Key struct {
+	// Identifier of the key.  It can't be changed once created.
+	ID string
+
+	// Maintained by the server.
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	// Secret used to sign calls made with the key.
+	SharedSecret string
+
+	// Calls allowed per second and per day, or Unlimited.
+	QPS int
+	QPD int
+
+	// Identifiers of the apis the key is linked with, as reported by the
+	// server.  Use LinkKey on the api to change them.
+	APIs []string
+
+	// Reject calls made with this key.
+	Disabled bool
+
+	client *Client
+	exists bool
+}
+
+// KeyOptions configures a new Key.  Zero fields take ApiAxle's defaults.
+type KeyOptions struct {
+	// Defaults to 2.
+	QPS int
+	// Defaults to 172800.
+	QPD int
+
+	SharedSecret string
+	Disabled     bool
+}
+
+// NewKey prepares a new key.  Nothing is sent to the server until Save.
+func (c *Client) NewKey(id string, options KeyOptions) *Key {
+	key := &Key{
+		ID:           id,
+		QPS:          options.QPS,
+		QPD:          options.QPD,
+		SharedSecret: options.SharedSecret,
+		Disabled:     options.Disabled,
+		client:       c,
+	}
+	if key.QPS == 0 {
+		key.QPS = 2
+	}
+	if key.QPD == 0 {
+		key.QPD = 172800
+	}
+	return key
+}
+
+// Key fetches an existing key.
+func (c *Client) Key(ctx context.Context, id string) (*Key, error) {
+	key := &Key{ID: id, client: c}
+	if err := key.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+type keyWire struct {
+	CreatedAt    float64  `json:"createdAt,omitempty"`
+	UpdatedAt    float64  `json:"updatedAt,omitempty"`
+	SharedSecret string   `json:"sharedSecret,omitempty"`
+	QPD          int      `json:"qpd"`
+	QPS          int      `json:"qps"`
+	ForAPIs      []string `json:"forApis,omitempty"`
+	Disabled     bool     `json:"disabled"`
+}
+
+func (k *Key) wire() keyWire {
+	return keyWire{
+		CreatedAt:    toMillis(k.CreatedAt),
+		UpdatedAt:    toMillis(k.UpdatedAt),
+		SharedSecret: k.SharedSecret,
+		QPD:          k.QPD,
+		QPS:          k.QPS,
+		ForAPIs:      k.APIs,
+		Disabled:     k.Disabled,
+	}
+}
+
+// MarshalJSON encodes the key in ApiAxle's wire format.
+func (k *Key) MarshalJSON() ([]byte, error) {
+	return json.Marshal(k.wire())
+}
+
+// UnmarshalJSON decodes the key from ApiAxle's wire format.  Fields missing
+// from data are left unchanged.
+func (k *Key) UnmarshalJSON(data []byte) error {
+	wire := k.wire()
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	k.CreatedAt = fromMillis(wire.CreatedAt)
+	k.UpdatedAt = fromMillis(wire.UpdatedAt)
+	k.SharedSecret = wire.SharedSecret
+	k.QPD = wire.QPD
+	k.QPS = wire.QPS
+	k.APIs = wire.ForAPIs
+	k.Disabled = wire.Disabled
+	return nil
+}
+
+// Save creates the key, or updates it if it was fetched from the server or
+// saved before.
+func (k *Key) Save(ctx context.Context) error {
+	k.UpdatedAt = time.Now()
+	address := k.client.endpoint(nil, "key", k.ID)
+	var raw json.RawMessage
+	if !k.exists {
+		created, _, err := call[json.RawMessage](ctx, k.client, http.MethodPost, address, k)
+		if err != nil {
+			return err
+		}
+		raw = created
+	} else {
+		updated, _, err := call[struct {
+			New json.RawMessage `json:"new"`
+		}](ctx, k.client, http.MethodPut, address, k)
+		if err != nil {
+			return err
+		}
+		raw = updated.New
+	}
+	if err := json.Unmarshal(raw, k); err != nil {
+		return fmt.Errorf("goaxle: decode key %q: %w", k.ID, err)
+	}
+	k.exists = true
+	return nil
+}
+
+// Delete removes the key from the server.
+func (k *Key) Delete(ctx context.Context) error {
+	if err := k.client.deleteResource(ctx, "key", k.ID); err != nil {
+		return err
+	}
+	k.exists = false
+	return nil
+}
+
+// Refresh reloads the key from the server.
+func (k *Key) Refresh(ctx context.Context) error {
+	raw, _, err := call[json.RawMessage](ctx, k.client, http.MethodGet, k.client.endpoint(nil, "key", k.ID), nil)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, k); err != nil {
+		return fmt.Errorf("goaxle: decode key %q: %w", k.ID, err)
+	}
+	k.exists = true
+	return nil
+}
+
+// Stats returns hit counts for the key.
+func (k *Key) Stats(ctx context.Context, options StatsOptions) (Stats, error) {
+	stats, _, err := call[Stats](ctx, k.client, http.MethodGet, k.client.endpoint(options.query(), "key", k.ID, "stats"), nil)
+	return stats, err
+}
+
+// LinkedAPIs lists the apis the key is linked with.
+func (k *Key) LinkedAPIs(ctx context.Context) ([]*API, error) {
+	return k.client.listAPIs(ctx, k.client.endpoint(ListOptions{}.query(), "key", k.ID, "apis"))
+}
+
+// APICharts returns the key's top 100 apis by hits over the granularity
+// period.
+func (k *Key) APICharts(ctx context.Context, granularity Granularity) (Charts, error) {
+	charts, _, err := call[Charts](ctx, k.client, http.MethodGet, k.client.endpoint(granularity.query(), "key", k.ID, "apicharts"), nil)
+	return charts, err
+}
+
+// String describes the key without revealing its shared secret.
+func (k *Key) String() string {
+	return fmt.Sprintf("Key %q (qps %d, qpd %d)", k.ID, k.QPS, k.QPD)
+}
+
+// linkKey links or unlinks a key with an api or keyring.
+func (c *Client) linkKey(ctx context.Context, kind string, id string, action string, keyID string) (*Key, error) {
+	key := &Key{ID: keyID, client: c, exists: true}
+	raw, _, err := call[json.RawMessage](ctx, c, http.MethodPut, c.endpoint(nil, kind, id, action, keyID), struct{}{})
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, key); err != nil {
+		return nil, fmt.Errorf("goaxle: decode key %q: %w", keyID, err)
+	}
+	return key, nil
+}
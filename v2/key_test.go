@@ -0,0 +1,53 @@
+package goaxle
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyLifecycle(t *testing.T) {
+	_, client := newFakeAxle(t)
+	ctx := context.Background()
+
+	key := client.NewKey("alpha", KeyOptions{QPD: Unlimited, SharedSecret: "hunter2"})
+	if key.QPS != 2 || key.QPD != Unlimited {
+		t.Fatalf("defaults not applied: %+v", key)
+	}
+	if err := key.Save(ctx); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if strings.Contains(key.String(), "hunter2") {
+		t.Fatalf("String leaked the shared secret: %s", key)
+	}
+
+	fetched, err := client.Key(ctx, "alpha")
+	if err != nil || fetched.SharedSecret != "hunter2" || fetched.CreatedAt.IsZero() {
+		t.Fatalf("get: %+v %v", fetched, err)
+	}
+	fetched.QPS = 10
+	if err := fetched.Save(ctx); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if fetched.UpdatedAt.Before(time.Now().Add(-time.Minute)) {
+		t.Fatalf("updated time not maintained: %v", fetched.UpdatedAt)
+	}
+
+	keys, err := client.Keys(ctx, ListOptions{Offset: 0, Limit: 10})
+	if err != nil || len(keys) != 1 || keys[0].QPS != 10 {
+		t.Fatalf("list: %v %v", keys, err)
+	}
+	if _, err := key.Stats(ctx, StatsOptions{Granularity: GranularityHour, ForAPI: "weather"}); err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if _, err := key.APICharts(ctx, GranularityHour); err != nil {
+		t.Fatalf("charts: %v", err)
+	}
+	if err := key.Delete(ctx); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := client.Key(ctx, "alpha"); !IsNotFound(err) {
+		t.Fatalf("key still exists: %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package goaxle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrKeyRingUpdate is returned when saving a keyring which already exists;
+// ApiAxle doesn't support updating them.
+var ErrKeyRingUpdate = errors.New("goaxle: keyrings can't be updated")
+
+// KeyRing groups keys for reporting.
+type KeyRing struct {
+	// Identifier of the keyring.  It can't be changed once created.
+	ID string
+
+	// Maintained by the server.
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	client *Client
+	exists bool
+}
+
+// NewKeyRing prepares a new keyring.  Nothing is sent to the server until
+// Save.
+func (c *Client) NewKeyRing(id string) *KeyRing {
+	return &KeyRing{ID: id, client: c}
+}
+
+// KeyRing fetches an existing keyring.
+func (c *Client) KeyRing(ctx context.Context, id string) (*KeyRing, error) {
+	keyRing := &KeyRing{ID: id, client: c}
+	if err := keyRing.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return keyRing, nil
+}
+
+type keyRingWire struct {
+	CreatedAt float64 `json:"createdAt,omitempty"`
+	UpdatedAt float64 `json:"updatedAt,omitempty"`
+}
+
+// MarshalJSON encodes the keyring in ApiAxle's wire format.
+func (r *KeyRing) MarshalJSON() ([]byte, error) {
+	return json.Marshal(keyRingWire{CreatedAt: toMillis(r.CreatedAt), UpdatedAt: toMillis(r.UpdatedAt)})
+}
+
+// UnmarshalJSON decodes the keyring from ApiAxle's wire format.  Fields
+// missing from data are left unchanged.
+func (r *KeyRing) UnmarshalJSON(data []byte) error {
+	wire := keyRingWire{CreatedAt: toMillis(r.CreatedAt), UpdatedAt: toMillis(r.UpdatedAt)}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	r.CreatedAt = fromMillis(wire.CreatedAt)
+	r.UpdatedAt = fromMillis(wire.UpdatedAt)
+	return nil
+}
+
+// Save creates the keyring.  Saving an existing keyring returns
+// ErrKeyRingUpdate.
+func (r *KeyRing) Save(ctx context.Context) error {
+	if r.exists {
+		return ErrKeyRingUpdate
+	}
+	r.UpdatedAt = time.Now()
+	raw, _, err := call[json.RawMessage](ctx, r.client, http.MethodPost, r.client.endpoint(nil, "keyring", r.ID), r)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, r); err != nil {
+		return fmt.Errorf("goaxle: decode keyring %q: %w", r.ID, err)
+	}
+	r.exists = true
+	return nil
+}
+
+// Delete removes the keyring from the server.
+func (r *KeyRing) Delete(ctx context.Context) error {
+	if err := r.client.deleteResource(ctx, "keyring", r.ID); err != nil {
+		return err
+	}
+	r.exists = false
+	return nil
+}
+
+// Refresh reloads the keyring from the server.
+func (r *KeyRing) Refresh(ctx context.Context) error {
+	raw, _, err := call[json.RawMessage](ctx, r.client, http.MethodGet, r.client.endpoint(nil, "keyring", r.ID), nil)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, r); err != nil {
+		return fmt.Errorf("goaxle: decode keyring %q: %w", r.ID, err)
+	}
+	r.exists = true
+	return nil
+}
+
+// Stats returns hit counts for the keys in the keyring.
+func (r *KeyRing) Stats(ctx context.Context, options StatsOptions) (Stats, error) {
+	stats, _, err := call[Stats](ctx, r.client, http.MethodGet, r.client.endpoint(options.query(), "keyring", r.ID, "stats"), nil)
+	return stats, err
+}
+
+// Keys lists the keys in the keyring.
+func (r *KeyRing) Keys(ctx context.Context, options ListOptions) ([]*Key, error) {
+	return r.client.listKeys(ctx, r.client.endpoint(options.query(), "keyring", r.ID, "keys"))
+}
+
+// LinkKey adds the key to the keyring.
+func (r *KeyRing) LinkKey(ctx context.Context, keyID string) (*Key, error) {
+	return r.client.linkKey(ctx, "keyring", r.ID, "linkkey", keyID)
+}
+
+// UnlinkKey removes the key from the keyring.
+func (r *KeyRing) UnlinkKey(ctx context.Context, keyID string) (*Key, error) {
+	return r.client.linkKey(ctx, "keyring", r.ID, "unlinkkey", keyID)
+}
+
+// String describes the keyring.
+func (r *KeyRing) String() string {
+	return fmt.Sprintf("KeyRing %q", r.ID)
+}
@@ -0,0 +1,50 @@
+package goaxle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestKeyRingLifecycle(t *testing.T) {
+	_, client := newFakeAxle(t)
+	ctx := context.Background()
+
+	keyRing := client.NewKeyRing("partners")
+	if err := keyRing.Save(ctx); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := keyRing.Save(ctx); !errors.Is(err, ErrKeyRingUpdate) {
+		t.Fatalf("expected ErrKeyRingUpdate, got %v", err)
+	}
+
+	if err := client.NewKey("alpha", KeyOptions{}).Save(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keyRing.LinkKey(ctx, "alpha"); err != nil {
+		t.Fatalf("link: %v", err)
+	}
+	keys, err := keyRing.Keys(ctx, ListOptions{})
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("keys: %v %v", keys, err)
+	}
+	if _, err := keyRing.UnlinkKey(ctx, "alpha"); err != nil {
+		t.Fatalf("unlink: %v", err)
+	}
+
+	keyRings, err := client.KeyRings(ctx, ListOptions{})
+	if err != nil || len(keyRings) != 1 || keyRings[0].CreatedAt.IsZero() {
+		t.Fatalf("list: %v %v", keyRings, err)
+	}
+	if _, err := keyRing.Stats(ctx, StatsOptions{From: time.Now().Add(-time.Hour), To: time.Now(), Granularity: GranularityMinute}); err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	fetched, err := client.KeyRing(ctx, "partners")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if err := fetched.Delete(ctx); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+}
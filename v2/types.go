@@ -0,0 +1,138 @@
+package goaxle
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Protocol used to reach an api's endpoint.
+type Protocol string
+
+const (
+	ProtocolHTTP  Protocol = "http"
+	ProtocolHTTPS Protocol = "https"
+)
+
+// Format of the data an api returns.
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatXML  Format = "xml"
+)
+
+// Granularity of stats and charts.
+type Granularity string
+
+const (
+	GranularitySecond Granularity = "second"
+	GranularityMinute Granularity = "minute"
+	GranularityHour   Granularity = "hour"
+	GranularityDay    Granularity = "day"
+)
+
+func (g Granularity) query() url.Values {
+	return url.Values{"granularity": {string(g)}}
+}
+
+// HitType classifies responses in stats.
+type HitType string
+
+const (
+	HitCached   HitType = "cached"
+	HitUncached HitType = "uncached"
+	HitError    HitType = "error"
+)
+
+// Stats holds hit counts by hit type, then time bucket, then HTTP status.
+type Stats map[HitType]map[time.Time]map[int]int
+
+// UnmarshalJSON decodes ApiAxle's string keyed stats results.
+func (s *Stats) UnmarshalJSON(data []byte) error {
+	var raw map[HitType]map[string]map[string]int
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	stats := make(Stats, len(raw))
+	for hitType, buckets := range raw {
+		stats[hitType] = make(map[time.Time]map[int]int, len(buckets))
+		for bucket, statuses := range buckets {
+			seconds, err := strconv.ParseInt(bucket, 10, 64)
+			if err != nil {
+				return fmt.Errorf("goaxle: invalid stats timestamp %q", bucket)
+			}
+			counts := make(map[int]int, len(statuses))
+			for status, count := range statuses {
+				code, err := strconv.Atoi(status)
+				if err != nil {
+					return fmt.Errorf("goaxle: invalid stats status %q", status)
+				}
+				counts[code] = count
+			}
+			stats[hitType][time.Unix(seconds, 0)] = counts
+		}
+	}
+	*s = stats
+	return nil
+}
+
+// StatsOptions selects the stats to fetch.
+type StatsOptions struct {
+	From, To    time.Time
+	Granularity Granularity
+
+	// Restrict api or keyring stats to a single key.
+	ForKey string
+	// Restrict key or keyring stats to a single api.
+	ForAPI string
+}
+
+func (o StatsOptions) query() url.Values {
+	query := o.Granularity.query()
+	query.Set("from", strconv.FormatInt(o.From.Unix(), 10))
+	query.Set("to", strconv.FormatInt(o.To.Unix(), 10))
+	if o.ForKey != "" {
+		query.Set("forkey", o.ForKey)
+	}
+	if o.ForAPI != "" {
+		query.Set("forapi", o.ForAPI)
+	}
+	return query
+}
+
+// toMillis converts t to the milliseconds since epoch ApiAxle uses for
+// createdAt and updatedAt, with the zero time as 0.
+func toMillis(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.Unix())*1000 + float64(t.Nanosecond())/1e6
+}
+
+// fromMillis is the inverse of toMillis.
+func fromMillis(ms float64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	// a float64 holds present day times to within a microsecond
+	seconds := math.Floor(ms / 1000)
+	micros := math.Round((ms - seconds*1000) * 1000)
+	return time.Unix(int64(seconds), int64(micros)*1000)
+}
+
+// toSeconds rounds up to whole seconds so small durations don't become 0.
+func toSeconds(d time.Duration) int {
+	seconds := d / time.Second
+	if d%time.Second > 0 {
+		seconds++
+	}
+	return int(seconds)
+}
+
+func fromSeconds(seconds int) time.Duration {
+	return time.Duration(seconds) * time.Second
+}
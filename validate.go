@@ -0,0 +1,183 @@
+package goaxle
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ValidateBeforeSave controls whether Save validates objects before sending
+// them to the server.
+var ValidateBeforeSave = true
+
+// identifiers are kept to the unreserved characters of RFC 3986, so they
+// are the same escaped or not wherever they appear in urls and logs, and
+// can't contain the colons separating ApiAxle's redis keys
+var identifierPattern = regexp.MustCompile(`^[A-Za-z0-9._~-]+$`)
+
+var hostnamePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*\.?$`)
+
+// FieldError describes a single invalid field.
+type FieldError struct {
+	// Name of the field as it appears in the ApiAxle JSON representation.
+	Field   string
+	Message string
+}
+
+// ValidationError lists every invalid field found on an object.
+type ValidationError struct {
+	// "api", "key" or "keyring"
+	Kind       string
+	Identifier string
+	Fields     []FieldError
+}
+
+func (this *ValidationError) Error() string {
+	problems := make([]string, len(this.Fields))
+	for x, field := range this.Fields {
+		problems[x] = fmt.Sprintf("%s %s", field.Field, field.Message)
+	}
+	return fmt.Sprintf(
+		"Invalid %s \"%s\": %s",
+		this.Kind,
+		this.Identifier,
+		strings.Join(problems, "; "),
+	)
+}
+
+func (this *ValidationError) add(field string, format string, args ...interface{}) {
+	this.Fields = append(this.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// result returns this as an error if any fields failed.
+func (this *ValidationError) result() error {
+	if len(this.Fields) == 0 {
+		return nil
+	}
+	return this
+}
+
+func validateIdentifier(errs *ValidationError, identifier string) {
+	if !identifierPattern.MatchString(identifier) {
+		errs.add("identifier", "must be made of letters, digits, '.', '_', '~' or '-'")
+	}
+}
+
+// validateEndPoint checks endPoint is a host with an optional port.
+func validateEndPoint(endPoint string) (problem string) {
+	if endPoint == "" {
+		return "is required"
+	}
+	if strings.Contains(endPoint, "://") {
+		return "must not include a scheme, set Protocol instead"
+	}
+	if strings.ContainsAny(endPoint, "/?#") {
+		return "must not include a path, set DefaultPath instead"
+	}
+
+	host := endPoint
+	if strings.HasPrefix(endPoint, "[") || strings.Count(endPoint, ":") == 1 {
+		var port string
+		var err error
+		host, port, err = net.SplitHostPort(endPoint)
+		if err != nil {
+			return fmt.Sprintf("is not a valid host[:port]: %s", err)
+		}
+		number, err := strconv.Atoi(port)
+		if err != nil || number < 1 || number > 65535 {
+			return fmt.Sprintf("has an invalid port \"%s\"", port)
+		}
+	}
+	if net.ParseIP(host) != nil {
+		return ""
+	}
+	if !hostnamePattern.MatchString(host) {
+		return fmt.Sprintf("has an invalid host \"%s\"", host)
+	}
+	return ""
+}
+
+// Validate checks the api for values the server would reject, returning a
+// *ValidationError listing every problem found.
+func (this *Api) Validate() error {
+	errs := &ValidationError{Kind: "api", Identifier: this.Identifier}
+
+	validateIdentifier(errs, this.Identifier)
+
+	if problem := validateEndPoint(this.EndPoint); problem != "" {
+		errs.add("endPoint", "%s", problem)
+	}
+
+	switch this.Protocol {
+	case API_PROTOCOL_HTTP, API_PROTOCOL_HTTPS:
+	default:
+		errs.add("protocol", "must be \"%s\" or \"%s\"", API_PROTOCOL_HTTP, API_PROTOCOL_HTTPS)
+	}
+
+	switch this.ApiFormat {
+	case API_FORMAT_JSON, API_FORMAT_XML:
+	default:
+		errs.add("apiFormat", "must be \"%s\" or \"%s\"", API_FORMAT_JSON, API_FORMAT_XML)
+	}
+
+	if this.ExtractKeyRegex != "" {
+		// ApiAxle uses Javascript regular expressions, the common subset
+		// compiles the same way
+		compiled, err := regexp.Compile(this.ExtractKeyRegex)
+		if err != nil {
+			errs.add("extractKeyRegex", "does not compile: %s", err)
+		} else if compiled.NumSubexp() < 1 {
+			errs.add("extractKeyRegex", "must contain a capture group for the key")
+		}
+	}
+
+	if this.EndPointTimeout <= 0 {
+		errs.add("endPointTimeout", "must be positive")
+	}
+	if this.EndPointMaxRedirects < 0 {
+		errs.add("endPointMaxRedirects", "must not be negative")
+	}
+	if this.GlobalCache < 0 {
+		errs.add("globalCache", "must not be negative")
+	}
+
+	return errs.result()
+}
+
+// Validate checks the key for values the server would reject, returning a
+// *ValidationError listing every problem found.
+func (this *Key) Validate() error {
+	errs := &ValidationError{Kind: "key", Identifier: this.Identifier}
+
+	validateIdentifier(errs, this.Identifier)
+
+	if this.Qps != -1 && this.Qps <= 0 {
+		errs.add("qps", "must be -1 (unlimited) or positive")
+	}
+	if this.Qpd != -1 && this.Qpd <= 0 {
+		errs.add("qpd", "must be -1 (unlimited) or positive")
+	}
+	if this.Qps > 0 && this.Qpd > 0 && this.Qps > this.Qpd {
+		errs.add("qps", "must not exceed qpd (%d)", this.Qpd)
+	}
+
+	for _, api := range this.ForApis {
+		if !identifierPattern.MatchString(api) {
+			errs.add("forApis", "contains invalid api identifier \"%s\"", api)
+		}
+	}
+
+	return errs.result()
+}
+
+// Validate checks the keyring for values the server would reject, returning
+// a *ValidationError listing every problem found.
+func (this *KeyRing) Validate() error {
+	errs := &ValidationError{Kind: "keyring", Identifier: this.Identifier}
+	validateIdentifier(errs, this.Identifier)
+	return errs.result()
+}
+
+/* ex: set noexpandtab: */
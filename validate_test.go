@@ -0,0 +1,115 @@
+package goaxle
+
+import (
+	"errors"
+	"testing"
+)
+
+// invalidFields returns the names of the fields err complains about.
+func invalidFields(t *testing.T, err error) (fields []string) {
+	if err == nil {
+		return nil
+	}
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a *ValidationError, got %T: %v", err, err)
+	}
+	for _, field := range validationErr.Fields {
+		fields = append(fields, field.Field)
+	}
+	return fields
+}
+
+func TestApiValidate(t *testing.T) {
+	if err := NewApi(TEST_API_AXLE_SERVER, "weather", "api.example.com:8080").Validate(); err != nil {
+		t.Fatalf("Valid api rejected: %v", err)
+	}
+	for _, endPoint := range []string{"localhost", "10.0.0.1:80", "[::1]:443", "::1", "a-b.example.com."} {
+		if err := NewApi(TEST_API_AXLE_SERVER, "weather", endPoint).Validate(); err != nil {
+			t.Errorf("Valid endpoint %q rejected: %v", endPoint, err)
+		}
+	}
+	for _, endPoint := range []string{"", "http://example.com", "example.com/path", "example.com:0", "example.com:http", "-bad-.com", "exa mple.com"} {
+		if fields := invalidFields(t, NewApi(TEST_API_AXLE_SERVER, "weather", endPoint).Validate()); len(fields) != 1 || fields[0] != "endPoint" {
+			t.Errorf("Invalid endpoint %q not rejected: %v", endPoint, fields)
+		}
+	}
+
+	api := NewApi(TEST_API_AXLE_SERVER, "bad name", "example.com")
+	api.Protocol = "ftp"
+	api.ApiFormat = "yaml"
+	api.ExtractKeyRegex = "key=[a-z]+"
+	api.EndPointTimeout = 0
+	api.GlobalCache = -1
+	err := api.Validate()
+	fields := invalidFields(t, err)
+	expected := []string{"identifier", "protocol", "apiFormat", "extractKeyRegex", "endPointTimeout", "globalCache"}
+	if len(fields) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, fields)
+	}
+	for x := range expected {
+		if fields[x] != expected[x] {
+			t.Fatalf("Expected %v, got %v", expected, fields)
+		}
+	}
+
+	api = NewApi(TEST_API_AXLE_SERVER, "weather", "example.com")
+	api.ExtractKeyRegex = "key=([a-z]+"
+	if fields := invalidFields(t, api.Validate()); len(fields) != 1 || fields[0] != "extractKeyRegex" {
+		t.Errorf("Uncompilable regex not rejected: %v", fields)
+	}
+	api.ExtractKeyRegex = "key=([a-z]+)"
+	if err := api.Validate(); err != nil {
+		t.Errorf("Valid regex rejected: %v", err)
+	}
+}
+
+func TestKeyValidate(t *testing.T) {
+	if err := NewKey(TEST_API_AXLE_SERVER, "abc123").Validate(); err != nil {
+		t.Fatalf("Valid key rejected: %v", err)
+	}
+
+	key := NewKey(TEST_API_AXLE_SERVER, "abc123")
+	key.Qps = -1
+	key.Qpd = -1
+	if err := key.Validate(); err != nil {
+		t.Fatalf("Unlimited key rejected: %v", err)
+	}
+
+	cases := []struct {
+		qps int
+		qpd int
+	}{
+		{0, 100},
+		{2, -5},
+		{200, 100},
+	}
+	for _, c := range cases {
+		key := NewKey(TEST_API_AXLE_SERVER, "abc123")
+		key.Qps = c.qps
+		key.Qpd = c.qpd
+		if fields := invalidFields(t, key.Validate()); len(fields) != 1 {
+			t.Errorf("qps %d qpd %d: expected one problem, got %v", c.qps, c.qpd, fields)
+		}
+	}
+}
+
+func TestSaveValidates(t *testing.T) {
+	axle := newTestAxle(t, nil)
+	err := NewApi(axle.address(), "weather", "").Save()
+	if fields := invalidFields(t, err); len(fields) != 1 || fields[0] != "endPoint" {
+		t.Fatalf("Save didn't validate: %v", err)
+	}
+	if axle.requestCount() != 0 {
+		t.Fatalf("Invalid api was sent to the server")
+	}
+
+	ValidateBeforeSave = false
+	defer func() { ValidateBeforeSave = true }()
+	err = NewApi(axle.address(), "weather", "").Save()
+	if err == nil || axle.requestCount() != 1 {
+		t.Fatalf("Save didn't skip validation")
+	}
+}
+
+/* ex: set noexpandtab: */
@@ -0,0 +1,294 @@
+package goaxle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Kind of change reported by Watch.
+type EventType string
+
+const (
+	ApiCreated EventType = "api_created"
+	ApiUpdated EventType = "api_updated"
+	ApiDeleted EventType = "api_deleted"
+
+	KeyCreated EventType = "key_created"
+	KeyUpdated EventType = "key_updated"
+	KeyDeleted EventType = "key_deleted"
+
+	KeyRingCreated EventType = "keyring_created"
+	KeyRingUpdated EventType = "keyring_updated"
+	KeyRingDeleted EventType = "keyring_deleted"
+
+	// A key was linked with / unlinked from an api.
+	KeyLinked   EventType = "key_linked"
+	KeyUnlinked EventType = "key_unlinked"
+
+	// A key was added to / removed from a keyring.
+	KeyRingKeyLinked   EventType = "keyring_key_linked"
+	KeyRingKeyUnlinked EventType = "keyring_key_unlinked"
+
+	// Polling the server failed, see Event.Err.
+	WatchFailed EventType = "watch_failed"
+)
+
+// FieldChange describes a single modified field, named as it appears in the
+// ApiAxle JSON representation.
+type FieldChange struct {
+	Field string
+	Old   interface{}
+	New   interface{}
+}
+
+// Event is a single change observed by Watch.
+type Event struct {
+	Type EventType
+
+	// Identifier of the api, key or keyring the event is about.  For link
+	// events this is the key.
+	Identifier string
+
+	// For link events, the api or keyring the key was linked with or
+	// unlinked from.
+	Target string
+
+	// The fields that differ, for update events.
+	Changes []FieldChange
+
+	// The current state of the object, or the last known state for delete
+	// events.  Only the field matching the event's subject is set.
+	Api     *Api
+	Key     *Key
+	KeyRing *KeyRing
+
+	// Set on WatchFailed events.
+	Err error
+
+	// When the change was observed.
+	Time time.Time
+}
+
+// WatchOptions configures Watch.
+type WatchOptions struct {
+	// Address of the ApiAxle server to watch.
+	AxleAddress string
+
+	// Time between polls.  Defaults to 30 seconds.
+	Interval time.Duration
+
+	// Capacity of the returned channel.
+	Buffer int
+
+	// Report everything found by the first poll as created.
+	EmitInitial bool
+}
+
+// Watch polls the server for changes to apis, keys, keyrings and the links
+// between them, sending an Event on the returned channel for each one.  The
+// first poll happens before Watch returns and its error, if any, is returned
+// directly; later failures are reported as WatchFailed events.  The channel
+// is closed once ctx is done.
+func Watch(ctx context.Context, options WatchOptions) (events <-chan Event, err error) {
+	if options.AxleAddress == "" {
+		return nil, fmt.Errorf("Unable to watch, no AxleAddress provided")
+	}
+	if options.Interval <= 0 {
+		options.Interval = 30 * time.Second
+	}
+
+	previous, err := LoadSnapshot(options.AxleAddress)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to watch %s: %s", options.AxleAddress, err)
+	}
+
+	out := make(chan Event, options.Buffer)
+	go func() {
+		defer close(out)
+
+		send := func(event Event) bool {
+			select {
+			case out <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		if options.EmitInitial {
+			for _, event := range DiffSnapshots(&Snapshot{}, previous) {
+				if !send(event) {
+					return
+				}
+			}
+		}
+
+		ticker := time.NewTicker(options.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			current, err := LoadSnapshot(options.AxleAddress)
+			if err != nil {
+				if !send(Event{Type: WatchFailed, Err: err, Time: time.Now()}) {
+					return
+				}
+				continue
+			}
+			for _, event := range DiffSnapshots(previous, current) {
+				if !send(event) {
+					return
+				}
+			}
+			previous = current
+		}
+	}()
+
+	return out, nil
+}
+
+// DiffSnapshots returns the events describing how to get from old to new.
+// Events are grouped by subject: apis, keys and keyrings, each sorted by
+// identifier, then api links and keyring links, each sorted by target and
+// then key.
+func DiffSnapshots(old *Snapshot, new *Snapshot) (events []Event) {
+	now := new.LoadedAt
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	for _, identifier := range unionKeys(old.Apis, new.Apis) {
+		before, after := old.Apis[identifier], new.Apis[identifier]
+		event := Event{Identifier: identifier, Time: now, Api: after}
+		switch {
+		case before == nil:
+			event.Type = ApiCreated
+		case after == nil:
+			event.Type = ApiDeleted
+			event.Api = before
+		default:
+			if event.Changes = diffFields(before, after); len(event.Changes) == 0 {
+				continue
+			}
+			event.Type = ApiUpdated
+		}
+		events = append(events, event)
+	}
+
+	for _, identifier := range unionKeys(old.Keys, new.Keys) {
+		before, after := old.Keys[identifier], new.Keys[identifier]
+		event := Event{Identifier: identifier, Time: now, Key: after}
+		switch {
+		case before == nil:
+			event.Type = KeyCreated
+		case after == nil:
+			event.Type = KeyDeleted
+			event.Key = before
+		default:
+			if event.Changes = diffFields(before, after); len(event.Changes) == 0 {
+				continue
+			}
+			event.Type = KeyUpdated
+		}
+		events = append(events, event)
+	}
+
+	for _, identifier := range unionKeys(old.KeyRings, new.KeyRings) {
+		before, after := old.KeyRings[identifier], new.KeyRings[identifier]
+		event := Event{Identifier: identifier, Time: now, KeyRing: after}
+		switch {
+		case before == nil:
+			event.Type = KeyRingCreated
+		case after == nil:
+			event.Type = KeyRingDeleted
+			event.KeyRing = before
+		default:
+			if event.Changes = diffFields(before, after); len(event.Changes) == 0 {
+				continue
+			}
+			event.Type = KeyRingUpdated
+		}
+		events = append(events, event)
+	}
+
+	events = append(events, diffLinks(old.ApiKeys, new.ApiKeys, KeyLinked, KeyUnlinked, now)...)
+	events = append(events, diffLinks(old.KeyRingKeys, new.KeyRingKeys, KeyRingKeyLinked, KeyRingKeyUnlinked, now)...)
+
+	return events
+}
+
+// diffLinks compares two target -> keys maps.
+func diffLinks(old map[string][]string, new map[string][]string, linked EventType, unlinked EventType, now time.Time) (events []Event) {
+	for _, target := range unionKeys(old, new) {
+		before := make(map[string]bool, len(old[target]))
+		for _, key := range old[target] {
+			before[key] = true
+		}
+		after := make(map[string]bool, len(new[target]))
+		for _, key := range new[target] {
+			after[key] = true
+		}
+		for _, key := range unionKeys(before, after) {
+			if before[key] == after[key] {
+				continue
+			}
+			event := Event{Type: linked, Identifier: key, Target: target, Time: now}
+			if before[key] {
+				event.Type = unlinked
+			}
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// diffFields compares the JSON representations of two objects field by field.
+func diffFields(old interface{}, new interface{}) (changes []FieldChange) {
+	before := jsonFields(old)
+	after := jsonFields(new)
+	for _, field := range unionKeys(before, after) {
+		if !reflect.DeepEqual(before[field], after[field]) {
+			changes = append(changes, FieldChange{
+				Field: field,
+				Old:   before[field],
+				New:   after[field],
+			})
+		}
+	}
+	return changes
+}
+
+func jsonFields(object interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	marshalled, err := json.Marshal(object)
+	if err != nil {
+		return fields
+	}
+	json.Unmarshal(marshalled, &fields)
+	return fields
+}
+
+// unionKeys returns the sorted keys present in either map.
+func unionKeys[V any](a map[string]V, b map[string]V) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, exists := a[key]; !exists {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+/* ex: set noexpandtab: */
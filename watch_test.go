@@ -0,0 +1,103 @@
+package goaxle
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	old := &Snapshot{
+		Apis: map[string]*Api{
+			"weather": {Identifier: "weather", EndPoint: "weather.example.com", UpdatedAt: 1},
+			"maps":    {Identifier: "maps", EndPoint: "maps.example.com"},
+		},
+		Keys: map[string]*Key{
+			"alpha": {Identifier: "alpha", Qps: 2, Qpd: 100},
+		},
+		ApiKeys: map[string][]string{"weather": {"alpha"}},
+	}
+	new := &Snapshot{
+		Apis: map[string]*Api{
+			"weather": {Identifier: "weather", EndPoint: "weather.example.org", UpdatedAt: 2},
+		},
+		Keys: map[string]*Key{
+			"alpha": {Identifier: "alpha", Qps: 2, Qpd: 100},
+			"beta":  {Identifier: "beta", Qps: 1, Qpd: 10},
+		},
+		KeyRings:    map[string]*KeyRing{"partners": {Identifier: "partners"}},
+		ApiKeys:     map[string][]string{"weather": {"beta"}},
+		KeyRingKeys: map[string][]string{"partners": {"beta"}},
+	}
+
+	events := DiffSnapshots(old, new)
+	expected := []struct {
+		eventType  EventType
+		identifier string
+		target     string
+	}{
+		{ApiDeleted, "maps", ""},
+		{ApiUpdated, "weather", ""},
+		{KeyCreated, "beta", ""},
+		{KeyRingCreated, "partners", ""},
+		{KeyUnlinked, "alpha", "weather"},
+		{KeyLinked, "beta", "weather"},
+		{KeyRingKeyLinked, "beta", "partners"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %d: %v", len(expected), len(events), events)
+	}
+	for x, want := range expected {
+		got := events[x]
+		if got.Type != want.eventType || got.Identifier != want.identifier || got.Target != want.target {
+			t.Errorf("Event %d: expected %v %v %v, got %v %v %v", x, want.eventType, want.identifier, want.target, got.Type, got.Identifier, got.Target)
+		}
+	}
+
+	changes := events[1].Changes
+	if len(changes) != 2 || changes[0].Field != "endPoint" || changes[1].Field != "updatedAt" {
+		t.Fatalf("Unexpected field changes: %v", changes)
+	}
+	if changes[0].Old != "weather.example.com" || changes[0].New != "weather.example.org" {
+		t.Fatalf("Unexpected endPoint change: %v", changes[0])
+	}
+	if events[0].Api == nil || events[0].Api.EndPoint != "maps.example.com" {
+		t.Fatalf("Deleted event should carry the last known api")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	axle := newTestAxle(t, snapshotResponses())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := Watch(ctx, WatchOptions{
+		AxleAddress: axle.address(),
+		Interval:    10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Unable to watch: %v", err)
+	}
+
+	axle.set("GET /v1/keys", `{"meta":{"version":1,"status_code":200},"results":{
+		"alpha":{"createdAt":1380000000000,"updatedAt":1390000000000,"qps":4,"qpd":1000},
+		"beta":{"createdAt":1380000000000,"updatedAt":1380000000000,"qps":5,"qpd":5000}}}`)
+
+	select {
+	case event := <-events:
+		if event.Type != KeyUpdated || event.Identifier != "alpha" {
+			t.Fatalf("Unexpected event: %v", event)
+		}
+		if len(event.Changes) != 2 {
+			t.Fatalf("Unexpected changes: %v", event.Changes)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("No event received")
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+/* ex: set noexpandtab: */